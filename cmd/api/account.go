@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rijojohn85/social/internal/env"
+	"github.com/rijojohn85/social/internal/mailer"
+	"github.com/rijojohn85/social/internal/store"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UpdateProfilePayload struct {
+	Username    *string `json:"username" validate:"omitempty,min=1,max=20"`
+	DisplayName *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	// only followers see the posts of private accounts
+	IsPrivate *bool `json:"is_private"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,min=3,max=72"`
+}
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// UpdateProfile godoc
+//
+//	@Summary		Updates the profile of the current user
+//	@Description	Changes the username, display name, bio or privacy. Fields that are left out keep their value.
+//	@Description	Making the account public approves the pending follow requests
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile fields"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error	"Username taken"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [PATCH]
+func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := *r.Context().Value(userCtxKey).(*store.User)
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.IsPrivate != nil {
+		user.IsPrivate = *payload.IsPrivate
+	}
+	if err := app.store.Users.UpdateProfile(r.Context(), &user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateUsername):
+			app.conflictRequestError(w, r, err)
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.forgetUser(r.Context(), user.ID)
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Changes the password of the current user
+//	@Description	Sets a new password after checking the current one. Every other session is signed out
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangePasswordPayload	true	"Change password payload"
+//	@Success		200		{string}	string					"Password updated"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error	"Wrong current password"
+//	@Failure		429		{object}	error	"Too many wrong passwords"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/password [PUT]
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangePasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user, ok := app.checkCurrentPassword(w, r, payload.CurrentPassword)
+	if !ok {
+		return
+	}
+	if err := user.Password.Set(payload.NewPassword); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	sessionID := r.Context().Value(sessionCtxKey).(string)
+	if err := app.store.Users.ChangePassword(r.Context(), user, sessionID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.forgetUser(r.Context(), user.ID)
+	if err := app.jsonResponse(w, http.StatusOK, "password updated"); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ChangeEmail godoc
+//
+//	@Summary		Changes the email of the current user
+//	@Description	Emails a confirmation link to the new address. The account keeps the old email until the link is used
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangeEmailPayload	true	"Change email payload"
+//	@Success		202		{string}	string				"Confirmation email sent"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error	"Wrong password"
+//	@Failure		409		{object}	error	"Email taken"
+//	@Failure		429		{object}	error	"Too many wrong passwords"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [POST]
+func (app *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeEmailPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user, ok := app.checkCurrentPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+	plainToken := uuid.New().String()
+	err := app.store.Users.CreateEmailChange(
+		r.Context(),
+		user.ID,
+		payload.Email,
+		plainToken,
+		app.config.mail.emailChangeExp,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.sendEmailChangeEmail(user.Username, payload.Email, plainToken); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, "confirmation email sent"); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) sendEmailChangeEmail(username, email, plainToken string) error {
+	domain := env.GetString("DOMAIN", "http://localhost:8080")
+	vars := struct {
+		Username   string
+		ConfirmURL string
+		Expiry     string
+	}{
+		Username:   username,
+		ConfirmURL: fmt.Sprintf("%s/v1/users/email/confirm/%s", domain, plainToken),
+		Expiry:     app.config.mail.emailChangeExp.String(),
+	}
+	isProdEnv := app.config.env == "production"
+	return app.mailer.Send(
+		mailer.EmailChangeTemplate,
+		username,
+		email,
+		vars,
+		!isProdEnv,
+	)
+}
+
+// ConfirmEmailChange godoc
+//
+//	@Summary		Confirms a new email
+//	@Description	Moves the account to the email the confirmation token was sent to
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Confirmation Token"
+//	@Success		200		{string}	string	"Email updated"
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error	"Email taken"
+//	@Failure		500		{object}	error
+//	@Router			/users/email/confirm/{token} [PUT]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		app.badRequestError(w, r, errors.New("token required"))
+		return
+	}
+	userID, err := app.store.Users.ConfirmEmailChange(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidToken), errors.Is(err, store.ErrTokenExpired):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrDuplicateEmail):
+			app.conflictRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.forgetUser(r.Context(), userID)
+	if err := app.jsonResponse(w, http.StatusOK, "email updated"); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteAccount godoc
+//
+//	@Summary		Deletes the account of the current user
+//	@Description	Signs the user out everywhere and hides the account. Logging in during the grace period restores it, after that it is purged
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body	DeleteAccountPayload	true	"Delete account payload"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error	"Wrong password"
+//	@Failure		429	{object}	error	"Too many wrong passwords"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [DELETE]
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user, ok := app.checkCurrentPassword(w, r, payload.Password)
+	if !ok {
+		return
+	}
+	if err := app.store.Users.SoftDelete(r.Context(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.forgetUser(r.Context(), user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCurrentPassword loads the current user with their password and checks
+// it against password. It writes the error response when it returns false.
+// Wrong passwords count towards the login lockout, a stolen access token must
+// not allow guessing the password without limits.
+func (app *application) checkCurrentPassword(
+	w http.ResponseWriter,
+	r *http.Request,
+	password string,
+) (*store.User, bool) {
+	current := r.Context().Value(userCtxKey).(*store.User)
+	ip := clientIP(r)
+	if wait := app.loginBlockedFor(r.Context(), current.Email, ip); wait > 0 {
+		app.rateLimitExceededResponse(w, r, wait)
+		return nil, false
+	}
+	user, err := app.store.Users.GetUserByEmail(r.Context(), current.Email)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if err := bcrypt.CompareHashAndPassword(user.Password.Hash, []byte(password)); err != nil {
+		app.loginFailed(r.Context(), current.Email, ip)
+		app.unauthorizedError(w, r, errors.New("invalid credentials"))
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+const (
+	// defaultRoleName is the role every new account is registered with
+	defaultRoleName       = "user"
+	manageUsersPermission = "users:manage"
+)
+
+var (
+	errAccountDeactivated = errors.New("account deactivated")
+	errAccountDeleted     = errors.New("account deleted")
+	errOwnAccount         = errors.New("admins can't change their own account here")
+)
+
+type SetUserRolePayload struct {
+	RoleID int64 `json:"role_id" validate:"required,gte=1"`
+}
+
+// ListUsers godoc
+//
+//	@Summary		Lists users
+//	@Description	Lists and searches users by username or email
+//	@Tags			admin
+//	@Produce		json
+//	@Param			search	query		string	false	"Part of the username or email"
+//	@Param			role_id	query		int		false	"Role ID"
+//	@Param			status	query		string	false	"active, pending or deactivated"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.User
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users [GET]
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	uq := store.PaginatedUserQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	uq, err := uq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(uq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	users, err := app.store.Users.List(r.Context(), uq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SetUserRole godoc
+//
+//	@Summary	Changes the role of a user
+//	@Tags		admin
+//	@Accept		json
+//	@Param		userID	path	int					true	"User ID"
+//	@Param		payload	body	SetUserRolePayload	true	"Role"
+//	@Success	204
+//	@Failure	400	{object}	error
+//	@Failure	403	{object}	error
+//	@Failure	404	{object}	error
+//	@Failure	409	{object}	error
+//	@Failure	500	{object}	error
+//	@Security	ApiKeyAuth
+//	@Router		/admin/users/{userID}/role [PUT]
+func (app *application) setUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	var payload SetUserRolePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := app.store.Users.SetRole(r.Context(), userID, payload.RoleID); err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+	app.forgetUser(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeactivateUser godoc
+//
+//	@Summary		Deactivates a user
+//	@Description	Blocks the user from signing in and signs them out everywhere
+//	@Tags			admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/deactivate [POST]
+func (app *application) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := app.store.Users.Deactivate(r.Context(), userID); err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+	app.forgetUser(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReactivateUser godoc
+//
+//	@Summary	Reactivates a user
+//	@Tags		admin
+//	@Param		userID	path	int	true	"User ID"
+//	@Success	204
+//	@Failure	400	{object}	error
+//	@Failure	403	{object}	error
+//	@Failure	404	{object}	error
+//	@Failure	409	{object}	error
+//	@Failure	500	{object}	error
+//	@Security	ApiKeyAuth
+//	@Router		/admin/users/{userID}/reactivate [POST]
+func (app *application) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := app.store.Users.Reactivate(r.Context(), userID); err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+	app.forgetUser(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForcePasswordReset godoc
+//
+//	@Summary		Forces a password reset
+//	@Description	Invalidates the password, signs the user out everywhere and emails a reset link
+//	@Tags			admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/password-reset [POST]
+func (app *application) forcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	plainToken := uuid.New().String()
+	user, err := app.store.Users.ForcePasswordReset(
+		r.Context(),
+		userID,
+		plainToken,
+		app.config.mail.resetExp,
+	)
+	if err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+	// the password is already gone, the user can still use the forgot password
+	// flow if the mail is lost
+	if err := app.sendPasswordResetEmail(user, plainToken); err != nil {
+		app.logger.Errorw("Error sending password reset mail", "error", err, "user", user.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUser godoc
+//
+//	@Summary		Deletes a user
+//	@Description	Deletes a user with their posts and comments
+//	@Tags			admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID} [DELETE]
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := app.store.Users.Delete(r.Context(), userID); err != nil {
+		app.adminUserError(w, r, err)
+		return
+	}
+	app.forgetUser(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminTargetUser reads the user an admin acts on. Admins can't act on their
+// own account, so nobody locks themselves out by accident.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return 0, false
+	}
+	admin := r.Context().Value(userCtxKey).(*store.User)
+	if userID == admin.ID {
+		app.conflictRequestError(w, r, errOwnAccount)
+		return 0, false
+	}
+	return userID, true
+}
+
+func (app *application) adminUserError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrorNotFound):
+		app.notFoundError(w, r, err)
+	case errors.Is(err, store.ErrUnknownRole):
+		app.badRequestError(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// forgetUser drops the cached copy of a user after it changed.
+func (app *application) forgetUser(ctx context.Context, userID int64) {
+	if err := app.cacheStorage.Users.Delete(ctx, userID); err != nil {
+		app.logger.Errorw("Error deleting user from cache", "error", err, "user", userID)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// adminUserStore signs in as user 1 with the role of roleID, user 99 doesn't
+// exist.
+type adminUserStore struct {
+	store.MockUserStore
+	roleID int64
+}
+
+func (m *adminUserStore) GetUser(ctx context.Context, user *store.User, userID int64) error {
+	*user = store.User{ID: 1, RoleID: m.roleID}
+	return nil
+}
+
+func (m *adminUserStore) SetRole(ctx context.Context, userID, roleID int64) error {
+	if roleID == 99 {
+		return store.ErrUnknownRole
+	}
+	return missingUser(userID)
+}
+
+func (m *adminUserStore) Deactivate(ctx context.Context, userID int64) error {
+	return missingUser(userID)
+}
+
+func (m *adminUserStore) Reactivate(ctx context.Context, userID int64) error {
+	return missingUser(userID)
+}
+
+func (m *adminUserStore) ForcePasswordReset(
+	ctx context.Context,
+	userID int64,
+	token string,
+	exp time.Duration,
+) (*store.User, error) {
+	if err := missingUser(userID); err != nil {
+		return nil, err
+	}
+	return &store.User{ID: userID, Email: "target@example.com"}, nil
+}
+
+func (m *adminUserStore) Delete(ctx context.Context, userID int64) error {
+	return missingUser(userID)
+}
+
+func missingUser(userID int64) error {
+	if userID == 99 {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+// adminRoleStore knows the permissions of the mock roles only, role 1 is in
+// use and role 99 doesn't exist.
+type adminRoleStore struct {
+	store.MockRoleStore
+}
+
+func (m *adminRoleStore) Create(ctx context.Context, role *store.Role) error {
+	if role.RoleName == "admin" {
+		return store.ErrDuplicateRole
+	}
+	return nil
+}
+
+func (m *adminRoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	if roleID == 99 {
+		return store.ErrorNotFound
+	}
+	if slices.Contains(permissions, "posts:burn") {
+		return store.ErrUnknownPermission
+	}
+	return nil
+}
+
+func (m *adminRoleStore) Delete(ctx context.Context, roleID int64) error {
+	switch roleID {
+	case 1:
+		return store.ErrRoleInUse
+	case 99:
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+func TestAdminUsers(t *testing.T) {
+	newMux := func(t *testing.T, roleID int64) (http.Handler, *sentMail) {
+		app := NewTestApplication(t)
+		app.store.Users = &adminUserStore{roleID: roleID}
+		app.store.Roles = &adminRoleStore{}
+		app.cacheStorage.Users = &uncachedUsers{}
+		mail := &sentMail{}
+		app.mailer = mail
+		return app.mount(), mail
+	}
+	const (
+		moderator = 2
+		admin     = 3
+	)
+	testToken, _ := NewTestApplication(t).authenticator.GenerateToken(nil)
+	tests := []struct {
+		name   string
+		roleID int64
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"should forbid listing to moderators", moderator, http.MethodGet, "/v1/admin/users", "", http.StatusForbidden},
+		{"should list users", admin, http.MethodGet, "/v1/admin/users?search=go&status=active", "", http.StatusOK},
+		{"should check the status filter", admin, http.MethodGet, "/v1/admin/users?status=banned", "", http.StatusBadRequest},
+		{"should check the limit", admin, http.MethodGet, "/v1/admin/users?limit=101", "", http.StatusBadRequest},
+
+		{"should forbid roles to moderators", moderator, http.MethodPut, "/v1/admin/users/2/role", `{"role_id":3}`, http.StatusForbidden},
+		{"should set a role", admin, http.MethodPut, "/v1/admin/users/2/role", `{"role_id":2}`, http.StatusNoContent},
+		{"should need a role", admin, http.MethodPut, "/v1/admin/users/2/role", `{}`, http.StatusBadRequest},
+		{"should refuse an unknown role", admin, http.MethodPut, "/v1/admin/users/2/role", `{"role_id":99}`, http.StatusBadRequest},
+		{"should refuse the own role", admin, http.MethodPut, "/v1/admin/users/1/role", `{"role_id":1}`, http.StatusConflict},
+		{"should not find a missing user", admin, http.MethodPut, "/v1/admin/users/99/role", `{"role_id":2}`, http.StatusNotFound},
+		{"should check the user id", admin, http.MethodPut, "/v1/admin/users/abc/role", `{"role_id":2}`, http.StatusBadRequest},
+
+		{"should forbid deactivating to moderators", moderator, http.MethodPost, "/v1/admin/users/2/deactivate", "", http.StatusForbidden},
+		{"should deactivate", admin, http.MethodPost, "/v1/admin/users/2/deactivate", "", http.StatusNoContent},
+		{"should not deactivate themselves", admin, http.MethodPost, "/v1/admin/users/1/deactivate", "", http.StatusConflict},
+		{"should not deactivate a missing user", admin, http.MethodPost, "/v1/admin/users/99/deactivate", "", http.StatusNotFound},
+		{"should reactivate", admin, http.MethodPost, "/v1/admin/users/2/reactivate", "", http.StatusNoContent},
+		{"should not reactivate a missing user", admin, http.MethodPost, "/v1/admin/users/99/reactivate", "", http.StatusNotFound},
+
+		{"should forbid password resets to moderators", moderator, http.MethodPost, "/v1/admin/users/2/password-reset", "", http.StatusForbidden},
+		{"should not reset a missing user", admin, http.MethodPost, "/v1/admin/users/99/password-reset", "", http.StatusNotFound},
+
+		{"should forbid deleting to moderators", moderator, http.MethodDelete, "/v1/admin/users/2", "", http.StatusForbidden},
+		{"should delete", admin, http.MethodDelete, "/v1/admin/users/2", "", http.StatusNoContent},
+		{"should not delete themselves", admin, http.MethodDelete, "/v1/admin/users/1", "", http.StatusConflict},
+		{"should not delete a missing user", admin, http.MethodDelete, "/v1/admin/users/99", "", http.StatusNotFound},
+
+		{"should forbid role management to moderators", moderator, http.MethodGet, "/v1/admin/roles", "", http.StatusForbidden},
+		{"should list roles", admin, http.MethodGet, "/v1/admin/roles", "", http.StatusOK},
+		{"should list permissions", admin, http.MethodGet, "/v1/admin/permissions", "", http.StatusOK},
+		{
+			"should create a role", admin, http.MethodPost, "/v1/admin/roles",
+			`{"name":"editor","level":2,"description":"edits posts","permissions":["posts:update:any"]}`,
+			http.StatusCreated,
+		},
+		{"should check a new role", admin, http.MethodPost, "/v1/admin/roles", `{"name":"editor"}`, http.StatusBadRequest},
+		{
+			"should refuse a duplicate role", admin, http.MethodPost, "/v1/admin/roles",
+			`{"name":"admin","level":3,"description":"again"}`,
+			http.StatusConflict,
+		},
+		{"should update a role", admin, http.MethodPut, "/v1/admin/roles/2", `{"level":2,"description":"moderates"}`, http.StatusOK},
+		{
+			"should set permissions", admin, http.MethodPut, "/v1/admin/roles/2/permissions",
+			`{"permissions":["comments:delete:any"]}`,
+			http.StatusNoContent,
+		},
+		{
+			"should refuse unknown permissions", admin, http.MethodPut, "/v1/admin/roles/2/permissions",
+			`{"permissions":["posts:burn"]}`,
+			http.StatusBadRequest,
+		},
+		{
+			"should not lock out the own role", admin, http.MethodPut, "/v1/admin/roles/3/permissions",
+			`{"permissions":["users:manage"]}`,
+			http.StatusConflict,
+		},
+		{
+			"should not find a missing role", admin, http.MethodPut, "/v1/admin/roles/99/permissions",
+			`{"permissions":[]}`,
+			http.StatusNotFound,
+		},
+		{"should not delete a role in use", admin, http.MethodDelete, "/v1/admin/roles/1", "", http.StatusConflict},
+		{"should delete a role", admin, http.MethodDelete, "/v1/admin/roles/2", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, _ := newMux(t, tt.roleID)
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, mux).Code, tt.want)
+		})
+	}
+	t.Run("should need a token", func(t *testing.T) {
+		mux, _ := newMux(t, admin)
+		req, err := http.NewRequest(http.MethodGet, "/v1/admin/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkStatus(t, executeRequest(t, req, mux).Code, http.StatusUnauthorized)
+	})
+	t.Run("should email a forced password reset", func(t *testing.T) {
+		mux, mail := newMux(t, admin)
+		req, err := http.NewRequest(http.MethodPost, "/v1/admin/users/2/password-reset", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		checkStatus(t, executeRequest(t, req, mux).Code, http.StatusNoContent)
+		if !slices.Equal(mail.to, []string{"target@example.com"}) {
+			t.Errorf("sent mail to %v", mail.to)
+		}
+	})
+}
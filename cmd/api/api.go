@@ -5,8 +5,13 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/rijojohn85/social/internal/blob"
 	"github.com/rijojohn85/social/internal/db/auth"
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/lockout"
 	"github.com/rijojohn85/social/internal/mailer"
+	"github.com/rijojohn85/social/internal/notifications"
+	"github.com/rijojohn85/social/internal/ratelimit"
 	"github.com/rijojohn85/social/internal/store/cache"
 	"go.uber.org/zap"
 
@@ -23,17 +28,87 @@ type application struct {
 	authenticator auth.Authenticator
 	logger        *zap.SugaredLogger
 	cacheStorage  cache.Storage
+	loginGuards   loginGuards
+	permissions   *permissionCache
+	rateLimiter   ratelimit.Limiter
+	notifications *notifications.Service
+	events        events.Broker
+	blobs         blob.Storage
 	config        config
 }
 
 type config struct {
-	mail     mailConfig
-	addr     string
-	env      string
-	apiURL   string
-	auth     authConfig
-	db       dbConfig
-	redisCfg redisConfig
+	mail      mailConfig
+	addr      string
+	env       string
+	apiURL    string
+	auth      authConfig
+	db        dbConfig
+	redisCfg  redisConfig
+	cleanup   cleanupConfig
+	lockout   lockoutConfig
+	rateLimit rateLimitConfig
+	timeline  timelineConfig
+	events    eventsConfig
+	media     mediaConfig
+	scheduler schedulerConfig
+	// how long a request may take, the event stream and uploads excepted
+	requestTimeout time.Duration
+	// how often roles and permissions are reloaded from the database
+	permissionsRefresh time.Duration
+}
+type rateLimitConfig struct {
+	enabled bool
+	// limits by route name, see defaultRateLimits
+	routes map[string]ratelimit.Limit
+}
+type timelineConfig struct {
+	// timelines are cached in redis, so this needs redis enabled
+	enabled bool
+	// posts kept per cached timeline
+	size int
+	// authors with more followers are pulled into timelines on read instead of
+	// being pushed to every follower on write
+	fanoutLimit int
+}
+type eventsConfig struct {
+	// comment sent on idle streams so proxies keep them open
+	heartbeat time.Duration
+	// events kept per user for resuming with Last-Event-ID, and how long
+	// after the last one
+	history    int
+	historyTTL time.Duration
+	// events a stream can fall behind before it is closed
+	buffer int
+}
+type mediaConfig struct {
+	// largest upload accepted, in bytes
+	maxSize int64
+	// thumbnails fit in a square of this many pixels
+	thumbnailSize int
+	// uploads not attached to a post are deleted after this long
+	unattachedTTL time.Duration
+	// "local" keeps blobs in dir, "s3" in the s3 bucket
+	storage string
+	dir     string
+	s3      blob.S3Config
+}
+type schedulerConfig struct {
+	// how often due scheduled posts are looked for
+	interval time.Duration
+	// posts published per query
+	batch int
+}
+type lockoutConfig struct {
+	email lockout.Config
+	ip    lockout.Config
+}
+type cleanupConfig struct {
+	interval time.Duration
+	// accounts not activated after this long are deleted, 0 keeps them
+	unactivatedTTL time.Duration
+	// accounts deleted by their user can be restored by logging in for this long
+	deletionGrace time.Duration
 }
 type redisConfig struct {
 	addr    string
@@ -46,17 +121,25 @@ type authConfig struct {
 	token tokenConfig
 }
 type tokenConfig struct {
-	secret string
-	aud    string
-	exp    time.Duration
+	secret     string
+	aud        string
+	exp        time.Duration
+	refreshExp time.Duration
+	keysDir    string
+	signingKID string
+	// lifetime of the challenge between password and second factor
+	mfaExp time.Duration
 }
 type basicAuthConfig struct {
 	user string
 	pass string
 }
 type mailConfig struct {
-	mailer mailTripConfig
-	exp    time.Duration
+	mailer         mailTripConfig
+	exp            time.Duration
+	resetExp       time.Duration
+	emailChangeExp time.Duration
+	resendCooldown time.Duration
 }
 type mailTripConfig struct {
 	url      string
@@ -78,51 +161,175 @@ func (app *application) mount() http.Handler {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	/*  Set a timeout value on the request context (ctx), that will signal
-		* through ctx.Done() that the request has timed out and further
-		* processing should be stopped.
-	* */
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(app.RateLimitMiddleware("global"))
+
+	// the event stream is long lived, it stays out of the timeout below
+	r.With(app.AuthTokenMiddleware, app.RateLimitMiddleware("user")).
+		Get("/v1/events", app.streamEventsHandler)
+	// uploads set a longer timeout of their own
+	r.With(app.AuthTokenMiddleware, app.RateLimitMiddleware("user"), app.RateLimitMiddleware("write")).
+		Post("/v1/media", app.uploadMediaHandler)
+
+	r.Group(func(r chi.Router) {
+		/*  Set a timeout value on the request context (ctx), that will signal
+			* through ctx.Done() that the request has timed out and further
+			* processing should be stopped.
+		* */
+		r.Use(middleware.Timeout(app.config.requestTimeout))
+
+		r.Get("/.well-known/jwks.json", app.jwksHandler)
+
+		r.Route("/v1", func(r chi.Router) {
+			r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckHandler)
+
+			docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
+			r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
+
+			r.Route("/users", func(r chi.Router) {
+				r.Route("/me", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.RateLimitMiddleware("user"))
+
+					r.Patch("/", app.updateProfileHandler)
+					r.Delete("/", app.deleteAccountHandler)
+					r.Put("/password", app.changePasswordHandler)
+					r.Post("/email", app.changeEmailHandler)
+					r.Get("/blocks", app.listBlockedHandler)
+					r.Get("/mutes", app.listMutedHandler)
+					r.Get("/drafts", app.listDraftsHandler)
+					r.Get("/follow-requests", app.listFollowRequestsHandler)
+					r.Put("/follow-requests/{userID}/approve", app.approveFollowRequestHandler)
+					r.Put("/follow-requests/{userID}/reject", app.rejectFollowRequestHandler)
+
+					r.Post("/mfa/totp", app.enrollTOTPHandler)
+					r.Post("/mfa/totp/verify", app.verifyTOTPHandler)
+					r.Delete("/mfa/totp", app.disableTOTPHandler)
+				})
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.RateLimitMiddleware("user"))
+
+					r.Get("/", app.getUserHandler)
+					r.Get("/followers", app.listFollowersHandler)
+					r.Get("/following", app.listFollowingHandler)
+					r.Get("/posts", app.listUserPostsHandler)
+					r.Put("/follow", app.followUserHandler)
+					r.Put("/unfollow", app.unfollowUserHandler)
+					r.Put("/block", app.blockUserHandler)
+					r.Put("/unblock", app.unblockUserHandler)
+					r.Put("/mute", app.muteUserHandler)
+					r.Put("/unmute", app.unmuteUserHandler)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(app.RateLimitMiddleware("auth"))
+					r.Put("/activate/{token}", app.activateUserHandler)
+					r.Post("/activate/resend", app.resendActivationHandler)
+					r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
+				})
 
-	r.Route("/v1", func(r chi.Router) {
-		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Use(app.RateLimitMiddleware("user"))
+					r.Get("/feed", app.getUserFeedHandler)
+				})
+			})
+
+			r.Route("/posts", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware("user"))
 
-		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
-		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
+				r.With(app.RateLimitMiddleware("write")).Post("/", app.createPostHandler)
+				r.Route(
+					"/{postID}", func(r chi.Router) {
+						r.Use(app.postContextMiddleware)
+						r.Get("/", app.getPostHandler)
+						r.Put("/reactions", app.setReactionHandler)
+						r.Delete("/reactions", app.deleteReactionHandler)
+						r.Get("/comments", app.listCommentsHandler)
+						r.With(app.RateLimitMiddleware("write")).Post("/comments", app.createCommentHandler)
+						r.Route("/comments/{commentID}", func(r chi.Router) {
+							r.Use(app.commentContextMiddleware)
+							r.Get("/thread", app.getCommentThreadHandler)
+							r.With(app.RequirePermission("comments:update:any", commentOwner)).
+								Patch("/", app.updateCommentHandler)
+							r.With(app.RequirePermission("comments:delete:any", commentOwner)).
+								Delete("/", app.deleteCommentHandler)
+						})
+						r.With(app.RequirePermission("posts:update:any", postOwner)).
+							Patch("/", app.patchPostHandler)
+						r.With(app.RequirePermission("posts:delete:any", postOwner)).
+							Delete("/", app.deletePostHandler)
+					})
+			})
 
-		r.Route("/users", func(r chi.Router) {
-			r.Route("/{userID}", func(r chi.Router) {
+			r.Route("/media", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware("user"))
 
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Get("/{mediaID}", app.getMediaHandler)
+				r.Get("/{mediaID}/thumbnail", app.getMediaThumbnailHandler)
 			})
-			r.Put("/activate/{token}", app.activateUserHandler)
 
-			r.Group(func(r chi.Router) {
+			r.Route("/tags", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.Use(app.RateLimitMiddleware("user"))
+
+				r.Get("/trending", app.trendingTagsHandler)
+				r.Get("/{tag}/posts", app.listTagPostsHandler)
 			})
-		})
 
-		r.Route("/posts", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
-
-			r.Post("/", app.createPostHandler)
-			r.Route(
-				"/{postID}", func(r chi.Router) {
-					r.Use(app.postContextMiddleware)
-					r.Get("/", app.getPostHandler)
-					r.Post("/comments", app.createCommentHandler)
-					r.With(app.CheckPostOwernship).Patch("/", app.patchPostHandler)
-					r.With(app.CheckPostOwernship).Delete("/", app.deletePostHandler)
+			r.Route("/notifications", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware("user"))
+
+				r.Get("/", app.listNotificationsHandler)
+				r.Get("/unread-count", app.unreadNotificationsHandler)
+				r.Put("/read", app.markAllNotificationsReadHandler)
+				r.Put("/{notificationID}/read", app.markNotificationReadHandler)
+				r.Get("/preferences", app.getNotificationPreferencesHandler)
+				r.Put("/preferences", app.setNotificationPreferencesHandler)
+			})
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.RateLimitMiddleware("user"))
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequirePermission("lockouts:manage", nil))
+					r.Get("/lockouts", app.listLockoutsHandler)
+					r.Delete("/lockouts/{lockoutID}", app.unlockLockoutHandler)
 				})
-		})
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequirePermission(manageRolesPermission, nil))
+					r.Get("/permissions", app.listPermissionsHandler)
+					r.Get("/roles", app.listRolesHandler)
+					r.Post("/roles", app.createRoleHandler)
+					r.Put("/roles/{roleID}", app.updateRoleHandler)
+					r.Put("/roles/{roleID}/permissions", app.setRolePermissionsHandler)
+					r.Delete("/roles/{roleID}", app.deleteRoleHandler)
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(app.RequirePermission(manageUsersPermission, nil))
+					r.Get("/users", app.listUsersHandler)
+					r.Put("/users/{userID}/role", app.setUserRoleHandler)
+					r.Post("/users/{userID}/deactivate", app.deactivateUserHandler)
+					r.Post("/users/{userID}/reactivate", app.reactivateUserHandler)
+					r.Post("/users/{userID}/password-reset", app.forcePasswordResetHandler)
+					r.Delete("/users/{userID}", app.deleteUserHandler)
+				})
+			})
 
-		r.Route("/authentication", func(r chi.Router) {
-			r.Post("/users", app.registerUser)
-			r.Post("/token", app.createTokenHandler)
+			r.Route("/authentication", func(r chi.Router) {
+				r.Use(app.RateLimitMiddleware("auth"))
+
+				r.Post("/users", app.registerUser)
+				r.Post("/token", app.createTokenHandler)
+				r.Post("/token/mfa", app.createMFATokenHandler)
+				r.Post("/refresh", app.refreshTokenHandler)
+				r.With(app.AuthTokenMiddleware).Post("/logout", app.logoutHandler)
+				r.Post("/password/forgot", app.forgotPasswordHandler)
+				r.Post("/password/reset", app.resetPasswordHandler)
+			})
 		})
 	})
 
@@ -133,6 +340,7 @@ func (app *application) run(mux http.Handler) error {
 	// Docs
 	docs.SwaggerInfo.Version = version
 	docs.SwaggerInfo.Host = app.config.apiURL
+	// the event stream lifts the write timeout for its own response
 	srv := http.Server{
 		Addr:    app.config.addr,
 		Handler: mux, WriteTimeout: time.Second * 30,
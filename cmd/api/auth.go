@@ -1,8 +1,7 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -20,12 +19,20 @@ type AuthPayload struct {
 	Username string `json:"username" valid:"required,max=20"`
 	Password string `json:"password" valid:"required,max=72,min=3"`
 	Email    string `json:"email" valid:"required,email,max=255"`
-	RoleID   int64  `json:"role_id" valid:"required, gte=1"`
 }
 type CreateTokenUserPayload struct {
 	Email    string `json:"email" valid:"required,email,max=255"`
 	Password string `json:"password" valid:"required,max=72,min=3"`
 }
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
 
 // RegisterUser godoc
 //
@@ -54,25 +61,28 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// new accounts always start with the default role, admins can change it
+	role, err := app.store.Roles.GetIDByName(r.Context(), defaultRoleName)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 	user := &store.User{
 		Username: payload.Username,
 		Email:    payload.Email,
-		RoleID:   payload.RoleID,
+		RoleID:   role.RoleID,
 	}
 	err = user.Password.Set(payload.Password)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	// store the user
+	// store the user, the token is only stored hashed
 	plainToken := uuid.New().String()
-	// encrpyt token
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
 	err = app.store.Users.CreateAndInvite(
 		r.Context(),
 		user,
-		hashToken,
+		plainToken,
 		app.config.mail.exp,
 	)
 	if err != nil {
@@ -86,6 +96,24 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	err = app.sendActivationEmail(user, plainToken)
+	if err != nil {
+		app.logger.Errorw("Error sending mail", "error", err)
+		// rollback user creation if email fails (SAGA Pattern)
+		if err := app.store.Users.Delete(r.Context(), user.ID); err != nil {
+			app.logger.Errorw("Deleting user failed", "error", err)
+		}
+
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, plainToken); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) sendActivationEmail(user *store.User, plainToken string) error {
 	domain := env.GetString("DOMAIN", "http://localhost:8080")
 	activationURL := fmt.Sprintf("%s/v1/users/activate/%s", domain, plainToken)
 	isProdEnv := app.config.env == "production"
@@ -96,40 +124,28 @@ func (app *application) registerUser(w http.ResponseWriter, r *http.Request) {
 		Username:      user.Username,
 		ActivationURL: activationURL,
 	}
-	err = app.mailer.Send(
+	return app.mailer.Send(
 		mailer.UserWelcomeTemplate,
 		user.Username,
 		user.Email,
 		vars,
 		!isProdEnv,
 	)
-	if err != nil {
-		app.logger.Errorw("Error sending mail", "error", err)
-		// rollback user creation if email fails (SAGA Pattern)
-		if err := app.store.Users.Delete(r.Context(), user.ID); err != nil {
-			app.logger.Errorw("Deleting user failed", "error", err)
-		}
-
-		app.internalServerError(w, r, err)
-		return
-	}
-	if err := app.jsonResponse(w, http.StatusCreated, plainToken); err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
 }
 
 // Create Token godoc
 //
 //	@Summary		CreateToken
-//	@Description	Create token
+//	@Description	Create an access token and a refresh token for a new session
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateTokenUserPayload	true	"CreateUserToken payload"
-//	@Success		200		{object}	string					"Token"
+//	@Success		201		{object}	TokenResponse			"Tokens"
+//	@Success		200		{object}	MFAChallengeResponse	"Second factor required"
 //	@Failure		400		{object}	error
 //	@Failure		404		{object}	error
+//	@Failure		429		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/authentication/token [POST]
@@ -145,23 +161,183 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	err = Validate.Struct(payload)
 	if err != nil {
 		app.badRequestError(w, r, err)
+		return
+	}
+	// refuse guesses while the email or the client is backing off
+	ip := clientIP(r)
+	if wait := app.loginBlockedFor(r.Context(), payload.Email, ip); wait > 0 {
+		app.rateLimitExceededResponse(w, r, wait)
+		return
 	}
 	// fetch the user (check if the user exists) from payload
 	user, err := app.store.Users.GetUserByEmail(r.Context(), payload.Email)
 	if err != nil {
+		app.loginFailed(r.Context(), payload.Email, ip)
 		app.unauthorizedError(w, r, err)
 		return
 	}
 	// check credentials
 	err = bcrypt.CompareHashAndPassword(user.Password.Hash, []byte(payload.Password))
 	if err != nil {
+		app.loginFailed(r.Context(), payload.Email, ip)
+		app.unauthorizedError(w, r, errors.New("invalid credentials"))
+		return
+	}
+	if user.DeactivatedAt != nil {
+		app.unauthorizedError(w, r, errAccountDeactivated)
+		return
+	}
+	if app.deletedForGood(user) {
 		app.unauthorizedError(w, r, errors.New("invalid credentials"))
 		return
 	}
 
+	// with 2FA on the password only earns a challenge for the second factor,
+	// the failures of the email are kept until that is passed too
+	totp, err := app.store.MFA.GetTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, store.ErrorNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if totp != nil && totp.Confirmed {
+		app.mfaChallengeResponse(w, r, user.ID)
+		return
+	}
+	app.loginSucceeded(r.Context(), payload.Email)
+	if err := app.restoreDeleted(r.Context(), user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.startSession(w, r, user.ID)
+}
+
+// deletedForGood tells if the user deleted their account and the grace period
+// to take that back is over.
+func (app *application) deletedForGood(user *store.User) bool {
+	return user.DeletedAt != nil && time.Since(*user.DeletedAt) > app.config.cleanup.deletionGrace
+}
+
+// restoreDeleted takes back the deletion of an account that logged in during
+// the grace period. It runs once the login is complete, second factor
+// included.
+func (app *application) restoreDeleted(ctx context.Context, user *store.User) error {
+	if user.DeletedAt == nil {
+		return nil
+	}
+	if err := app.store.Users.Restore(ctx, user.ID); err != nil {
+		return err
+	}
+	app.forgetUser(ctx, user.ID)
+	return nil
+}
+
+// startSession logs the user in, the refresh token is only stored hashed.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, userID int64) {
+	refreshToken := uuid.New().String()
+	session, err := app.store.Sessions.Create(
+		r.Context(),
+		userID,
+		refreshToken,
+		app.config.auth.token.refreshExp,
+	)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	tokens, err := app.newTokenResponse(session, refreshToken)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	// send to client
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Refresh Token godoc
+//
+//	@Summary		RefreshToken
+//	@Description	Rotate a refresh token and issue a new access token. Reusing an old refresh token revokes the session
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token payload"
+//	@Success		200		{object}	TokenResponse		"Tokens"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/refresh [POST]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	err := readJson(w, r, &payload)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	err = Validate.Struct(payload)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	refreshToken := uuid.New().String()
+	session, err := app.store.Sessions.Rotate(
+		r.Context(),
+		payload.RefreshToken,
+		refreshToken,
+		app.config.auth.token.refreshExp,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrTokenReused):
+			app.logger.Warnw("refresh token reused, session revoked", "path", r.URL.Path)
+			app.unauthorizedError(w, r, err)
+		case errors.Is(err, store.ErrInvalidToken),
+			errors.Is(err, store.ErrTokenExpired),
+			errors.Is(err, store.ErrSessionRevoked):
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	tokens, err := app.newTokenResponse(session, refreshToken)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Logout godoc
+//
+//	@Summary		Logout
+//	@Description	Revoke the session of the access token, its refresh tokens stop working
+//	@Tags			auth
+//	@Produce		json
+//	@Success		204	{string}	string	"Logged out"
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout [POST]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Context().Value(sessionCtxKey).(string)
+	if err := app.store.Sessions.Revoke(r.Context(), sessionID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) newTokenResponse(session *store.Session, refreshToken string) (*TokenResponse, error) {
 	// generate token -> add claims
 	claim := jwt.MapClaims{
-		"sub": user.ID,
+		"sub": session.UserID,
+		"sid": session.ID,
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
 		"iat": time.Now().Unix(),
 		"nbf": time.Now().Unix(),
@@ -170,12 +346,12 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	}
 	token, err := app.authenticator.GenerateToken(claim)
 	if err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
-	// send to client
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
-		app.internalServerError(w, r, err)
-		return
+		return nil, err
 	}
+	return &TokenResponse{
+		AccessToken:  token,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
 }
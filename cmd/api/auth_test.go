@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/db/auth"
+	"github.com/rijojohn85/social/internal/store"
+	"github.com/rijojohn85/social/internal/store/cache"
+)
+
+func TestCreateTokenLockout(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	login := func() *httptest.ResponseRecorder {
+		req, err := http.NewRequest(
+			http.MethodPost,
+			"/v1/authentication/token",
+			strings.NewReader(`{"email":"gopher@example.com","password":"wrong"}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(t, req, mux)
+	}
+	t.Run("should allow the free attempts", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			checkStatus(t, login().Code, http.StatusUnauthorized)
+		}
+	})
+	t.Run("should back off after the free attempts", func(t *testing.T) {
+		checkStatus(t, login().Code, http.StatusUnauthorized)
+		w := login()
+		checkStatus(t, w.Code, http.StatusTooManyRequests)
+		if got := w.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("got Retry-After %q, wanted 60", got)
+		}
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	t.Run("should reject a missing refresh token", func(t *testing.T) {
+		req, err := http.NewRequest(
+			http.MethodPost,
+			"/v1/authentication/refresh",
+			strings.NewReader(`{}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusBadRequest)
+	})
+	t.Run("should rotate a refresh token", func(t *testing.T) {
+		req, err := http.NewRequest(
+			http.MethodPost,
+			"/v1/authentication/refresh",
+			strings.NewReader(`{"refresh_token":"old-token"}`),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusOK)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	t.Run("should not allow unauthenticated request", func(t *testing.T) {
+		req, err := http.NewRequest(
+			http.MethodPost,
+			"/v1/authentication/logout",
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusUnauthorized)
+	})
+	t.Run("should revoke the session", func(t *testing.T) {
+		req, err := http.NewRequest(
+			http.MethodPost,
+			"/v1/authentication/logout",
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(
+			"Authorization",
+			"Bearer "+testToken,
+		)
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusNoContent)
+	})
+}
+
+// failingSessions fails every session lookup with err.
+type failingSessions struct {
+	store.MockSessionStore
+	err error
+}
+
+func (m *failingSessions) Get(ctx context.Context, id string) (*store.Session, error) {
+	return nil, m.err
+}
+
+func TestAuthTokenSession(t *testing.T) {
+	now := time.Now()
+	testToken, _ := NewTestApplication(t).authenticator.GenerateToken(nil)
+	tests := []struct {
+		name string
+		err  error
+		user *store.User
+		want int
+	}{
+		{"should refuse a missing session", store.ErrorNotFound, nil, http.StatusUnauthorized},
+		{"should refuse a revoked session", store.ErrSessionRevoked, nil, http.StatusUnauthorized},
+		{"should fail on database errors", errors.New("connection refused"), nil, http.StatusInternalServerError},
+		{"should fail on timeouts", context.DeadlineExceeded, nil, http.StatusInternalServerError},
+		{
+			"should refuse a deactivated account", nil,
+			&store.User{ID: 1, DeactivatedAt: &now},
+			http.StatusUnauthorized,
+		},
+		{
+			"should refuse a deleted account", nil,
+			&store.User{ID: 1, DeletedAt: &now},
+			http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(t)
+			if tt.err != nil {
+				app.store.Sessions = &failingSessions{err: tt.err}
+			}
+			if tt.user != nil {
+				app.store.Users = &mfaUserStore{user: *tt.user}
+				app.cacheStorage.Users = &uncachedUsers{}
+			}
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/me/blocks", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, app.mount()).Code, tt.want)
+		})
+	}
+}
+
+// mfaUserStore has a single user, found by any email or id.
+type mfaUserStore struct {
+	store.MockUserStore
+	user     store.User
+	restored bool
+}
+
+func (m *mfaUserStore) Restore(ctx context.Context, userID int64) error {
+	m.restored = true
+	return nil
+}
+
+func (m *mfaUserStore) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	user := m.user
+	return &user, nil
+}
+
+func (m *mfaUserStore) GetUser(ctx context.Context, user *store.User, id int64) error {
+	*user = m.user
+	return nil
+}
+
+// confirmedTOTPStore has 2FA turned on for every user, with no recovery codes
+// left.
+type confirmedTOTPStore struct {
+	store.MockMFAStore
+	secret string
+}
+
+func (m *confirmedTOTPStore) GetTOTP(ctx context.Context, userID int64) (*store.TOTP, error) {
+	return &store.TOTP{UserID: userID, Secret: m.secret, Confirmed: true}, nil
+}
+
+func (m *confirmedTOTPStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	return store.ErrInvalidToken
+}
+
+// uncachedUsers never has a user cached.
+type uncachedUsers struct {
+	cache.MockUserCache
+}
+
+func (m *uncachedUsers) Get(context.Context, *store.User, int64) error {
+	return errors.New("not cached")
+}
+
+func TestMFALockout(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.auth.token = tokenConfig{aud: "test-aud", mfaExp: time.Minute}
+	app.authenticator = auth.NewJWTAuthenticator("secret", "test-aud", "test-aud")
+	user := store.User{ID: 1, Email: "gopher@example.com", IsActive: true}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+	app.store.Users = &mfaUserStore{user: user}
+	app.store.MFA = &confirmedTOTPStore{}
+	app.cacheStorage.Users = &uncachedUsers{}
+	mux := app.mount()
+
+	// every request comes from another address so only the email is counted
+	request := func(i int, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		return executeRequest(t, req, mux)
+	}
+	t.Run("should lock out bad codes despite correct passwords between them", func(t *testing.T) {
+		for i := 0; i <= int(testLockoutConfig.FreeAttempts)+1; i++ {
+			w := request(2*i, "/v1/authentication/token", `{"email":"gopher@example.com","password":"password"}`)
+			if w.Code == http.StatusTooManyRequests {
+				return
+			}
+			checkStatus(t, w.Code, http.StatusOK)
+			var resp struct {
+				Data MFAChallengeResponse `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			// seven digits never match a code
+			body := fmt.Sprintf(`{"mfa_token":%q,"code":"1234567"}`, resp.Data.MFAToken)
+			checkStatus(t, request(2*i+1, "/v1/authentication/token/mfa", body).Code, http.StatusUnauthorized)
+		}
+		t.Error("got no lockout")
+	})
+}
+
+func TestMFARestoresDeletedAccount(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.auth.token = tokenConfig{aud: "test-aud", mfaExp: time.Minute}
+	app.config.cleanup.deletionGrace = time.Hour
+	app.authenticator = auth.NewJWTAuthenticator("secret", "test-aud", "test-aud")
+	deletedAt := time.Now().Add(-time.Minute)
+	user := store.User{ID: 1, Email: "gopher@example.com", IsActive: true, DeletedAt: &deletedAt}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &mfaUserStore{user: user}
+	app.store.Users = users
+	app.store.MFA = &confirmedTOTPStore{secret: secret}
+	app.cacheStorage.Users = &uncachedUsers{}
+	mux := app.mount()
+
+	request := func(path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(t, req, mux)
+	}
+	w := request("/v1/authentication/token", `{"email":"gopher@example.com","password":"password"}`)
+	checkStatus(t, w.Code, http.StatusOK)
+	var resp struct {
+		Data MFAChallengeResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("should not restore with the password alone", func(t *testing.T) {
+		body := fmt.Sprintf(`{"mfa_token":%q,"code":"1234567"}`, resp.Data.MFAToken)
+		checkStatus(t, request("/v1/authentication/token/mfa", body).Code, http.StatusUnauthorized)
+		if users.restored {
+			t.Error("got the account restored before the second factor")
+		}
+	})
+	t.Run("should restore after the second factor", func(t *testing.T) {
+		code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := fmt.Sprintf(`{"mfa_token":%q,"code":%q}`, resp.Data.MFAToken, code)
+		checkStatus(t, request("/v1/authentication/token/mfa", body).Code, http.StatusCreated)
+		if !users.restored {
+			t.Error("got the account still deleted")
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// ListedUsersPage is a page of a block or mute list, next_cursor is empty on
+// the last page.
+type ListedUsersPage struct {
+	Users      []store.ListedUser `json:"users"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+// BlockUser godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Blocks a user and removes the follows between both users. Blocked users can't follow, comment on or react to the posts of the user, and their posts and comments are hidden both ways
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User blocked"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [PUT]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeList(w, r, app.store.Blocks.Block, true)
+}
+
+// UnblockUser godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Takes a user off the block list. Follows removed by the block are not restored
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unblocked"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"User not blocked"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/unblock [PUT]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeList(w, r, app.store.Blocks.Unblock, true)
+}
+
+// MuteUser godoc
+//
+//	@Summary		Mutes a user
+//	@Description	Hides the posts of a user from the feed without unfollowing them
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User muted"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/mute [PUT]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeList(w, r, app.store.Blocks.Mute, false)
+}
+
+// UnmuteUser godoc
+//
+//	@Summary		Unmutes a user
+//	@Description	Shows the posts of a muted user in the feed again
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unmuted"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"User not muted"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/unmute [PUT]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeList(w, r, app.store.Blocks.Unmute, false)
+}
+
+// changeList puts the user in the path on or takes them off a list of the
+// current user. Blocks change what both users see, mutes only the current user.
+func (app *application) changeList(
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(ctx context.Context, userID, listedID int64) error,
+	both bool,
+) {
+	listedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if listedID == user.ID {
+		app.badRequestError(w, r, errors.New("can't block or mute yourself"))
+		return
+	}
+	if err := change(r.Context(), user.ID, listedID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.forgetTimeline(r.Context(), user.ID)
+	if both {
+		app.forgetTimeline(r.Context(), listedID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBlocked godoc
+//
+//	@Summary		Lists blocked users
+//	@Description	Lists the users the current user blocked, the latest block first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	ListedUsersPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [GET]
+func (app *application) listBlockedHandler(w http.ResponseWriter, r *http.Request) {
+	app.listListed(w, r, app.store.Blocks.ListBlocked)
+}
+
+// ListMuted godoc
+//
+//	@Summary		Lists muted users
+//	@Description	Lists the users the current user muted, the latest mute first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	ListedUsersPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mutes [GET]
+func (app *application) listMutedHandler(w http.ResponseWriter, r *http.Request) {
+	app.listListed(w, r, app.store.Blocks.ListMuted)
+}
+
+func (app *application) listListed(
+	w http.ResponseWriter,
+	r *http.Request,
+	list func(ctx context.Context, userID int64, q store.PaginatedFollowQuery) ([]store.ListedUser, error),
+) {
+	q := store.PaginatedFollowQuery{Limit: 20}
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	users, err := list(r.Context(), user.ID, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	page := ListedUsersPage{Users: users}
+	if len(users) == q.Limit {
+		last := users[len(users)-1]
+		page.NextCursor = store.Cursor{CreatedAt: last.ListedAt, ID: last.ID}.Encode()
+	}
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// checkNotBlocked writes a forbidden response and returns false when either
+// user blocked the other.
+func (app *application) checkNotBlocked(w http.ResponseWriter, r *http.Request, userID, otherID int64) bool {
+	if userID == otherID {
+		return true
+	}
+	blocked, err := app.store.Blocks.IsBlocked(r.Context(), userID, otherID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return false
+	}
+	if blocked {
+		app.forbiddenError(w, r, store.ErrBlocked)
+		return false
+	}
+	return true
+}
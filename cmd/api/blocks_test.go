@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBlocksAndMutes(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		// the mock store signs everybody in as user 0
+		{"should not block yourself", http.MethodPut, "/v1/users/0/block", http.StatusBadRequest},
+		{"should block a user", http.MethodPut, "/v1/users/1/block", http.StatusNoContent},
+		{"should not unblock a user that is not blocked", http.MethodPut, "/v1/users/1/unblock", http.StatusNotFound},
+		{"should not mute yourself", http.MethodPut, "/v1/users/0/mute", http.StatusBadRequest},
+		{"should mute a user", http.MethodPut, "/v1/users/1/mute", http.StatusNoContent},
+		{"should not unmute a user that is not muted", http.MethodPut, "/v1/users/1/unmute", http.StatusNotFound},
+		{"should list blocked users", http.MethodGet, "/v1/users/me/blocks", http.StatusOK},
+		{"should list muted users", http.MethodGet, "/v1/users/me/mutes", http.StatusOK},
+		{"should check the list limit", http.MethodGet, "/v1/users/me/mutes?limit=0", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, mux).Code, tt.want)
+		})
+	}
+}
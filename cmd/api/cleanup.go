@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// cleanupInvitations purges expired invitations, accounts deleted by their
+// users after the grace period, uploads not attached to a post and, when
+// configured, accounts that were never activated. It runs until ctx is done.
+func (app *application) cleanupInvitations(ctx context.Context) {
+	ticker := time.NewTicker(app.config.cleanup.interval)
+	defer ticker.Stop()
+	for {
+		app.runInvitationCleanup(ctx)
+		app.purgeDeletedAccounts(ctx)
+		app.purgeUnattachedMedia(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) runInvitationCleanup(ctx context.Context) {
+	count, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		app.logger.Errorw("Deleting expired invitations failed", "error", err)
+	} else if count > 0 {
+		app.logger.Infow("Deleted expired invitations", "count", count)
+	}
+	if app.config.cleanup.unactivatedTTL == 0 {
+		return
+	}
+	count, err = app.store.Users.DeleteUnactivated(ctx, app.config.cleanup.unactivatedTTL)
+	if err != nil {
+		app.logger.Errorw("Deleting unactivated users failed", "error", err)
+	} else if count > 0 {
+		app.logger.Infow("Deleted unactivated users", "count", count)
+	}
+}
+
+func (app *application) purgeDeletedAccounts(ctx context.Context) {
+	count, err := app.store.Users.PurgeDeleted(ctx, app.config.cleanup.deletionGrace)
+	if err != nil {
+		app.logger.Errorw("Purging deleted users failed", "error", err)
+	} else if count > 0 {
+		app.logger.Infow("Purged deleted users", "count", count)
+	}
+}
@@ -1,20 +1,36 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/events"
 	"github.com/rijojohn85/social/internal/store"
 )
 
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
 type CreateCommentPayload struct {
 	Content string `json:"content" validate:"required,max=255"`
+	// the comment replied to, empty for top level comments
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gte=1"`
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=255"`
 }
 
 // CreateComment godoc
 //
 //	@Summary		Creates comment
-//	@Description	Creates a comment with payload for a particular post
+//	@Description	Creates a comment with payload for a particular post, or a reply to one of its comments
 //	@Tags			comments
 //	@Accept			json
 //	@Produce		json
@@ -22,10 +38,11 @@ type CreateCommentPayload struct {
 //	@Param			payload	body		CreateCommentPayload	true	"Comment payload"
 //	@Success		200		{object}	store.Comment
 //	@Failure		400		{object}	error
+//	@Failure		403		{object}	error	"Blocked by or blocking the author"
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
-//	@Router			/posts/{pathID}/comments [post]
+//	@Router			/posts/{postID}/comments [post]
 func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	var payload CreateCommentPayload
 	err := readJson(w, r, &payload)
@@ -43,19 +60,289 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		app.badRequestError(w, r, fmt.Errorf("no post found in context"))
 		return
 	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if !app.checkNotBlocked(w, r, user.ID, post.UserID) {
+		return
+	}
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(r.Context(), *payload.ParentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.badRequestError(w, r, store.ErrParentNotFound)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if parent.PostID != post.ID {
+			app.badRequestError(w, r, store.ErrParentNotFound)
+			return
+		}
+		if !app.checkNotBlocked(w, r, user.ID, parent.UserId) {
+			return
+		}
+	}
 	comment := &store.Comment{
-		// to be updated after auth
-		UserId:  1,
-		Content: payload.Content,
-		PostID:  post.ID,
+		UserId:   user.ID,
+		Content:  payload.Content,
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		User:     store.User{ID: user.ID, Username: user.Username},
 	}
 	err = app.store.Comments.Create(r.Context(), comment)
 	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrParentNotFound), errors.Is(err, store.ErrMaxDepth):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	go app.notifyComment(*comment, post.UserID)
+	go app.mentionInComment(*comment)
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// notifyComment tells the authors of the post and of the comment replied to
+// about a new comment and pushes it to their streams. It runs after the
+// request is done.
+func (app *application) notifyComment(comment store.Comment, postAuthorID int64) {
+	var parentAuthorID int64
+	if comment.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(context.Background(), *comment.ParentID)
+		if err != nil {
+			app.logger.Errorw("Error reading replied comment", "error", err, "comment", *comment.ParentID)
+		} else {
+			parentAuthorID = parent.UserId
+		}
+	}
+	app.notifications.Comment(comment, postAuthorID, parentAuthorID)
+
+	var userIDs []int64
+	for _, userID := range []int64{postAuthorID, parentAuthorID} {
+		if userID != 0 && userID != comment.UserId && !slices.Contains(userIDs, userID) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	app.publish(events.TypeComment, comment, userIDs...)
+}
+
+// CommentsPage is a page of comments, next_cursor is empty on the last page.
+type CommentsPage struct {
+	Comments   []store.Comment `json:"comments"`
+	NextCursor string          `json:"next_cursor"`
+}
+
+// ListComments godoc
+//
+//	@Summary		Lists comments
+//	@Description	Lists the comments of a post in thread order, newest threads first with replies below their parent.
+//	@Description	Pass next_cursor as cursor to get the next page
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID	path		int		true	"postID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	CommentsPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.PaginatedCommentQuery{
+		Limit: 20,
+	}
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	post := getPostFromContext(r)
+	viewer := r.Context().Value(userCtxKey).(*store.User)
+	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID, viewer.ID, cq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, newCommentsPage(comments, cq.Limit)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func newCommentsPage(comments []store.Comment, limit int) CommentsPage {
+	page := CommentsPage{Comments: comments}
+	if len(comments) == limit {
+		last := comments[len(comments)-1]
+		page.NextCursor = store.ThreadCursor{Path: last.Path}.Encode()
+	}
+	return page
+}
+
+// GetCommentThread godoc
+//
+//	@Summary		Gets a comment thread
+//	@Description	Gets a comment followed by all its replies in thread order
+//	@Tags			comments
+//	@Produce		json
+//	@Param			postID		path		int		true	"postID"
+//	@Param			commentID	path		int		true	"commentID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			cursor		query		string	false	"Cursor"
+//	@Success		200			{object}	CommentsPage
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/thread [get]
+func (app *application) getCommentThreadHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.PaginatedCommentQuery{
+		Limit: 20,
+	}
+	cq, err := cq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	viewer := r.Context().Value(userCtxKey).(*store.User)
+	comments, err := app.store.Comments.GetThread(r.Context(), getCommentFromContext(r), viewer.ID, cq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, newCommentsPage(comments, cq.Limit)); err != nil {
 		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateComment godoc
+//
+//	@Summary		Updates comment
+//	@Description	Updates a comment, moderators can update the comments of others
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int						true	"postID"
+//	@Param			commentID	path		int						true	"commentID"
+//	@Param			payload		body		UpdateCommentPayload	true	"Comment payload"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateCommentPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	comment := getCommentFromContext(r)
+	comment.Content = payload.Content
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
 		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteComment godoc
+//
+//	@Summary		Deletes comment
+//	@Description	Deletes a comment, moderators can delete the comments of others.
+//	@Description	A comment with replies is kept as a "[deleted]" tombstone
+//	@Tags			comments
+//	@Param			postID		path	int	true	"postID"
+//	@Param			commentID	path	int	true	"commentID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentContextMiddleware loads the comment of the route, it has to belong to
+// the post in the context.
+func (app *application) commentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		comment, err := app.store.Comments.GetByID(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if comment.PostID != getPostFromContext(r).ID {
+			app.notFoundError(w, r, store.ErrorNotFound)
+			return
+		}
+		ctx := context.WithValue(r.Context(), commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
+
+func commentOwner(r *http.Request) int64 {
+	return getCommentFromContext(r).UserId
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// ownedComments has comment 1 of user 1 on post 1, comment 2 on post 2, the
+// tombstone 3 on post 1 and comment 4 of user 3 on post 1.
+type ownedComments struct {
+	store.MockCommentStore
+}
+
+func (m *ownedComments) GetByID(ctx context.Context, id int64) (*store.Comment, error) {
+	switch id {
+	case 1:
+		return &store.Comment{ID: id, PostID: 1, UserId: 1, Content: "nice"}, nil
+	case 2:
+		return &store.Comment{ID: id, PostID: 2, UserId: 1, Content: "nice"}, nil
+	case 3:
+		return &store.Comment{ID: id, PostID: 1, UserId: 1, Deleted: true}, nil
+	case 4:
+		return &store.Comment{ID: id, PostID: 1, UserId: 3, Content: "hi"}, nil
+	}
+	return nil, store.ErrorNotFound
+}
+
+func (m *ownedComments) Update(ctx context.Context, comment *store.Comment) error {
+	if comment.Deleted {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+func (m *ownedComments) Delete(ctx context.Context, id int64) error {
+	if id == 3 {
+		return store.ErrorNotFound
+	}
+	return nil
+}
+
+func TestUpdateDeleteComment(t *testing.T) {
+	var (
+		author    = store.User{ID: 1, RoleID: 1}
+		stranger  = store.User{ID: 2, RoleID: 1}
+		moderator = store.User{ID: 3, RoleID: 2}
+	)
+	testToken, _ := NewTestApplication(t).authenticator.GenerateToken(nil)
+	tests := []struct {
+		name   string
+		user   store.User
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"should let the author edit", author, http.MethodPatch, "/v1/posts/1/comments/1", `{"content":"nicer"}`, http.StatusOK},
+		{"should forbid others to edit", stranger, http.MethodPatch, "/v1/posts/1/comments/1", `{"content":"mine"}`, http.StatusForbidden},
+		{"should let moderators edit", moderator, http.MethodPatch, "/v1/posts/1/comments/1", `{"content":"[removed]"}`, http.StatusOK},
+		{"should need content", author, http.MethodPatch, "/v1/posts/1/comments/1", `{"content":""}`, http.StatusBadRequest},
+		{
+			"should refuse long content", author, http.MethodPatch, "/v1/posts/1/comments/1",
+			`{"content":"` + strings.Repeat("a", 256) + `"}`,
+			http.StatusBadRequest,
+		},
+		{"should not edit a tombstone", author, http.MethodPatch, "/v1/posts/1/comments/3", `{"content":"back"}`, http.StatusNotFound},
+		{"should not edit a missing comment", author, http.MethodPatch, "/v1/posts/1/comments/99", `{"content":"hi"}`, http.StatusNotFound},
+		{"should not edit through another post", author, http.MethodPatch, "/v1/posts/1/comments/2", `{"content":"hi"}`, http.StatusNotFound},
+		{"should check the comment id", author, http.MethodPatch, "/v1/posts/1/comments/abc", `{"content":"hi"}`, http.StatusBadRequest},
+
+		{"should let the author delete", author, http.MethodDelete, "/v1/posts/1/comments/1", "", http.StatusNoContent},
+		{"should forbid others to delete", stranger, http.MethodDelete, "/v1/posts/1/comments/1", "", http.StatusForbidden},
+		{"should let moderators delete", moderator, http.MethodDelete, "/v1/posts/1/comments/1", "", http.StatusNoContent},
+		{"should not delete a tombstone", author, http.MethodDelete, "/v1/posts/1/comments/3", "", http.StatusNotFound},
+		{"should not delete a missing comment", author, http.MethodDelete, "/v1/posts/1/comments/99", "", http.StatusNotFound},
+		{"should not delete through another post", author, http.MethodDelete, "/v1/posts/1/comments/2", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(t)
+			app.store.Users = &mfaUserStore{user: tt.user}
+			app.store.Comments = &ownedComments{}
+			app.cacheStorage.Users = &uncachedUsers{}
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, app.mount()).Code, tt.want)
+		})
+	}
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		t.Run("should need a token to "+method, func(t *testing.T) {
+			app := NewTestApplication(t)
+			req, err := http.NewRequest(method, "/v1/posts/1/comments/1", strings.NewReader(`{"content":"hi"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, executeRequest(t, req, app.mount()).Code, http.StatusUnauthorized)
+		})
+	}
+}
+
+// blockedUser has user 3 blocking or blocked by everybody else.
+type blockedUser struct {
+	store.MockBlockStore
+}
+
+func (m *blockedUser) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	return userID == 3 || otherID == 3, nil
+}
+
+func TestReplyComment(t *testing.T) {
+	testToken, _ := NewTestApplication(t).authenticator.GenerateToken(nil)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"should reply to a comment", `{"content":"hi","parent_id":1}`, http.StatusOK},
+		{"should not reply to a blocked author", `{"content":"hi","parent_id":4}`, http.StatusForbidden},
+		{"should not reply to a missing comment", `{"content":"hi","parent_id":99}`, http.StatusBadRequest},
+		{"should not reply through another post", `{"content":"hi","parent_id":2}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(t)
+			app.store.Users = &mfaUserStore{user: store.User{ID: 1, RoleID: 1}}
+			app.store.Comments = &ownedComments{}
+			app.store.Blocks = &blockedUser{}
+			app.cacheStorage.Users = &uncachedUsers{}
+			req, err := http.NewRequest(http.MethodPost, "/v1/posts/1/comments", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, app.mount()).Code, tt.want)
+		})
+	}
+}
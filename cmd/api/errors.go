@@ -2,6 +2,7 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/rijojohn85/social/internal/store"
@@ -166,3 +167,87 @@ func (app *application) unauthorizedError(w http.ResponseWriter, r *http.Request
 		return
 	}
 }
+
+func (app *application) payloadTooLargeError(
+	w http.ResponseWriter,
+	r *http.Request,
+	err error,
+) {
+	app.logger.Warnw(
+		"Payload too large",
+		"path",
+		r.URL.Path,
+		"error",
+		err.Error(),
+		"method",
+		r.Method,
+		"time",
+		time.Now(),
+	)
+
+	errJson := writeJsonError(
+		w,
+		http.StatusRequestEntityTooLarge,
+		err.Error(),
+	)
+	if errJson != nil {
+		app.internalServerError(w, r, errJson)
+		return
+	}
+}
+
+func (app *application) unsupportedMediaTypeError(
+	w http.ResponseWriter,
+	r *http.Request,
+	err error,
+) {
+	app.logger.Warnw(
+		"Unsupported media type",
+		"path",
+		r.URL.Path,
+		"error",
+		err.Error(),
+		"method",
+		r.Method,
+		"time",
+		time.Now(),
+	)
+
+	errJson := writeJsonError(
+		w,
+		http.StatusUnsupportedMediaType,
+		err.Error(),
+	)
+	if errJson != nil {
+		app.internalServerError(w, r, errJson)
+		return
+	}
+}
+
+func (app *application) rateLimitExceededResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	retryAfter time.Duration,
+) {
+	app.logger.Warnw(
+		"Rate limit exceeded",
+		"path",
+		r.URL.Path,
+		"method",
+		r.Method,
+		"retryAfter",
+		retryAfter,
+		"time",
+		time.Now(),
+	)
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	errJson := writeJsonError(
+		w,
+		http.StatusTooManyRequests,
+		"rate limit exceeded, retry in "+retryAfter.Round(time.Second).String(),
+	)
+	if errJson != nil {
+		app.internalServerError(w, r, errJson)
+		return
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// StreamEvents godoc
+//
+//	@Summary		Streams events
+//	@Description	Pushes new feed posts, comments on the posts of the current user and notifications as Server-Sent Events.
+//	@Description	Idle streams get a heartbeat comment. Reconnect with the Last-Event-ID header to get the events that were missed.
+//	@Description	The stream ends once the session is revoked, at the latest with the next heartbeat
+//	@Tags			events
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		400				{object}	error	"Invalid Last-Event-ID"
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/events [GET]
+func (app *application) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	sessionID := r.Context().Value(sessionCtxKey).(string)
+	sub, err := app.events.Subscribe(r.Context(), user.ID, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, events.ErrInvalidEventID):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// keeps nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		app.logger.Errorw("Error flushing event stream", "error", err, "user", user.ID)
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.events.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// the stream outlives the check of the request, a logout, password
+			// change or deleted account ends it here
+			if _, err := app.activeSession(r.Context(), sessionID, user.ID); err != nil {
+				if sessionEnded(err) {
+					return
+				}
+				// a failed check isn't a reason to drop the stream, the next
+				// heartbeat checks again
+				app.logger.Errorw("Error checking event stream session", "error", err, "user", user.ID)
+			}
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case ev, ok := <-sub.Events:
+			if !ok {
+				// fell behind, the client resumes from the last event it got
+				return
+			}
+			_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// publish pushes data to the streams of the users. It runs after the request
+// is done.
+func (app *application) publish(kind string, data any, userIDs ...int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	for _, userID := range userIDs {
+		ev, err := events.New(userID, kind, data)
+		if err == nil {
+			err = app.events.Publish(ctx, ev)
+		}
+		if err != nil {
+			app.logger.Errorw("Error publishing event", "error", err, "user", userID, "type", kind)
+		}
+	}
+}
+
+// publishPost pushes a new post to the streams of the followers of its
+// author. Followers of authors with more than fanoutLimit followers see it
+// when they read their feed instead.
+func (app *application) publishPost(post store.Post) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	followers, err := app.store.Users.GetFollowerIDs(ctx, post.UserID, app.config.timeline.fanoutLimit)
+	if err != nil {
+		if !errors.Is(err, store.ErrTooManyFollowers) {
+			app.logger.Errorw("Error publishing post", "error", err, "post", post.ID)
+		}
+		return
+	}
+	app.publish(events.TypePost, post, followers...)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestStreamEvents(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	ctx := context.Background()
+
+	publish := func(t *testing.T, kind string) {
+		t.Helper()
+		ev, err := events.New(0, kind, map[string]string{"hello": "world"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.events.Publish(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// stream opens the stream and returns the ids and types of the first n
+	// events.
+	stream := func(t *testing.T, lastEventID string, n int, then func()) []string {
+		t.Helper()
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		reqCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, srv.URL+"/v1/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		checkStatus(t, resp.StatusCode, http.StatusOK)
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Errorf("got Content-Type %q", got)
+		}
+		then()
+		got := []string{}
+		scanner := bufio.NewScanner(resp.Body)
+		var id string
+		for len(got) < n && scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				got = append(got, id+" "+strings.TrimPrefix(line, "event: "))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	t.Run("should push events as they happen", func(t *testing.T) {
+		got := stream(t, "", 2, func() {
+			publish(t, events.TypeNotification)
+			publish(t, events.TypeComment)
+		})
+		if strings.Join(got, ",") != "1 notification,2 comment" {
+			t.Errorf("got %v", got)
+		}
+	})
+	t.Run("should resume after the last event", func(t *testing.T) {
+		publish(t, events.TypePost)
+		got := stream(t, "2", 2, func() {
+			publish(t, events.TypeComment)
+		})
+		if strings.Join(got, ",") != "3 post,4 comment" {
+			t.Errorf("got %v", got)
+		}
+	})
+	t.Run("should refuse an invalid Last-Event-ID", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.Header.Set("Last-Event-ID", "nope")
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusBadRequest)
+	})
+	t.Run("should need a token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusUnauthorized)
+	})
+}
+
+// revocableSessions revokes every session once revoked is set.
+type revocableSessions struct {
+	store.MockSessionStore
+	revoked atomic.Bool
+}
+
+func (m *revocableSessions) Get(ctx context.Context, id string) (*store.Session, error) {
+	session := &store.Session{ID: id}
+	if m.revoked.Load() {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return session, nil
+}
+
+func TestStreamEventsRevoked(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.events.heartbeat = time.Millisecond * 10
+	sessions := &revocableSessions{}
+	app.store.Sessions = sessions
+	srv := httptest.NewServer(app.mount())
+	defer srv.Close()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	checkStatus(t, resp.StatusCode, http.StatusOK)
+	sessions.revoked.Store(true)
+	// the body ends once the next heartbeat sees the revoked session
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Fatalf("got %v, wanted the stream to end", err)
+	}
+}
@@ -1,45 +1,107 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/rijojohn85/social/internal/store"
 )
 
+// FeedPage is a page of the feed. next_cursor and prev_cursor are empty when
+// there is nothing more in that direction.
+type FeedPage struct {
+	Posts      []store.UserFeed `json:"posts"`
+	NextCursor string           `json:"next_cursor"`
+	PrevCursor string           `json:"prev_cursor"`
+}
+
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user feed. Pass next_cursor or prev_cursor as cursor to move between pages,
+//	@Description	offset is still honoured when no cursor is given
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
 //	@Param			limit	query		int		false	"Limit"
 //	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
 //	@Param			sort	query		string	false	"Sort"
-//	@Param			tags	query		string	false	"Tags"
+//	@Param			tags	query		string	false	"Comma separated tags, posts with any of them match"
 //	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]store.UserFeed
+//	@Param			since	query		string	false	"Only posts created at or after this RFC3339 time"
+//	@Param			until	query		string	false	"Only posts created before this RFC3339 time"
+//	@Success		200		{object}	FeedPage
 //	@Failure		400		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
-	// pagination, filters, sort
 	ctx := r.Context()
-	var fq store.PaginatedFeedQuery
-	fq.Limit = 10
-	fq.Offset = 0
-	fq.Sort = "desc"
-	fq, err := fq.Parse(r)
-	user := r.Context().Value("user").(*store.User)
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
 
-	app.logger.Warnw("user deets", "fq", fq)
-	posts, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
+	posts, err := app.homeTimeline(ctx, user.ID, fq)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
-	err = app.jsonResponse(w, http.StatusOK, posts)
+	err = app.jsonResponse(w, http.StatusOK, newFeedPage(posts, fq))
 	if err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// readFeedQuery reads pagination, filters and sort of a list of posts.
+func (app *application) readFeedQuery(w http.ResponseWriter, r *http.Request) (store.PaginatedFeedQuery, bool) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  10,
+		Offset: 0,
+		Sort:   "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return fq, false
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return fq, false
+	}
+	return fq, true
+}
+
+func newFeedPage(posts []store.UserFeed, fq store.PaginatedFeedQuery) FeedPage {
+	page := FeedPage{Posts: posts}
+	if len(posts) == 0 {
+		return page
+	}
+	first, last := posts[0], posts[len(posts)-1]
+	var prev bool
+	if fq.Cursor != "" {
+		c, _ := store.DecodeCursor(fq.Cursor)
+		prev = c.Prev
+	}
+	full := len(posts) == fq.Limit
+	// moving forward there is more when the page is full, there is always
+	// something behind; moving backward it is the other way around
+	hasNext, hasPrev := full, fq.Cursor != "" || fq.Offset > 0
+	if prev {
+		hasNext, hasPrev = true, full
+	}
+	if hasNext {
+		page.NextCursor = store.Cursor{CreatedAt: last.CreateAt, ID: last.ID}.Encode()
+	}
+	if hasPrev {
+		page.PrevCursor = store.Cursor{CreatedAt: first.CreateAt, ID: first.ID, Prev: true}.Encode()
+	}
+	return page
+}
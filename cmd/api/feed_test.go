@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestNewFeedPage(t *testing.T) {
+	posts := []store.UserFeed{
+		{Post: store.Post{ID: 3, CreateAt: "2024-05-03T10:00:00Z"}},
+		{Post: store.Post{ID: 2, CreateAt: "2024-05-02T10:00:00Z"}},
+	}
+	decode := func(s string) store.Cursor {
+		t.Helper()
+		c, err := store.DecodeCursor(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	t.Run("should only page forward from the first page", func(t *testing.T) {
+		page := newFeedPage(posts, store.PaginatedFeedQuery{Limit: 2})
+		if page.PrevCursor != "" {
+			t.Errorf("got prev cursor %q, wanted none", page.PrevCursor)
+		}
+		if c := decode(page.NextCursor); c.ID != 2 || c.Prev {
+			t.Errorf("got next cursor %+v, wanted post 2", c)
+		}
+	})
+	t.Run("should stop at a short page", func(t *testing.T) {
+		next := store.Cursor{CreatedAt: "2024-05-04T10:00:00Z", ID: 4}.Encode()
+		page := newFeedPage(posts, store.PaginatedFeedQuery{Limit: 10, Cursor: next})
+		if page.NextCursor != "" {
+			t.Errorf("got next cursor %q, wanted none", page.NextCursor)
+		}
+		if c := decode(page.PrevCursor); c.ID != 3 || !c.Prev {
+			t.Errorf("got prev cursor %+v, wanted post 3", c)
+		}
+	})
+	t.Run("should stop at the start when paging back", func(t *testing.T) {
+		prev := store.Cursor{CreatedAt: "2024-05-01T10:00:00Z", ID: 1, Prev: true}.Encode()
+		page := newFeedPage(posts, store.PaginatedFeedQuery{Limit: 10, Cursor: prev})
+		if page.PrevCursor != "" {
+			t.Errorf("got prev cursor %q, wanted none", page.PrevCursor)
+		}
+		if c := decode(page.NextCursor); c.ID != 2 || c.Prev {
+			t.Errorf("got next cursor %+v, wanted post 2", c)
+		}
+	})
+}
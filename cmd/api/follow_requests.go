@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// ListFollowRequests godoc
+//
+//	@Summary		Lists follow requests
+//	@Description	Lists the pending requests to follow the current user, the newest first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	ListedUsersPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests [GET]
+func (app *application) listFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	app.listListed(w, r, app.store.Users.ListFollowRequests)
+}
+
+// ApproveFollowRequest godoc
+//
+//	@Summary		Approves a follow request
+//	@Description	Makes the user who asked a follower of the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"ID of the user who asked"
+//	@Success		204		{string}	string	"Request approved"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"No such request"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{userID}/approve [PUT]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if requesterID, ok := app.answerFollowRequest(w, r, app.store.Users.ApproveFollowRequest); ok {
+		app.forgetTimeline(r.Context(), requesterID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RejectFollowRequest godoc
+//
+//	@Summary		Rejects a follow request
+//	@Description	Drops the request of a user to follow the current user
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"ID of the user who asked"
+//	@Success		204		{string}	string	"Request rejected"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"No such request"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/follow-requests/{userID}/reject [PUT]
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.answerFollowRequest(w, r, app.store.Users.RejectFollowRequest); ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// answerFollowRequest approves or rejects the request of the user in the path
+// and returns their id. It writes the error response when it returns false.
+func (app *application) answerFollowRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	answer func(ctx context.Context, userID, requesterID int64) error,
+) (int64, bool) {
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return 0, false
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if err := answer(r.Context(), user.ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return 0, false
+	}
+	return requesterID, true
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/rijojohn85/social/internal/db/auth"
+)
+
+// JWKS godoc
+//
+//	@Summary		Public signing keys
+//	@Description	Publishes the public keys that verify access tokens as a JSON Web Key Set
+//	@Tags			auth
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKS
+//	@Failure		500	{object}	error
+//	@Router			/.well-known/jwks.json [GET]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// HMAC secrets are never published, the set is empty then
+	jwks := auth.JWKS{Keys: []auth.JWK{}}
+	if publisher, ok := app.authenticator.(auth.KeyPublisher); ok {
+		jwks = publisher.JWKS()
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJson(w, http.StatusOK, jwks); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/lockout"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// loginGuards count failed logins per email and per ip. The ip limits are
+// looser since many users can share one address.
+type loginGuards struct {
+	email *lockout.Guard
+	ip    *lockout.Guard
+}
+
+func lockoutKey(kind, value string) string {
+	return kind + ":" + strings.ToLower(value)
+}
+
+// loginBlockedFor returns how long the client has to wait before it may try to
+// log in again. The guards fail open, a broken backend must not stop logins.
+func (app *application) loginBlockedFor(ctx context.Context, email, ip string) time.Duration {
+	emailWait, err := app.loginGuards.email.Check(ctx, lockoutKey(store.LockoutKindEmail, email))
+	if err != nil {
+		app.logger.Errorw("Checking login lockout failed", "error", err)
+	}
+	ipWait, err := app.loginGuards.ip.Check(ctx, lockoutKey(store.LockoutKindIP, ip))
+	if err != nil {
+		app.logger.Errorw("Checking login lockout failed", "error", err)
+	}
+	return max(emailWait, ipWait)
+}
+
+func (app *application) loginFailed(ctx context.Context, email, ip string) {
+	app.recordLoginFailure(ctx, app.loginGuards.email, store.LockoutKindEmail, email)
+	app.recordLoginFailure(ctx, app.loginGuards.ip, store.LockoutKindIP, ip)
+}
+
+// loginSucceeded forgets the failures of the email. The ip keeps its count, or
+// an attacker could reset it with an account of their own.
+func (app *application) loginSucceeded(ctx context.Context, email string) {
+	err := app.loginGuards.email.Reset(ctx, lockoutKey(store.LockoutKindEmail, email))
+	if err != nil {
+		app.logger.Errorw("Resetting login failures failed", "error", err)
+	}
+}
+
+func (app *application) recordLoginFailure(
+	ctx context.Context,
+	guard *lockout.Guard,
+	kind, value string,
+) {
+	result, err := guard.Fail(ctx, lockoutKey(kind, value))
+	if err != nil {
+		app.logger.Errorw("Recording login failure failed", "error", err)
+		return
+	}
+	if !result.Locked {
+		return
+	}
+	app.logger.Warnw("Login locked out", "kind", kind, "key", value, "failures", result.Failures)
+	err = app.store.Lockouts.Create(ctx, &store.Lockout{
+		Kind:        kind,
+		Key:         strings.ToLower(value),
+		Failures:    result.Failures,
+		LockedUntil: time.Now().Add(result.RetryAfter),
+	})
+	if err != nil {
+		app.logger.Errorw("Recording lockout failed", "error", err)
+	}
+}
+
+// ListLockouts godoc
+//
+//	@Summary		Lists login lockouts
+//	@Description	Lists the emails and ips that are locked out after repeated failed logins
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	[]store.Lockout
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/lockouts [GET]
+func (app *application) listLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := app.store.Lockouts.ListActive(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, lockouts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UnlockLockout godoc
+//
+//	@Summary		Lifts a login lockout
+//	@Description	Lifts a lockout before it expires and forgets the failed attempts
+//	@Tags			admin
+//	@Produce		json
+//	@Param			lockoutID	path		int	true	"Lockout ID"
+//	@Success		200			{object}	store.Lockout
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/lockouts/{lockoutID} [DELETE]
+func (app *application) unlockLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "lockoutID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	admin := r.Context().Value(userCtxKey).(*store.User)
+	l, err := app.store.Lockouts.Unlock(r.Context(), id, admin.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	guard := app.loginGuards.email
+	if l.Kind == store.LockoutKindIP {
+		guard = app.loginGuards.ip
+	}
+	if err := guard.Reset(r.Context(), lockoutKey(l.Kind, l.Key)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, l); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/rijojohn85/social/internal/blob"
 	"github.com/rijojohn85/social/internal/db"
 	"github.com/rijojohn85/social/internal/db/auth"
 	"github.com/rijojohn85/social/internal/env"
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/lockout"
 	"github.com/rijojohn85/social/internal/mailer"
+	"github.com/rijojohn85/social/internal/notifications"
+	"github.com/rijojohn85/social/internal/ratelimit"
 	"github.com/rijojohn85/social/internal/store"
 	cache2 "github.com/rijojohn85/social/internal/store/cache"
 	"go.uber.org/zap"
@@ -43,7 +51,10 @@ func main() {
 		env:    env.GetString("ENV", "development"),
 		apiURL: env.GetString("EXTERNAL_URL", "localhost:8080"),
 		mail: mailConfig{
-			exp: time.Hour * 24,
+			exp:            time.Hour * 24,
+			resetExp:       time.Hour,
+			emailChangeExp: time.Hour * 24,
+			resendCooldown: time.Minute * 5,
 			mailer: mailTripConfig{
 				url:      env.GetString("MAILER_URL", "sandbox.smtp.mailtrap.io"),
 				port:     env.GetInt("MAILER_PORT", 587),
@@ -57,6 +68,68 @@ func main() {
 			db:      env.GetInt("REDIS_DB", 0),
 			enabled: env.GetBool("REDIS_ENABLED", false),
 		},
+		cleanup: cleanupConfig{
+			interval: time.Hour,
+			unactivatedTTL: time.Hour * 24 * time.Duration(
+				env.GetInt("UNACTIVATED_USER_TTL_DAYS", 0),
+			),
+			deletionGrace: time.Hour * 24 * time.Duration(
+				env.GetInt("ACCOUNT_DELETION_GRACE_DAYS", 30),
+			),
+		},
+		lockout: lockoutConfig{
+			email: lockout.Config{
+				FreeAttempts:    3,
+				BaseDelay:       time.Second,
+				MaxDelay:        time.Minute,
+				MaxAttempts:     10,
+				LockoutDuration: time.Minute * 15,
+				Window:          time.Hour,
+			},
+			ip: lockout.Config{
+				FreeAttempts:    20,
+				BaseDelay:       time.Second,
+				MaxDelay:        time.Minute,
+				MaxAttempts:     100,
+				LockoutDuration: time.Minute * 15,
+				Window:          time.Hour,
+			},
+		},
+		timeline: timelineConfig{
+			enabled:     env.GetBool("TIMELINE_CACHE_ENABLED", false),
+			size:        env.GetInt("TIMELINE_SIZE", 800),
+			fanoutLimit: env.GetInt("TIMELINE_FANOUT_LIMIT", 10000),
+		},
+		events: eventsConfig{
+			heartbeat:  time.Second * 15,
+			history:    env.GetInt("EVENTS_HISTORY", 100),
+			historyTTL: time.Hour * 24,
+			buffer:     64,
+		},
+		media: mediaConfig{
+			maxSize:       int64(env.GetInt("MEDIA_MAX_BYTES", 10<<20)),
+			thumbnailSize: 320,
+			unattachedTTL: time.Hour * 24,
+			storage:       env.GetString("MEDIA_STORAGE", "local"),
+			dir:           env.GetString("MEDIA_DIR", "uploads"),
+			s3: blob.S3Config{
+				Endpoint:  env.GetString("S3_ENDPOINT", ""),
+				Bucket:    env.GetString("S3_BUCKET", ""),
+				Region:    env.GetString("S3_REGION", "us-east-1"),
+				AccessKey: env.GetString("S3_ACCESS_KEY", ""),
+				SecretKey: env.GetString("S3_SECRET_KEY", ""),
+			},
+		},
+		scheduler: schedulerConfig{
+			interval: time.Second * 30,
+			batch:    100,
+		},
+		requestTimeout:     time.Minute,
+		permissionsRefresh: time.Minute,
+		rateLimit: rateLimitConfig{
+			enabled: env.GetBool("RATE_LIMIT_ENABLED", true),
+			routes:  make(map[string]ratelimit.Limit),
+		},
 		auth: authConfig{
 			basic: basicAuthConfig{
 				user: "rijo",
@@ -65,7 +138,13 @@ func main() {
 			token: tokenConfig{
 				secret: env.GetString("TOKEN_SECRET", "hello_world"),
 				aud:    env.GetString("TOKEN_AUD", "gophersocial"),
-				exp:    time.Hour * 24 * 7,
+				// access tokens are short lived, sessions live on through refresh tokens
+				exp:        time.Minute * 15,
+				refreshExp: time.Hour * 24 * 30,
+				// PEM files named <kid>.pem, public only keys are kept for verification
+				keysDir:    env.GetString("TOKEN_KEYS_DIR", ""),
+				signingKID: env.GetString("TOKEN_SIGNING_KID", ""),
+				mfaExp:     time.Minute * 5,
 			},
 		},
 	}
@@ -101,15 +180,87 @@ func main() {
 	logger.Info("Connected to Database pool")
 	defer database.Close()
 	storage := store.NewStorage(database)
-	authetincator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.aud, cfg.auth.token.aud)
+	var authetincator auth.Authenticator
+	if cfg.auth.token.keysDir != "" {
+		keys, err := auth.LoadKeys(cfg.auth.token.keysDir)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		authetincator, err = auth.NewJWTKeySetAuthenticator(
+			keys,
+			cfg.auth.token.signingKID,
+			cfg.auth.token.aud,
+			cfg.auth.token.aud,
+		)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Infow("Signing tokens with key set", "kid", cfg.auth.token.signingKID, "keys", len(keys))
+	} else {
+		logger.Warn("TOKEN_KEYS_DIR not set, signing tokens with TOKEN_SECRET")
+		authetincator = auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.aud, cfg.auth.token.aud)
+	}
+	for name, fallback := range defaultRateLimits {
+		spec := env.GetString("RATE_LIMIT_"+strings.ToUpper(name), fallback)
+		if spec == "" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		cfg.rateLimit.routes[name] = limit
+	}
+	// failed logins and rate limits are shared between instances through redis
+	// when it is enabled
+	var lockoutBackend lockout.Backend = lockout.NewMemoryBackend()
+	var rateLimiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.timeline.enabled && !cfg.redisCfg.enabled {
+		logger.Warn("TIMELINE_CACHE_ENABLED needs REDIS_ENABLED, reading timelines from the database")
+		cfg.timeline.enabled = false
+	}
+	// events reach the streams on other instances through redis pub/sub
+	hub := events.NewHub(cfg.events.buffer)
+	var broker events.Broker = events.NewMemoryBroker(hub, cfg.events.history)
+	if cfg.redisCfg.enabled {
+		lockoutBackend = lockout.NewRedisBackend(rd, "login")
+		rateLimiter = ratelimit.NewRedisLimiter(rd, "ratelimit")
+		redisBroker := events.NewRedisBroker(rd, hub, "events", cfg.events.history, cfg.events.historyTTL)
+		go redisBroker.Run(context.Background())
+		broker = redisBroker
+	}
+	var blobs blob.Storage
+	switch cfg.media.storage {
+	case "local":
+		blobs = blob.NewLocalStorage(cfg.media.dir)
+	case "s3":
+		blobs = blob.NewS3Storage(cfg.media.s3, &http.Client{Timeout: time.Minute * 5})
+	default:
+		logger.Fatalf("unknown MEDIA_STORAGE %q, use local or s3", cfg.media.storage)
+	}
 	app := &application{
 		config:        cfg,
 		store:         storage,
 		logger:        logger,
 		mailer:        mailTripDialer,
 		authenticator: authetincator,
-		cacheStorage:  cache2.NewRedisStorage(rd),
+		cacheStorage:  cache2.NewRedisStorage(rd, cfg.timeline.size),
+		loginGuards: loginGuards{
+			email: lockout.NewGuard(lockoutBackend, cfg.lockout.email),
+			ip:    lockout.NewGuard(lockoutBackend, cfg.lockout.ip),
+		},
+		rateLimiter:   rateLimiter,
+		permissions:   &permissionCache{},
+		notifications: notifications.NewService(storage.Notifications, broker, logger),
+		events:        broker,
+		blobs:         blobs,
+	}
+	if err := app.loadPermissions(context.Background()); err != nil {
+		logger.Fatal(err)
 	}
+	go app.refreshPermissions(context.Background())
+	go app.cleanupInvitations(context.Background())
+	go app.publishScheduledPosts(context.Background())
 	mux := app.mount()
 	logger.Fatal(app.run(mux))
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rijojohn85/social/internal/blob"
+	"github.com/rijojohn85/social/internal/media"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// multipartOverhead is room for the multipart boundaries and headers on top
+// of the file itself.
+const multipartOverhead = 64 << 10
+
+// uploadTimeout replaces the request timeout and the server read and write
+// timeouts for uploads, which are too short for large files on slow
+// connections.
+const uploadTimeout = time.Minute * 5
+
+// mediaPurgeBatch is how many unattached uploads are deleted per query.
+const mediaPurgeBatch = 100
+
+// UploadMedia godoc
+//
+//	@Summary		Uploads media
+//	@Description	Uploads an image or video as the "file" field of a multipart form. The type is sniffed from the content,
+//	@Description	jpeg, png, gif, webp and mp4 are accepted. Images get a thumbnail. Attach the media to a post with its id
+//	@Description	in media_ids, uploads not attached to a post are deleted after a day
+//	@Tags			media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"File to upload"
+//	@Success		201		{object}	store.Media
+//	@Failure		400		{object}	error
+//	@Failure		413		{object}	error	"File or image dimensions too large"
+//	@Failure		415		{object}	error	"Unsupported file type"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media [post]
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	deadline := time.Now().Add(uploadTimeout)
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	defer cancel()
+	r = r.WithContext(ctx)
+	maxSize := app.config.media.maxSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	data, err := readUpload(r, maxSize)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr), errors.Is(err, errUploadTooLarge):
+			app.payloadTooLargeError(w, r, errUploadTooLarge)
+		default:
+			app.badRequestError(w, r, err)
+		}
+		return
+	}
+	contentType, err := media.Sniff(data)
+	if err != nil {
+		app.unsupportedMediaTypeError(w, r, err)
+		return
+	}
+	thumb, err := media.MakeThumbnail(data, contentType, app.config.media.thumbnailSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrImageTooLarge):
+			app.payloadTooLargeError(w, r, err)
+		default:
+			app.badRequestError(w, r, fmt.Errorf("invalid image: %w", err))
+		}
+		return
+	}
+
+	user := r.Context().Value(userCtxKey).(*store.User)
+	m := &store.Media{
+		UserID:      user.ID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Key:         fmt.Sprintf("media/%d/%s", user.ID, uuid.New().String()),
+	}
+	if err := app.blobs.Put(ctx, m.Key, bytes.NewReader(data), m.Size, contentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if thumb != nil {
+		key := m.Key + "-thumb"
+		m.ThumbnailKey = &key
+		m.Width, m.Height = &thumb.Width, &thumb.Height
+		err := app.blobs.Put(ctx, key, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType)
+		if err != nil {
+			app.deleteBlobs(*m)
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if err := app.store.Media.Create(ctx, m); err != nil {
+		app.deleteBlobs(*m)
+		app.internalServerError(w, r, err)
+		return
+	}
+	setMediaURLs(m)
+	if err := app.jsonResponse(w, http.StatusCreated, m); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var errUploadTooLarge = errors.New("file too large")
+
+// readUpload reads the "file" part of a multipart request, up to maxSize
+// bytes.
+func readUpload(r *http.Request, maxSize int64) ([]byte, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing file")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxSize {
+			return nil, errUploadTooLarge
+		}
+		if len(data) == 0 {
+			return nil, errors.New("empty file")
+		}
+		return data, nil
+	}
+}
+
+// GetMedia godoc
+//
+//	@Summary		Gets media
+//	@Description	Gets an uploaded file. Media attached to a post can be read by whoever can see the post
+//	@Tags			media
+//	@Produce		octet-stream
+//	@Param			mediaID	path		int		true	"mediaID"
+//	@Success		200		{file}		file	"The file"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/{mediaID} [get]
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := app.readableMedia(w, r)
+	if !ok {
+		return
+	}
+	app.serveBlob(w, r, m.Key, m.ContentType)
+}
+
+// GetMediaThumbnail godoc
+//
+//	@Summary		Gets a media thumbnail
+//	@Description	Gets the thumbnail of an uploaded image, media without a thumbnail are not found
+//	@Tags			media
+//	@Produce		image/jpeg,image/png
+//	@Param			mediaID	path		int		true	"mediaID"
+//	@Success		200		{file}		file	"The thumbnail"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/media/{mediaID}/thumbnail [get]
+func (app *application) getMediaThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := app.readableMedia(w, r)
+	if !ok {
+		return
+	}
+	if m.ThumbnailKey == nil {
+		app.notFoundError(w, r, store.ErrorNotFound)
+		return
+	}
+	contentType := "image/png"
+	if m.ContentType == "image/jpeg" {
+		contentType = "image/jpeg"
+	}
+	app.serveBlob(w, r, *m.ThumbnailKey, contentType)
+}
+
+// readableMedia loads the media of the route. Only the uploader sees media
+// that is not attached to a post, attached media is visible with its post.
+func (app *application) readableMedia(w http.ResponseWriter, r *http.Request) (*store.Media, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return nil, false
+	}
+	ctx := r.Context()
+	m, err := app.store.Media.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	viewer := ctx.Value(userCtxKey).(*store.User)
+	if m.UserID == viewer.ID {
+		return m, true
+	}
+	if m.PostID == nil {
+		app.notFoundError(w, r, store.ErrorNotFound)
+		return nil, false
+	}
+	post := &store.Post{}
+	if err := app.store.Posts.GetPostById(ctx, post, *m.PostID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	visible, err := app.canViewPost(ctx, viewer, post)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return nil, false
+	}
+	if !visible {
+		app.notFoundError(w, r, store.ErrorNotFound)
+		return nil, false
+	}
+	return m, true
+}
+
+func (app *application) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType string) {
+	body, err := app.blobs.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			app.notFoundError(w, r, store.ErrorNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", contentType)
+	// the type was sniffed on upload, browsers must not guess another one
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		app.logger.Errorw("Error serving blob", "error", err, "key", key)
+	}
+}
+
+// setMediaURLs points the media at the routes serving it.
+func setMediaURLs(m *store.Media) {
+	m.URL = fmt.Sprintf("/v1/media/%d", m.ID)
+	if m.ThumbnailKey != nil {
+		url := m.URL + "/thumbnail"
+		m.ThumbnailURL = &url
+	}
+}
+
+// deleteBlobs removes the file and thumbnail of the media, failures are
+// logged and leave the blobs behind.
+func (app *application) deleteBlobs(m store.Media) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	keys := []string{m.Key}
+	if m.ThumbnailKey != nil {
+		keys = append(keys, *m.ThumbnailKey)
+	}
+	for _, key := range keys {
+		if err := app.blobs.Delete(ctx, key); err != nil {
+			app.logger.Errorw("Error deleting blob", "error", err, "key", key, "media", m.ID)
+		}
+	}
+}
+
+// purgeUnattachedMedia deletes uploads that were never attached to a post or
+// were detached from theirs, and their blobs.
+func (app *application) purgeUnattachedMedia(ctx context.Context) {
+	for {
+		deleted, err := app.store.Media.DeleteUnattached(ctx, app.config.media.unattachedTTL, mediaPurgeBatch)
+		if err != nil {
+			app.logger.Errorw("Purging unattached media failed", "error", err)
+			return
+		}
+		for _, m := range deleted {
+			app.deleteBlobs(m)
+		}
+		if len(deleted) > 0 {
+			app.logger.Infow("Purged unattached media", "count", len(deleted))
+		}
+		if len(deleted) < mediaPurgeBatch {
+			return
+		}
+	}
+}
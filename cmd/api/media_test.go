@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/blob"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 200, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newUploadRequest(t *testing.T, field string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile(field, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "/v1/media", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadMedia(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	tests := []struct {
+		name  string
+		field string
+		data  []byte
+		want  int
+	}{
+		{"should upload an image", "file", testPNG(t, 200, 100), http.StatusCreated},
+		{"should refuse text", "file", []byte("just some text"), http.StatusUnsupportedMediaType},
+		{"should refuse files over the limit", "file", bytes.Repeat([]byte{0}, 1<<20+1), http.StatusRequestEntityTooLarge},
+		{"should refuse an empty file", "file", []byte{}, http.StatusBadRequest},
+		{"should need the file field", "avatar", testPNG(t, 10, 10), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newUploadRequest(t, tt.field, tt.data)
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			w := executeRequest(t, req, mux)
+			checkStatus(t, w.Code, tt.want)
+		})
+	}
+
+	t.Run("should serve the upload and its thumbnail", func(t *testing.T) {
+		data := testPNG(t, 200, 100)
+		req := newUploadRequest(t, "file", data)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusCreated)
+		var resp struct {
+			Data store.Media `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		m := resp.Data
+		if m.ContentType != "image/png" || m.Width == nil || *m.Width != 200 || *m.Height != 100 {
+			t.Fatalf("got media %+v, wanted a 200x100 png", m)
+		}
+		if m.ThumbnailURL == nil {
+			t.Fatal("got no thumbnail url")
+		}
+
+		for _, path := range []string{m.URL, *m.ThumbnailURL} {
+			req, err := http.NewRequest(http.MethodGet, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			w := executeRequest(t, req, mux)
+			checkStatus(t, w.Code, http.StatusOK)
+			if got := w.Header().Get("Content-Type"); got != "image/png" {
+				t.Errorf("got Content-Type %q for %s, wanted image/png", got, path)
+			}
+			if path == m.URL && !bytes.Equal(w.Body.Bytes(), data) {
+				t.Errorf("got %d bytes for %s, wanted the upload", w.Body.Len(), path)
+			}
+			if path == *m.ThumbnailURL {
+				cfg, err := png.DecodeConfig(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cfg.Width != 64 || cfg.Height != 32 {
+					t.Errorf("got a %dx%d thumbnail, wanted 64x32", cfg.Width, cfg.Height)
+				}
+			}
+		}
+	})
+
+	t.Run("should not find missing media", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/v1/media/%d", 1000), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusNotFound)
+	})
+}
+
+// slowReader waits before giving its data, like a client on a slow link.
+type slowReader struct {
+	io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.Reader.Read(p)
+}
+
+// contextBlobs fails once the request is cancelled, like a remote store.
+type contextBlobs struct {
+	blob.Storage
+}
+
+func (b *contextBlobs) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.Storage.Put(ctx, key, r, size, contentType)
+}
+
+func TestUploadMediaTimeout(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.requestTimeout = time.Millisecond * 20
+	app.blobs = &contextBlobs{blob.NewLocalStorage(t.TempDir())}
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	req := newUploadRequest(t, "file", testPNG(t, 10, 10))
+	req.Body = io.NopCloser(&slowReader{Reader: req.Body, delay: time.Millisecond * 50})
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := executeRequest(t, req, mux)
+	checkStatus(t, w.Code, http.StatusCreated)
+}
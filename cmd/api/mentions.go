@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rijojohn85/social/internal/content"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// mentionInPost stores the users mentioned in the post and notifies the ones
+// that were not mentioned in it before and can see it. It runs after the
+// request is done.
+func (app *application) mentionInPost(post store.Post) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	added, err := app.store.Mentions.SetPostMentions(ctx, post.ID, content.Mentions(post.Content))
+	if err != nil {
+		app.logger.Errorw("Error storing mentions", "error", err, "post", post.ID)
+		return
+	}
+	app.notifications.Mention(app.postViewers(ctx, &post, added), post.UserID, post.ID, nil)
+}
+
+// mentionInComment is mentionInPost for a new comment.
+func (app *application) mentionInComment(comment store.Comment) {
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	added, err := app.store.Mentions.SetCommentMentions(ctx, comment.ID, content.Mentions(comment.Content))
+	if err != nil {
+		app.logger.Errorw("Error storing mentions", "error", err, "comment", comment.ID)
+		return
+	}
+	if len(added) == 0 {
+		return
+	}
+	post := &store.Post{}
+	if err := app.store.Posts.GetPostById(ctx, post, comment.PostID); err != nil {
+		app.logger.Errorw("Error reading mentioned post", "error", err, "post", comment.PostID)
+		return
+	}
+	app.notifications.Mention(app.postViewers(ctx, post, added), comment.UserId, comment.PostID, &comment.ID)
+}
+
+// postViewers leaves out the users that can't see the post, a notification
+// would tell them about a post they can't open.
+func (app *application) postViewers(ctx context.Context, post *store.Post, userIDs []int64) []int64 {
+	viewers := []int64{}
+	for _, userID := range userIDs {
+		viewer := &store.User{}
+		if err := app.getUser(ctx, viewer, userID); err != nil {
+			app.logger.Errorw("Error reading mentioned user", "error", err, "user", userID)
+			continue
+		}
+		visible, err := app.canViewPost(ctx, viewer, post)
+		if err != nil {
+			app.logger.Errorw("Error checking post visibility", "error", err, "user", userID, "post", post.ID)
+			continue
+		}
+		if visible {
+			viewers = append(viewers, userID)
+		}
+	}
+	return viewers
+}
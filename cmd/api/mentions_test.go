@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/notifications"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// mentionedUsers reports the users 2 and 3 as newly mentioned.
+type mentionedUsers struct {
+	store.MockMentionStore
+}
+
+func (m *mentionedUsers) SetPostMentions(context.Context, int64, []string) ([]int64, error) {
+	return []int64{2, 3}, nil
+}
+
+func (m *mentionedUsers) SetCommentMentions(context.Context, int64, []string) ([]int64, error) {
+	return []int64{2, 3}, nil
+}
+
+// privateAuthor makes user 1 private with only user 2 following.
+type privateAuthor struct {
+	store.MockUserStore
+}
+
+func (m *privateAuthor) GetUser(_ context.Context, user *store.User, userID int64) error {
+	*user = store.User{ID: userID, IsPrivate: userID == 1}
+	return nil
+}
+
+func (m *privateAuthor) IsFollowing(_ context.Context, userID, targetID int64) (bool, error) {
+	return userID == 2 && targetID == 1, nil
+}
+
+// privatePost is a published post of the private author.
+type privatePost struct {
+	store.MockPostStore
+}
+
+func (m *privatePost) GetPostById(_ context.Context, post *store.Post, postID int64) error {
+	*post = store.Post{ID: postID, UserID: 1, Status: store.PostPublished}
+	return nil
+}
+
+// notified records who notifications were created for.
+type notified struct {
+	store.MockNotificationStore
+	mu    sync.Mutex
+	users []int64
+}
+
+func (m *notified) Create(_ context.Context, n *store.Notification) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users = append(m.users, n.UserID)
+	return true, nil
+}
+
+func TestMentionVisibility(t *testing.T) {
+	newApp := func(t *testing.T) (*application, *notified) {
+		app := NewTestApplication(t)
+		app.store.Mentions = &mentionedUsers{}
+		app.store.Users = &privateAuthor{}
+		app.store.Posts = &privatePost{}
+		app.cacheStorage.Users = &uncachedUsers{}
+		n := &notified{}
+		app.notifications = notifications.NewService(n, app.events, app.logger)
+		return app, n
+	}
+	t.Run("should only notify followers of a private author on posts", func(t *testing.T) {
+		app, n := newApp(t)
+		app.mentionInPost(store.Post{ID: 1, UserID: 1, Status: store.PostPublished, Content: "@bob @carol"})
+		if !slices.Equal(n.users, []int64{2}) {
+			t.Errorf("notified %v, wanted only the follower", n.users)
+		}
+	})
+	t.Run("should only notify followers of a private author on comments", func(t *testing.T) {
+		app, n := newApp(t)
+		app.mentionInComment(store.Comment{ID: 1, PostID: 1, UserId: 4, Content: "@bob @carol"})
+		if !slices.Equal(n.users, []int64{2}) {
+			t.Errorf("notified %v, wanted only the follower", n.users)
+		}
+	})
+}
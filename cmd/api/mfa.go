@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rijojohn85/social/internal/db/auth"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+const (
+	totpIssuer        = "GopherSocial"
+	recoveryCodeCount = 10
+	mfaTokenType      = "mfa"
+)
+
+var errInvalidMFACode = errors.New("invalid two-factor code")
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type CreateMFATokenPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type MFACodePayload struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (app *application) mfaChallengeResponse(w http.ResponseWriter, r *http.Request, userID int64) {
+	claim := jwt.MapClaims{
+		"sub": userID,
+		"typ": mfaTokenType,
+		"exp": time.Now().Add(app.config.auth.token.mfaExp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.aud,
+		"aud": app.config.auth.token.aud,
+	}
+	token, err := app.authenticator.GenerateToken(claim)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	challenge := MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(app.config.auth.token.mfaExp.Seconds()),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, challenge); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// verifySecondFactor accepts a TOTP code or one of the user's recovery codes.
+func (app *application) verifySecondFactor(ctx context.Context, userID int64, code string) error {
+	totp, err := app.store.MFA.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrorNotFound) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+	if !totp.Confirmed {
+		return errInvalidMFACode
+	}
+	// recovery codes can be all digits too, only six of them make a TOTP code
+	code = auth.NormalizeRecoveryCode(code)
+	if auth.IsTOTPCode(code) {
+		step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+		if !ok {
+			return errInvalidMFACode
+		}
+		err = app.store.MFA.UseTOTPStep(ctx, userID, step)
+	} else {
+		err = app.store.MFA.UseRecoveryCode(ctx, userID, code)
+	}
+	if errors.Is(err, store.ErrInvalidToken) {
+		return errInvalidMFACode
+	}
+	return err
+}
+
+// CreateMFAToken godoc
+//
+//	@Summary		Completes a two-factor login
+//	@Description	Exchanges the mfa_token of the token endpoint and a TOTP or recovery code for a session
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateMFATokenPayload	true	"MFA payload"
+//	@Success		201		{object}	TokenResponse			"Tokens"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/token/mfa [POST]
+func (app *application) createMFATokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateMFATokenPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	jwtToken, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	if claims["typ"] != mfaTokenType {
+		app.unauthorizedError(w, r, errors.New("not an mfa token"))
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+	// codes are guessed against the same lockout as passwords
+	user := &store.User{}
+	if err := app.getUser(r.Context(), user, userID); err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+	ip := clientIP(r)
+	if wait := app.loginBlockedFor(r.Context(), user.Email, ip); wait > 0 {
+		app.rateLimitExceededResponse(w, r, wait)
+		return
+	}
+	err = app.verifySecondFactor(r.Context(), userID, payload.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidMFACode):
+			app.loginFailed(r.Context(), user.Email, ip)
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if app.deletedForGood(user) {
+		app.unauthorizedError(w, r, errors.New("invalid credentials"))
+		return
+	}
+	app.loginSucceeded(r.Context(), user.Email)
+	if err := app.restoreDeleted(r.Context(), user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.startSession(w, r, userID)
+}
+
+// EnrollTOTP godoc
+//
+//	@Summary		Starts TOTP enrollment
+//	@Description	Creates a TOTP secret for the current user. 2FA is enabled once a code is verified
+//	@Tags			mfa
+//	@Produce		json
+//	@Success		201	{object}	TOTPEnrollmentResponse
+//	@Failure		401	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp [POST]
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userCtxKey).(*store.User)
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	err = app.store.MFA.CreateTOTP(r.Context(), user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrMFAAlreadyEnabled):
+			app.conflictRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	enrollment := TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// VerifyTOTP godoc
+//
+//	@Summary		Confirms TOTP enrollment
+//	@Description	Enables 2FA with a code from the authenticator app and returns the recovery codes. They are shown only once
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFACodePayload	true	"Code payload"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp/verify [POST]
+func (app *application) verifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	totp, err := app.store.MFA.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.badRequestError(w, r, errors.New("no two-factor enrollment started"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if totp.Confirmed {
+		app.conflictRequestError(w, r, store.ErrMFAAlreadyEnabled)
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequestError(w, r, errInvalidMFACode)
+		return
+	}
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = auth.NormalizeRecoveryCode(code)
+	}
+	err = app.store.MFA.ConfirmTOTP(r.Context(), user.ID, step, normalized)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrMFAAlreadyEnabled):
+			app.conflictRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, RecoveryCodesResponse{codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DisableTOTP godoc
+//
+//	@Summary		Disables TOTP
+//	@Description	Turns 2FA off, a current TOTP or recovery code is required
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFACodePayload	true	"Code payload"
+//	@Success		204		{string}	string			"2FA disabled"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mfa/totp [DELETE]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFACodePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if err := app.verifySecondFactor(r.Context(), user.ID, payload.Code); err != nil {
+		switch {
+		case errors.Is(err, errInvalidMFACode):
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.store.MFA.DeleteTOTP(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rijojohn85/social/internal/db/auth"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// totpStore keeps the enrollment of a single user.
+type totpStore struct {
+	store.MockMFAStore
+	totp          *store.TOTP
+	recoveryCodes []string
+}
+
+func (m *totpStore) CreateTOTP(ctx context.Context, userID int64, secret string) error {
+	if m.totp != nil && m.totp.Confirmed {
+		return store.ErrMFAAlreadyEnabled
+	}
+	m.totp = &store.TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *totpStore) GetTOTP(ctx context.Context, userID int64) (*store.TOTP, error) {
+	if m.totp == nil {
+		return nil, store.ErrorNotFound
+	}
+	totp := *m.totp
+	return &totp, nil
+}
+
+func (m *totpStore) ConfirmTOTP(ctx context.Context, userID int64, step int64, recoveryCodes []string) error {
+	m.totp.Confirmed = true
+	m.recoveryCodes = recoveryCodes
+	return nil
+}
+
+func (m *totpStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	i := slices.Index(m.recoveryCodes, code)
+	if i < 0 {
+		return store.ErrInvalidToken
+	}
+	m.recoveryCodes = slices.Delete(m.recoveryCodes, i, i+1)
+	return nil
+}
+
+func (m *totpStore) DeleteTOTP(ctx context.Context, userID int64) error {
+	m.totp = nil
+	m.recoveryCodes = nil
+	return nil
+}
+
+func TestTOTP(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.auth.token = tokenConfig{aud: "test-aud", exp: time.Minute, mfaExp: time.Minute}
+	app.authenticator = auth.NewJWTAuthenticator("secret", "test-aud", "test-aud")
+	user := store.User{ID: 1, Email: "gopher@example.com", IsActive: true}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+	app.store.Users = &mfaUserStore{user: user}
+	mfa := &totpStore{}
+	app.store.MFA = mfa
+	app.cacheStorage.Users = &uncachedUsers{}
+	mux := app.mount()
+
+	accessToken, err := app.authenticator.GenerateToken(jwt.MapClaims{
+		"sub": user.ID,
+		"sid": "session",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"iss": "test-aud",
+		"aud": "test-aud",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(t *testing.T, method, path, token, body string) (int, json.RawMessage) {
+		t.Helper()
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := executeRequest(t, req, mux)
+		var resp struct {
+			Data json.RawMessage `json:"data"`
+		}
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.Data
+	}
+	code := func(t *testing.T) string {
+		t.Helper()
+		code, err := auth.TOTPCode(mfa.totp.Secret, auth.TOTPStep(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	// seven digits never match a code
+	const wrongCode = `{"code":"1234567"}`
+
+	t.Run("should need a token to enroll", func(t *testing.T) {
+		got, _ := request(t, http.MethodPost, "/v1/users/me/mfa/totp", "", "")
+		checkStatus(t, got, http.StatusUnauthorized)
+	})
+	t.Run("should not verify before enrolling", func(t *testing.T) {
+		got, _ := request(t, http.MethodPost, "/v1/users/me/mfa/totp/verify", accessToken, wrongCode)
+		checkStatus(t, got, http.StatusBadRequest)
+	})
+	t.Run("should enroll", func(t *testing.T) {
+		got, data := request(t, http.MethodPost, "/v1/users/me/mfa/totp", accessToken, "")
+		checkStatus(t, got, http.StatusCreated)
+		var enrollment TOTPEnrollmentResponse
+		if err := json.Unmarshal(data, &enrollment); err != nil {
+			t.Fatal(err)
+		}
+		if enrollment.Secret == "" || enrollment.Secret != mfa.totp.Secret {
+			t.Errorf("got secret %q", enrollment.Secret)
+		}
+	})
+	t.Run("should refuse a wrong code on verify", func(t *testing.T) {
+		got, _ := request(t, http.MethodPost, "/v1/users/me/mfa/totp/verify", accessToken, wrongCode)
+		checkStatus(t, got, http.StatusBadRequest)
+	})
+	var recoveryCodes []string
+	t.Run("should verify and return recovery codes", func(t *testing.T) {
+		body := fmt.Sprintf(`{"code":%q}`, code(t))
+		got, data := request(t, http.MethodPost, "/v1/users/me/mfa/totp/verify", accessToken, body)
+		checkStatus(t, got, http.StatusOK)
+		var resp RecoveryCodesResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.RecoveryCodes) != recoveryCodeCount {
+			t.Fatalf("got %d recovery codes", len(resp.RecoveryCodes))
+		}
+		recoveryCodes = resp.RecoveryCodes
+	})
+	t.Run("should not enroll twice", func(t *testing.T) {
+		got, _ := request(t, http.MethodPost, "/v1/users/me/mfa/totp", accessToken, "")
+		checkStatus(t, got, http.StatusConflict)
+		got, _ = request(t, http.MethodPost, "/v1/users/me/mfa/totp/verify", accessToken, fmt.Sprintf(`{"code":%q}`, code(t)))
+		checkStatus(t, got, http.StatusConflict)
+	})
+
+	got, data := request(t, http.MethodPost, "/v1/authentication/token", "", `{"email":"gopher@example.com","password":"password"}`)
+	checkStatus(t, got, http.StatusOK)
+	var challenge MFAChallengeResponse
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"should need a code", fmt.Sprintf(`{"mfa_token":%q}`, challenge.MFAToken), http.StatusBadRequest},
+		{"should refuse an access token", fmt.Sprintf(`{"mfa_token":%q,"code":"123456"}`, accessToken), http.StatusUnauthorized},
+		{"should refuse a forged token", `{"mfa_token":"forged","code":"123456"}`, http.StatusUnauthorized},
+		{"should refuse a wrong code", fmt.Sprintf(`{"mfa_token":%q,"code":"1234567"}`, challenge.MFAToken), http.StatusUnauthorized},
+		{"should refuse an unknown recovery code", fmt.Sprintf(`{"mfa_token":%q,"code":"aaaaa-bbbbb"}`, challenge.MFAToken), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := request(t, http.MethodPost, "/v1/authentication/token/mfa", "", tt.body)
+			checkStatus(t, got, tt.want)
+		})
+	}
+	t.Run("should log in with a recovery code of digits", func(t *testing.T) {
+		mfa.recoveryCodes = append(mfa.recoveryCodes, "0123456789")
+		body := fmt.Sprintf(`{"mfa_token":%q,"code":"01234-56789"}`, challenge.MFAToken)
+		got, _ := request(t, http.MethodPost, "/v1/authentication/token/mfa", "", body)
+		checkStatus(t, got, http.StatusCreated)
+	})
+	t.Run("should log in with a recovery code once", func(t *testing.T) {
+		body := fmt.Sprintf(`{"mfa_token":%q,"code":%q}`, challenge.MFAToken, recoveryCodes[0])
+		got, _ := request(t, http.MethodPost, "/v1/authentication/token/mfa", "", body)
+		checkStatus(t, got, http.StatusCreated)
+		got, _ = request(t, http.MethodPost, "/v1/authentication/token/mfa", "", body)
+		checkStatus(t, got, http.StatusUnauthorized)
+	})
+
+	t.Run("should need a token to disable", func(t *testing.T) {
+		got, _ := request(t, http.MethodDelete, "/v1/users/me/mfa/totp", "", wrongCode)
+		checkStatus(t, got, http.StatusUnauthorized)
+	})
+	t.Run("should not disable with a wrong code", func(t *testing.T) {
+		got, _ := request(t, http.MethodDelete, "/v1/users/me/mfa/totp", accessToken, wrongCode)
+		checkStatus(t, got, http.StatusUnauthorized)
+	})
+	t.Run("should disable", func(t *testing.T) {
+		got, _ := request(t, http.MethodDelete, "/v1/users/me/mfa/totp", accessToken, fmt.Sprintf(`{"code":%q}`, code(t)))
+		checkStatus(t, got, http.StatusNoContent)
+		if mfa.totp != nil {
+			t.Error("got 2FA still on")
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,32 +14,6 @@ import (
 	"github.com/rijojohn85/social/internal/store"
 )
 
-func (app *application) CheckPostOwernship(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := r.Context().Value(userCtxKey).(*store.User)
-		post := r.Context().Value(postCtx).(*store.Post)
-		// if method is get or user is owner of post or method is patch and role is mod or
-		// role is admin continue
-		adminRole, err := app.store.Roles.GetIDByName(r.Context(), "admin")
-		if err != nil {
-			app.internalServerError(w, r, errors.New("Admin role not defined"))
-			return
-		}
-		modRole, err := app.store.Roles.GetIDByName(r.Context(), "moderator")
-		if err != nil {
-			app.internalServerError(w, r, errors.New("Moderator role not defined"))
-			return
-		}
-		if (r.Method == http.MethodGet || post.UserID == user.ID) ||
-			(r.Method == http.MethodPatch && user.RoleID == modRole.RoleID) ||
-			(user.RoleID == adminRole.RoleID) {
-			next.ServeHTTP(w, r)
-			return
-		}
-		app.forbiddenError(w, r, errors.New("unauthorizedError"))
-	})
-}
-
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -105,18 +80,60 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 		ctx := r.Context()
 
-		user := &store.User{}
-		err = app.getUser(ctx, user, userID)
+		sessionID, _ := claims["sid"].(string)
+		if sessionID == "" {
+			app.unauthorizedError(w, r, errors.New("missing session"))
+			return
+		}
+		user, err := app.activeSession(ctx, sessionID, userID)
 		if err != nil {
-			app.unauthorizedError(w, r, err)
+			if sessionEnded(err) {
+				app.unauthorizedError(w, r, err)
+			} else {
+				app.internalServerError(w, r, err)
+			}
 			return
 		}
 
 		ctx = context.WithValue(ctx, userCtxKey, user)
+		ctx = context.WithValue(ctx, sessionCtxKey, sessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// activeSession returns the user of the session unless the session was revoked
+// on logout or refresh token reuse, or the account was deactivated or deleted.
+// Event streams check it again while they are open.
+func (app *application) activeSession(ctx context.Context, sessionID string, userID int64) (*store.User, error) {
+	session, err := app.store.Sessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil {
+		return nil, store.ErrSessionRevoked
+	}
+	user := &store.User{}
+	if err := app.getUser(ctx, user, userID); err != nil {
+		return nil, err
+	}
+	if user.DeactivatedAt != nil {
+		return nil, errAccountDeactivated
+	}
+	if user.DeletedAt != nil {
+		return nil, errAccountDeleted
+	}
+	return user, nil
+}
+
+// sessionEnded tells the errors of activeSession that end the session from
+// failures to check it.
+func sessionEnded(err error) bool {
+	return errors.Is(err, store.ErrorNotFound) ||
+		errors.Is(err, store.ErrSessionRevoked) ||
+		errors.Is(err, errAccountDeactivated) ||
+		errors.Is(err, errAccountDeleted)
+}
+
 func (app *application) getUser(ctx context.Context, user *store.User, userID int64) error {
 	err := app.cacheStorage.Users.Get(ctx, user, userID)
 	if err == nil && user != nil {
@@ -133,3 +150,13 @@ func (app *application) getUser(ctx context.Context, user *store.User, userID in
 	app.logger.Info("Store data used")
 	return nil
 }
+
+// clientIP returns the address of the client without the port. RemoteAddr is
+// rewritten by the RealIP middleware when the API runs behind a proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
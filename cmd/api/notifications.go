@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// NotificationsPage is a page of notifications, next_cursor is empty on the
+// last page.
+type NotificationsPage struct {
+	Notifications []store.Notification `json:"notifications"`
+	NextCursor    string               `json:"next_cursor"`
+}
+
+type UnreadCountResponse struct {
+	Count int64 `json:"count"`
+}
+
+// ListNotifications godoc
+//
+//	@Summary		Lists notifications
+//	@Description	Lists the notifications of the current user, the newest first. Pass next_cursor as cursor to get the next page
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			unread	query		bool	false	"Only unread notifications"
+//	@Success		200		{object}	NotificationsPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [GET]
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	q := store.PaginatedNotificationQuery{Limit: 20}
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	notifications, err := app.store.Notifications.List(r.Context(), user.ID, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	page := NotificationsPage{Notifications: notifications}
+	if len(notifications) == q.Limit {
+		last := notifications[len(notifications)-1]
+		page.NextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UnreadNotifications godoc
+//
+//	@Summary		Counts unread notifications
+//	@Description	Counts the notifications of the current user that were not read yet
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	UnreadCountResponse
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/unread-count [GET]
+func (app *application) unreadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userCtxKey).(*store.User)
+	count, err := app.store.Notifications.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, UnreadCountResponse{Count: count}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// MarkNotificationRead godoc
+//
+//	@Summary	Marks a notification as read
+//	@Tags		notifications
+//	@Produce	json
+//	@Param		notificationID	path		int		true	"Notification ID"
+//	@Success	204				{string}	string	"Marked as read"
+//	@Failure	400				{object}	error
+//	@Failure	404				{object}	error
+//	@Failure	500				{object}	error
+//	@Security	ApiKeyAuth
+//	@Router		/notifications/{notificationID}/read [PUT]
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if err := app.store.Notifications.MarkRead(r.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAllNotificationsRead godoc
+//
+//	@Summary	Marks every notification as read
+//	@Tags		notifications
+//	@Produce	json
+//	@Success	204	{string}	string	"Marked as read"
+//	@Failure	500	{object}	error
+//	@Security	ApiKeyAuth
+//	@Router		/notifications/read [PUT]
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if _, err := app.store.Notifications.MarkAllRead(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNotificationPreferences godoc
+//
+//	@Summary		Gets notification preferences
+//	@Description	Tells for every notification type whether the current user gets it
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	store.NotificationPreferences
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [GET]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(userCtxKey).(*store.User)
+	prefs, err := app.store.Notifications.GetPreferences(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SetNotificationPreferences godoc
+//
+//	@Summary		Sets notification preferences
+//	@Description	Turns notification types on or off, types that are left out keep their setting
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		store.NotificationPreferences	true	"Types to turn on or off"
+//	@Success		200		{object}	store.NotificationPreferences
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [PUT]
+func (app *application) setNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload store.NotificationPreferences
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if err := app.store.Notifications.SetPreferences(r.Context(), user.ID, payload); err != nil {
+		switch {
+		case errors.Is(err, store.ErrUnknownNotificationType):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.getNotificationPreferencesHandler(w, r)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestNotifications(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	request := func(t *testing.T, method, path string, body io.Reader) *http.Request {
+		t.Helper()
+		req, err := http.NewRequest(method, path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return req
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"should list notifications", http.MethodGet, "/v1/notifications", "", http.StatusOK},
+		{"should list unread notifications", http.MethodGet, "/v1/notifications?unread=true", "", http.StatusOK},
+		{"should check the unread flag", http.MethodGet, "/v1/notifications?unread=maybe", "", http.StatusBadRequest},
+		{"should check the limit", http.MethodGet, "/v1/notifications?limit=101", "", http.StatusBadRequest},
+		{"should count unread notifications", http.MethodGet, "/v1/notifications/unread-count", "", http.StatusOK},
+		{"should mark all as read", http.MethodPut, "/v1/notifications/read", "", http.StatusNoContent},
+		{"should not mark a missing notification", http.MethodPut, "/v1/notifications/1/read", "", http.StatusNotFound},
+		{"should turn types off", http.MethodPut, "/v1/notifications/preferences", `{"reaction": false}`, http.StatusOK},
+		{"should refuse unknown types", http.MethodPut, "/v1/notifications/preferences", `{"poke": false}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := executeRequest(t, request(t, tt.method, tt.path, strings.NewReader(tt.body)), mux)
+			checkStatus(t, w.Code, tt.want)
+		})
+	}
+	t.Run("should return every preference", func(t *testing.T) {
+		w := executeRequest(t, request(t, http.MethodGet, "/v1/notifications/preferences", nil), mux)
+		checkStatus(t, w.Code, http.StatusOK)
+		var body struct {
+			Data store.NotificationPreferences `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		for _, kind := range store.NotificationTypes {
+			if _, ok := body.Data[kind]; !ok {
+				t.Errorf("missing %q in %v", kind, body.Data)
+			}
+		}
+	})
+}
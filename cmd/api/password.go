@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rijojohn85/social/internal/env"
+	"github.com/rijojohn85/social/internal/mailer"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// ForgotPassword godoc
+//
+//	@Summary		Request a password reset
+//	@Description	Emails a single use password reset link. The response is the same whether the account exists or not
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ForgotPasswordPayload	true	"Forgot password payload"
+//	@Success		202		{string}	string					"Reset email sent"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/password/forgot [POST]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	// never tell the client whether the email belongs to an account
+	const sent = "if the account exists a reset email was sent"
+
+	user, err := app.store.Users.GetUserByEmail(r.Context(), payload.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound), errors.Is(err, store.ErrEmailNotConfirmed):
+			if err := app.jsonResponse(w, http.StatusAccepted, sent); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+	err = app.store.Users.CreatePasswordReset(
+		r.Context(),
+		user.ID,
+		plainToken,
+		app.config.mail.resetExp,
+	)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.sendPasswordResetEmail(user, plainToken); err != nil {
+		// the client can ask again, failing here would leak that the account exists
+		app.logger.Errorw("Error sending password reset mail", "error", err, "user", user.ID)
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, sent); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) sendPasswordResetEmail(user *store.User, plainToken string) error {
+	domain := env.GetString("DOMAIN", "http://localhost:8080")
+	vars := struct {
+		Username string
+		ResetURL string
+		Expiry   string
+	}{
+		Username: user.Username,
+		ResetURL: fmt.Sprintf("%s/reset-password/%s", domain, plainToken),
+		Expiry:   app.config.mail.resetExp.String(),
+	}
+	isProdEnv := app.config.env == "production"
+	return app.mailer.Send(
+		mailer.PasswordResetTemplate,
+		user.Username,
+		user.Email,
+		vars,
+		!isProdEnv,
+	)
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset a password
+//	@Description	Sets a new password with a reset token and signs the user out everywhere
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResetPasswordPayload	true	"Reset password payload"
+//	@Success		200		{string}	string					"Password updated"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/password/reset [POST]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := &store.User{}
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	err := app.store.Users.ResetPassword(r.Context(), payload.Token, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidToken):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrTokenExpired):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, "password updated"); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
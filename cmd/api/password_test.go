@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/mailer"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// sentMail records the emails instead of sending them.
+type sentMail struct {
+	templates []string
+	to        []string
+}
+
+func (m *sentMail) Send(template, username, userEmail string, data any, isSandbox bool) error {
+	m.templates = append(m.templates, template)
+	m.to = append(m.to, userEmail)
+	return nil
+}
+
+// resetUserStore knows gopher@example.com and the reset token "valid".
+type resetUserStore struct {
+	store.MockUserStore
+}
+
+func (m *resetUserStore) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	if email != "gopher@example.com" {
+		return nil, store.ErrorNotFound
+	}
+	return &store.User{ID: 1, Username: "gopher", Email: email}, nil
+}
+
+func (m *resetUserStore) ResetPassword(ctx context.Context, token string, user *store.User) error {
+	switch token {
+	case "valid":
+		return nil
+	case "expired":
+		return store.ErrTokenExpired
+	default:
+		return store.ErrInvalidToken
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := NewTestApplication(t)
+	app.store.Users = &resetUserStore{}
+	mail := &sentMail{}
+	app.mailer = mail
+	mux := app.mount()
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"should refuse an invalid email", "/v1/authentication/password/forgot", `{"email":"gopher"}`, http.StatusBadRequest},
+		{"should accept an unknown email", "/v1/authentication/password/forgot", `{"email":"nobody@example.com"}`, http.StatusAccepted},
+		{"should accept a known email", "/v1/authentication/password/forgot", `{"email":"gopher@example.com"}`, http.StatusAccepted},
+		{"should need a token", "/v1/authentication/password/reset", `{"password":"secret"}`, http.StatusBadRequest},
+		{"should refuse a short password", "/v1/authentication/password/reset", `{"token":"valid","password":"ab"}`, http.StatusBadRequest},
+		{"should refuse an invalid token", "/v1/authentication/password/reset", `{"token":"guess","password":"secret"}`, http.StatusBadRequest},
+		{"should refuse an expired token", "/v1/authentication/password/reset", `{"token":"expired","password":"secret"}`, http.StatusBadRequest},
+		{"should reset the password", "/v1/authentication/password/reset", `{"token":"valid","password":"secret"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, executeRequest(t, req, mux).Code, tt.want)
+		})
+	}
+	t.Run("should only email known accounts", func(t *testing.T) {
+		if len(mail.to) != 1 || mail.to[0] != "gopher@example.com" || mail.templates[0] != mailer.PasswordResetTemplate {
+			t.Errorf("sent %v to %v", mail.templates, mail.to)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// permissionCache keeps the permissions of every role in memory so checking
+// them costs no query. It is reloaded after roles change and on an interval,
+// which picks up changes made through other instances.
+type permissionCache struct {
+	mu     sync.RWMutex
+	byRole map[int64]map[string]bool
+}
+
+func (c *permissionCache) set(roles []store.Role) {
+	byRole := make(map[int64]map[string]bool, len(roles))
+	for _, role := range roles {
+		permissions := make(map[string]bool, len(role.Permissions))
+		for _, p := range role.Permissions {
+			permissions[p] = true
+		}
+		byRole[role.RoleID] = permissions
+	}
+	c.mu.Lock()
+	c.byRole = byRole
+	c.mu.Unlock()
+}
+
+func (c *permissionCache) has(roleID int64, permission string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.byRole[roleID][permission]
+}
+
+func (app *application) loadPermissions(ctx context.Context) error {
+	roles, err := app.store.Roles.List(ctx)
+	if err != nil {
+		return err
+	}
+	app.permissions.set(roles)
+	return nil
+}
+
+// refreshPermissions reloads the permission cache until ctx is done.
+func (app *application) refreshPermissions(ctx context.Context) {
+	ticker := time.NewTicker(app.config.permissionsRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := app.loadPermissions(ctx); err != nil {
+			app.logger.Errorw("Reloading permissions failed", "error", err)
+		}
+	}
+}
+
+// resourceOwner returns the id of the user who owns the resource of a request.
+type resourceOwner func(r *http.Request) int64
+
+func postOwner(r *http.Request) int64 {
+	return r.Context().Value(postCtx).(*store.Post).UserID
+}
+
+// RequirePermission lets the request through when the role of the user grants
+// permission. With an owner, users may always act on their own resources and
+// only need the permission for the resources of others.
+func (app *application) RequirePermission(
+	permission string,
+	owner resourceOwner,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := r.Context().Value(userCtxKey).(*store.User)
+			if owner != nil && owner(r) == user.ID {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !app.permissions.has(user.RoleID, permission) {
+				app.forbiddenError(w, r, errors.New("missing permission "+permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestRequirePermission(t *testing.T) {
+	app := NewTestApplication(t)
+	post := &store.Post{ID: 1, UserID: 7}
+	handler := app.RequirePermission("posts:delete:any", postOwner)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+	deletePost := func(user *store.User) int {
+		req := httptest.NewRequest(http.MethodDelete, "/v1/posts/1", nil)
+		ctx := context.WithValue(req.Context(), userCtxKey, user)
+		ctx = context.WithValue(ctx, postCtx, post)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req.WithContext(ctx))
+		return w.Code
+	}
+	t.Run("should allow the owner", func(t *testing.T) {
+		checkStatus(t, deletePost(&store.User{ID: 7, RoleID: 1}), http.StatusNoContent)
+	})
+	t.Run("should forbid other users", func(t *testing.T) {
+		checkStatus(t, deletePost(&store.User{ID: 8, RoleID: 1}), http.StatusForbidden)
+	})
+	t.Run("should forbid roles without the permission", func(t *testing.T) {
+		checkStatus(t, deletePost(&store.User{ID: 8, RoleID: 2}), http.StatusForbidden)
+	})
+	t.Run("should allow roles with the permission", func(t *testing.T) {
+		checkStatus(t, deletePost(&store.User{ID: 8, RoleID: 3}), http.StatusNoContent)
+	})
+}
+
+func TestAdminRoutes(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	routes := []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/v1/admin/roles"},
+		{http.MethodGet, "/v1/admin/users"},
+		{http.MethodDelete, "/v1/admin/users/2"},
+	}
+	for _, route := range routes {
+		t.Run("should forbid "+route.method+" "+route.path+" to users", func(t *testing.T) {
+			req, err := http.NewRequest(route.method, route.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			w := executeRequest(t, req, mux)
+			checkStatus(t, w.Code, http.StatusForbidden)
+		})
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/content"
 	"github.com/rijojohn85/social/internal/store"
 )
 
@@ -18,18 +21,31 @@ type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
 	Tags    []string `json:"tags"`
+	// uploaded media to attach, see POST /media
+	MediaIDs []int64 `json:"media_ids" validate:"max=4,unique,dive,gte=1"`
+	// draft, scheduled or published, the default
+	Status string `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	// when a scheduled post goes out, only for scheduled posts
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type UpdatePostPayload struct {
 	Title   string   `json:"title" validate:"omitempty,max=100"`
 	Content string   `json:"content" validate:"omitempty,max=1000"`
 	Tags    []string `json:"tags"`
+	// replaces the attached media when set, detached media is deleted later
+	MediaIDs *[]int64 `json:"media_ids" validate:"omitempty,max=4,unique,dive,gte=1"`
+	// published posts can't go back to drafts or be scheduled
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 // CreatePost godoc
 //
 //	@Summary		Creates post
-//	@Description	Creates a post with payload
+//	@Description	Creates a post with payload. Hashtags in the content are added to the tags and mentioned users are notified.
+//	@Description	Up to 4 media uploaded by the user can be attached with media_ids.
+//	@Description	Drafts are only seen by their author, scheduled posts go out at publish_at
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -52,20 +68,46 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	}
 	if err := Validate.Struct(payload); err != nil {
 		app.badRequestError(w, r, err)
+		return
+	}
+	if payload.Status == "" {
+		payload.Status = store.PostPublished
+	}
+	if err := checkSchedule(payload.Status, payload.PublishAt); err != nil {
+		app.badRequestError(w, r, err)
+		return
 	}
 	user := r.Context().Value(userCtxKey).(*store.User)
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		UserID:  user.ID,
-		Tags:    payload.Tags,
+		Title:    payload.Title,
+		Content:  payload.Content,
+		UserID:   user.ID,
+		Tags:     content.MergeTags(payload.Tags, content.Hashtags(payload.Content)),
+		MediaIDs: payload.MediaIDs,
+		Status:   payload.Status,
+	}
+	if payload.PublishAt != nil {
+		publishAt := payload.PublishAt.Format(time.RFC3339)
+		post.PublishAt = &publishAt
+	}
+	if post.MediaIDs == nil {
+		post.MediaIDs = []int64{}
 	}
 	ctx := r.Context()
 	if err := app.store.Posts.Create(
 		ctx,
 		post,
 	); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrMediaNotFound):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if post.Status == store.PostPublished {
+		app.postPublished(*post)
 	}
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -75,7 +117,8 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // UpdatePost godoc
 //
 //	@Summary		Updates post
-//	@Description	Updates a post with payload
+//	@Description	Updates a post with payload. Tags follow the hashtags of the new content, newly mentioned users are notified.
+//	@Description	Drafts and scheduled posts can be rescheduled or published, published posts stay published
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -84,6 +127,7 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 //	@Success		201		{object}	store.Post
 //	@Failure		400		{object}	error
 //	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"The post changed meanwhile"
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{postID} [patch]
@@ -97,21 +141,70 @@ func (app *application) patchPostHandler(w http.ResponseWriter, r *http.Request)
 	}
 	if err := Validate.Struct(payload); err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
-	if payload.Content != "" {
-		post.Content = payload.Content
+	wasPublished := post.Status == store.PostPublished
+	status := post.Status
+	if payload.Status != "" {
+		status = payload.Status
+	}
+	if wasPublished && status != store.PostPublished {
+		app.badRequestError(w, r, errors.New("published posts can't be unpublished"))
+		return
+	}
+	// a post that stays scheduled keeps its time unless a new one is given
+	if payload.PublishAt != nil || (status == store.PostScheduled && post.Status != store.PostScheduled) {
+		if err := checkSchedule(status, payload.PublishAt); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
 	}
+	// hashtags of the old content go with it unless the tags are replaced
+	tags := post.Tags
 	if payload.Tags != nil {
-		post.Tags = payload.Tags
+		tags = payload.Tags
+	} else if payload.Content != "" {
+		oldHashtags := content.Hashtags(post.Content)
+		tags = slices.DeleteFunc(slices.Clone(tags), func(tag string) bool {
+			return slices.Contains(oldHashtags, content.NormalizeTag(tag))
+		})
+	}
+	if payload.Content != "" {
+		post.Content = payload.Content
 	}
+	post.Tags = content.MergeTags(tags, content.Hashtags(post.Content))
 	if payload.Title != "" {
 		post.Title = payload.Title
 	}
+	if payload.MediaIDs != nil {
+		post.MediaIDs = *payload.MediaIDs
+	}
+	post.Status = status
+	switch {
+	case payload.PublishAt != nil:
+		publishAt := payload.PublishAt.Format(time.RFC3339)
+		post.PublishAt = &publishAt
+	case status == store.PostDraft:
+		post.PublishAt = nil
+	}
 	ctx := r.Context()
 	if err := app.store.Posts.Update(ctx, post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrMediaNotFound):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrorNotFound):
+			app.conflictRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
+	switch {
+	case !wasPublished && post.Status == store.PostPublished:
+		app.postPublished(*post)
+	case wasPublished && payload.Content != "":
+		go app.mentionInPost(*post)
+	}
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -140,6 +233,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
 	ctx := r.Context()
 	if err := app.store.Posts.Delete(
@@ -157,13 +251,14 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 	}
+	go app.removeFromTimelines(*getPostFromContext(r))
 	w.WriteHeader(http.StatusOK)
 }
 
 // GetPost godoc
 //
 //	@Summary		Gets post
-//	@Description	Gets a post with id
+//	@Description	Gets a post with id and its newest comments
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
@@ -177,21 +272,68 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	post := getPostFromContext(r)
+	// only the newest comments, the rest are paged through /comments
+	user := r.Context().Value(userCtxKey).(*store.User)
 	comments, err := app.store.Comments.GetByPostID(
 		ctx,
 		post.ID,
+		user.ID,
+		store.PaginatedCommentQuery{Limit: 20},
 	)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 	post.Comments = comments
+	kind, err := app.store.Reactions.Get(ctx, post.ID, user.ID)
+	switch {
+	case err == nil:
+		post.ViewerReaction = &kind
+	case !errors.Is(err, store.ErrorNotFound):
+		app.internalServerError(w, r, err)
+		return
+	}
 
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+// ListDrafts godoc
+//
+//	@Summary		Lists drafts
+//	@Description	Lists the drafts and scheduled posts of the current user, the scheduled ones first in the order they go out
+//	@Tags			posts
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.Post
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/drafts [GET]
+func (app *application) listDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	dq := store.PaginatedDraftQuery{Limit: 20}
+	dq, err := dq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(dq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	user := r.Context().Value(userCtxKey).(*store.User)
+	posts, err := app.store.Posts.GetDrafts(r.Context(), user.ID, dq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -215,12 +357,59 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 					return
 				}
 			}
+			viewer := ctx.Value(userCtxKey).(*store.User)
+			visible, err := app.canViewPost(ctx, viewer, post)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !visible {
+				app.notFoundError(w, r, store.ErrorNotFound)
+				return
+			}
 			ctx = context.WithValue(r.Context(), postCtx, post)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		},
 	)
 }
 
+// canViewPost tells if the viewer may see the post. Drafts and scheduled
+// posts are only shown to their author, the posts of private accounts only to
+// their followers and to moderators.
+func (app *application) canViewPost(ctx context.Context, viewer *store.User, post *store.Post) (bool, error) {
+	if post.UserID == viewer.ID {
+		return true, nil
+	}
+	if post.Status != store.PostPublished {
+		return false, nil
+	}
+	if app.permissions.has(viewer.RoleID, "posts:delete:any") {
+		return true, nil
+	}
+	author := &store.User{}
+	if err := app.getUser(ctx, author, post.UserID); err != nil {
+		return false, err
+	}
+	if !author.IsPrivate {
+		return true, nil
+	}
+	return app.store.Users.IsFollowing(ctx, viewer.ID, post.UserID)
+}
+
+// checkSchedule checks that scheduled posts, and only those, are given a
+// publish time in the future.
+func checkSchedule(status string, publishAt *time.Time) error {
+	switch {
+	case status != store.PostScheduled && publishAt != nil:
+		return errors.New("publish_at is only for scheduled posts")
+	case status == store.PostScheduled && publishAt == nil:
+		return errors.New("publish_at is required for scheduled posts")
+	case status == store.PostScheduled && !publishAt.After(time.Now()):
+		return errors.New("publish_at has to be in the future")
+	}
+	return nil
+}
+
 func getPostFromContext(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestPostStatus(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"should publish by default", `{"title": "t", "content": "c"}`, http.StatusCreated},
+		{"should create a draft", `{"title": "t", "content": "c", "status": "draft"}`, http.StatusCreated},
+		{"should schedule a post", fmt.Sprintf(`{"title": "t", "content": "c", "status": "scheduled", "publish_at": %q}`, future), http.StatusCreated},
+		{"should refuse an unknown status", `{"title": "t", "content": "c", "status": "hidden"}`, http.StatusBadRequest},
+		{"should need publish_at to schedule", `{"title": "t", "content": "c", "status": "scheduled"}`, http.StatusBadRequest},
+		{"should refuse scheduling in the past", fmt.Sprintf(`{"title": "t", "content": "c", "status": "scheduled", "publish_at": %q}`, past), http.StatusBadRequest},
+		{"should refuse publish_at for drafts", fmt.Sprintf(`{"title": "t", "content": "c", "status": "draft", "publish_at": %q}`, future), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			w := executeRequest(t, req, mux)
+			checkStatus(t, w.Code, tt.want)
+		})
+	}
+	t.Run("should list drafts", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/drafts?limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusOK)
+	})
+}
+
+func TestCanViewPost(t *testing.T) {
+	app := NewTestApplication(t)
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		status string
+		viewer *store.User
+		want   bool
+	}{
+		{"should show drafts to their author", store.PostDraft, &store.User{ID: 7, RoleID: 1}, true},
+		{"should hide drafts from others", store.PostDraft, &store.User{ID: 8, RoleID: 1}, false},
+		{"should hide drafts from moderators", store.PostDraft, &store.User{ID: 8, RoleID: 3}, false},
+		{"should hide scheduled posts", store.PostScheduled, &store.User{ID: 8, RoleID: 1}, false},
+		{"should show published posts", store.PostPublished, &store.User{ID: 8, RoleID: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &store.Post{ID: 1, UserID: 7, Status: tt.status}
+			got, err := app.canViewPost(ctx, tt.viewer, post)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// FollowsPage is a page of a followers or following list, next_cursor is empty
+// on the last page.
+type FollowsPage struct {
+	Users      []store.FollowUser `json:"users"`
+	NextCursor string             `json:"next_cursor"`
+}
+
+// ListFollowers godoc
+//
+//	@Summary		Lists the followers of a user
+//	@Description	Lists the users following a user, the newest follow first
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	FollowsPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/followers [GET]
+func (app *application) listFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Users.ListFollowers)
+}
+
+// ListFollowing godoc
+//
+//	@Summary		Lists who a user follows
+//	@Description	Lists the users a user follows, the newest follow first
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Success		200		{object}	FollowsPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/following [GET]
+func (app *application) listFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Users.ListFollowing)
+}
+
+func (app *application) listFollows(
+	w http.ResponseWriter,
+	r *http.Request,
+	list func(ctx context.Context, userID int64, q store.PaginatedFollowQuery) ([]store.FollowUser, error),
+) {
+	user, ok := app.profileUser(w, r)
+	if !ok {
+		return
+	}
+	q := store.PaginatedFollowQuery{Limit: 20}
+	q, err := q.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	users, err := list(r.Context(), user.ID, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	page := FollowsPage{Users: users}
+	if len(users) == q.Limit {
+		last := users[len(users)-1]
+		page.NextCursor = store.Cursor{CreatedAt: last.FollowedAt, ID: last.ID}.Encode()
+	}
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ListUserPosts godoc
+//
+//	@Summary		Lists the posts of a user
+//	@Description	Lists the posts of a user, paged and filtered like the feed. The posts of private accounts are only listed for their followers
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Comma separated tags, posts with any of them match"
+//	@Param			search	query		string	false	"Search"
+//	@Param			since	query		string	false	"Only posts created at or after this RFC3339 time"
+//	@Param			until	query		string	false	"Only posts created before this RFC3339 time"
+//	@Success		200		{object}	FeedPage
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/posts [GET]
+func (app *application) listUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.profileUser(w, r)
+	if !ok {
+		return
+	}
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	viewer := r.Context().Value(userCtxKey).(*store.User)
+	posts, err := app.store.Posts.GetUserPosts(r.Context(), viewer.ID, user.ID, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, newFeedPage(posts, fq)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// profileUser reads the user whose profile is looked at, deactivated and
+// deleted accounts are not found.
+func (app *application) profileUser(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return nil, false
+	}
+	user := &store.User{}
+	if err := app.getUser(r.Context(), user, userID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	if user.DeactivatedAt != nil || user.DeletedAt != nil {
+		app.notFoundError(w, r, store.ErrorNotFound)
+		return nil, false
+	}
+	user.ID = userID
+	return user, true
+}
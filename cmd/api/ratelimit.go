@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// defaultRateLimits are the route limits used when RATE_LIMIT_<NAME> is not
+// set. An empty RATE_LIMIT_<NAME> turns the limit off.
+var defaultRateLimits = map[string]string{
+	// every request, per IP
+	"global": "300/1m",
+	// login, registration, password and activation mails, per IP
+	"auth": "10/1m",
+	// authenticated requests, per user
+	"user": "120/1m:token-bucket",
+	// creating posts and comments, per user
+	"write": "20/1m:token-bucket",
+}
+
+// RateLimitMiddleware applies the limit configured under name. Behind
+// AuthTokenMiddleware requests are counted per user, elsewhere per client IP.
+func (app *application) RateLimitMiddleware(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit, ok := app.config.rateLimit.routes[name]
+			if !app.config.rateLimit.enabled || app.rateLimiter == nil || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := name + ":ip:" + clientIP(r)
+			if user, ok := r.Context().Value(userCtxKey).(*store.User); ok {
+				key = fmt.Sprintf("%s:user:%d", name, user.ID)
+			}
+
+			result, err := app.rateLimiter.Allow(r.Context(), key, limit)
+			if err != nil {
+				// an unavailable backend should not take the API down with it
+				app.logger.Errorw("rate limiter failed", "key", key, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			w.Header().Set(
+				"RateLimit-Policy",
+				fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)),
+			)
+			if !result.Allowed {
+				app.rateLimitExceededResponse(w, r, result.RetryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	app := NewTestApplication(t)
+	app.rateLimiter = ratelimit.NewMemoryLimiter()
+	app.config.rateLimit = rateLimitConfig{
+		enabled: true,
+		routes: map[string]ratelimit.Limit{
+			"user": {Requests: 2, Period: time.Minute, Algorithm: ratelimit.FixedWindow},
+		},
+	}
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	getUser := func() *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return req
+	}
+	t.Run("should report the remaining quota", func(t *testing.T) {
+		w := executeRequest(t, getUser(), mux)
+		checkStatus(t, w.Code, http.StatusOK)
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("got RateLimit-Limit %q, wanted 2", got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != "1" {
+			t.Errorf("got RateLimit-Remaining %q, wanted 1", got)
+		}
+	})
+	t.Run("should reject requests over the quota", func(t *testing.T) {
+		checkStatus(t, executeRequest(t, getUser(), mux).Code, http.StatusOK)
+		w := executeRequest(t, getUser(), mux)
+		checkStatus(t, w.Code, http.StatusTooManyRequests)
+		if w.Header().Get("Retry-After") == "" {
+			t.Error("got no Retry-After header")
+		}
+	})
+	t.Run("should not limit routes without a configured limit", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusOK)
+		if got := w.Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("got RateLimit-Limit %q, wanted none", got)
+		}
+	})
+}
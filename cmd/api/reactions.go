@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+type ReactionPayload struct {
+	// one of store.ReactionKinds
+	Kind string `json:"kind" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+type ReactionsResponse struct {
+	Reactions      store.ReactionCounts `json:"reactions"`
+	ViewerReaction *string              `json:"viewer_reaction"`
+}
+
+// SetReaction godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Leaves a reaction on a post, replacing the earlier reaction of the user
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int				true	"postID"
+//	@Param			payload	body		ReactionPayload	true	"Reaction"
+//	@Success		200		{object}	ReactionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error	"Blocked by or blocking the author"
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions [put]
+func (app *application) setReactionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ReactionPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	post := getPostFromContext(r)
+	user := r.Context().Value(userCtxKey).(*store.User)
+	if !app.checkNotBlocked(w, r, user.ID, post.UserID) {
+		return
+	}
+	counts, created, err := app.store.Reactions.Set(r.Context(), post.ID, user.ID, payload.Kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	// changing the kind of a reaction is not worth another notification
+	if created {
+		go app.notifications.Reaction(*post, user.ID)
+	}
+	response := ReactionsResponse{Reactions: counts, ViewerReaction: &payload.Kind}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteReaction godoc
+//
+//	@Summary		Takes back a reaction
+//	@Description	Removes the reaction of the user from a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int	true	"postID"
+//	@Success		200		{object}	ReactionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions [delete]
+func (app *application) deleteReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromContext(r)
+	user := r.Context().Value(userCtxKey).(*store.User)
+	counts, err := app.store.Reactions.Delete(r.Context(), post.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, ReactionsResponse{Reactions: counts}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
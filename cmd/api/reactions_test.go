@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/notifications"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestReactions(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	react := func(method, body string) int {
+		req, err := http.NewRequest(method, "/v1/posts/1/reactions", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(t, req, mux).Code
+	}
+	t.Run("should reject unknown kinds", func(t *testing.T) {
+		checkStatus(t, react(http.MethodPut, `{"kind":"meh"}`), http.StatusBadRequest)
+	})
+	t.Run("should react to a post", func(t *testing.T) {
+		checkStatus(t, react(http.MethodPut, `{"kind":"love"}`), http.StatusOK)
+	})
+	t.Run("should not find a missing reaction", func(t *testing.T) {
+		checkStatus(t, react(http.MethodDelete, ``), http.StatusNotFound)
+	})
+}
+
+// changedReactions remembers the kind the viewer reacted with.
+type changedReactions struct {
+	store.MockReactionStore
+	kind string
+}
+
+func (m *changedReactions) Set(_ context.Context, _, _ int64, kind string) (store.ReactionCounts, bool, error) {
+	created := m.kind == ""
+	m.kind = kind
+	return store.ReactionCounts{kind: 1}, created, nil
+}
+
+// sentNotifications hands the stored notifications to the test.
+type sentNotifications struct {
+	store.MockNotificationStore
+	sent chan store.Notification
+}
+
+func (m *sentNotifications) Create(_ context.Context, n *store.Notification) (bool, error) {
+	m.sent <- *n
+	return true, nil
+}
+
+func TestReactionNotifications(t *testing.T) {
+	app := NewTestApplication(t)
+	app.store.Reactions = &changedReactions{}
+	sent := &sentNotifications{sent: make(chan store.Notification, 10)}
+	app.notifications = notifications.NewService(sent, app.events, app.logger)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	for _, kind := range []string{"like", "love", "wow"} {
+		req, err := http.NewRequest(http.MethodPut, "/v1/posts/1/reactions", strings.NewReader(`{"kind":"`+kind+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		checkStatus(t, executeRequest(t, req, mux).Code, http.StatusOK)
+	}
+	select {
+	case n := <-sent.sent:
+		if n.Type != store.NotificationReaction {
+			t.Errorf("got a %q notification", n.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("got no notification for the new reaction")
+	}
+	select {
+	case <-sent.sent:
+		t.Error("got a notification for a changed reaction")
+	case <-time.After(time.Millisecond * 50):
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+const manageRolesPermission = "roles:manage"
+
+type CreateRolePayload struct {
+	Name        string   `json:"name" validate:"required,max=255"`
+	Level       int      `json:"level" validate:"required,min=1"`
+	Description string   `json:"description" validate:"required,max=1000"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateRolePayload struct {
+	Level       int    `json:"level" validate:"required,min=1"`
+	Description string `json:"description" validate:"required,max=1000"`
+}
+
+type RolePermissionsPayload struct {
+	Permissions []string `json:"permissions" validate:"required"`
+}
+
+// ListRoles godoc
+//
+//	@Summary		Lists roles
+//	@Description	Lists every role with its permissions
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.Role
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [GET]
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ListPermissions godoc
+//
+//	@Summary		Lists permissions
+//	@Description	Lists the permissions roles can be granted
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.Permission
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/permissions [GET]
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.store.Roles.ListPermissions(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, permissions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// CreateRole godoc
+//
+//	@Summary		Creates a role
+//	@Description	Creates a role with the given permissions
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateRolePayload	true	"Role"
+//	@Success		201		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [POST]
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	role := &store.Role{
+		RoleName:    payload.Name,
+		Level:       payload.Level,
+		Description: payload.Description,
+		Permissions: payload.Permissions,
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	if err := app.store.Roles.Create(r.Context(), role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateRole):
+			app.conflictRequestError(w, r, err)
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.reloadPermissions(r)
+	if err := app.jsonResponse(w, http.StatusCreated, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateRole godoc
+//
+//	@Summary		Updates a role
+//	@Description	Changes the level and description of a role
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleID	path		int					true	"Role ID"
+//	@Param			payload	body		UpdateRolePayload	true	"Role"
+//	@Success		200		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleID} [PUT]
+func (app *application) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	var payload UpdateRolePayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	role := &store.Role{
+		RoleID:      id,
+		Level:       payload.Level,
+		Description: payload.Description,
+	}
+	if err := app.store.Roles.Update(r.Context(), role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SetRolePermissions godoc
+//
+//	@Summary		Sets the permissions of a role
+//	@Description	Replaces the permissions of a role. Admins can't take roles:manage from their own role.
+//	@Tags			admin
+//	@Accept			json
+//	@Param			roleID	path	int						true	"Role ID"
+//	@Param			payload	body	RolePermissionsPayload	true	"Permissions"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleID}/permissions [PUT]
+func (app *application) setRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	var payload RolePermissionsPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	admin := r.Context().Value(userCtxKey).(*store.User)
+	if id == admin.RoleID && !slices.Contains(payload.Permissions, manageRolesPermission) {
+		app.conflictRequestError(
+			w,
+			r,
+			errors.New("removing "+manageRolesPermission+" from your own role would lock you out"),
+		)
+		return
+	}
+	if err := app.store.Roles.SetPermissions(r.Context(), id, payload.Permissions); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrUnknownPermission):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.reloadPermissions(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteRole godoc
+//
+//	@Summary		Deletes a role
+//	@Description	Deletes a role that is not assigned to any user
+//	@Tags			admin
+//	@Param			roleID	path	int	true	"Role ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleID} [DELETE]
+func (app *application) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := app.store.Roles.Delete(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrRoleInUse):
+			app.conflictRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.reloadPermissions(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadPermissions refreshes the cache after a change. Failing only delays
+// the change until the next periodic reload, so the request still succeeds.
+func (app *application) reloadPermissions(r *http.Request) {
+	if err := app.loadPermissions(r.Context()); err != nil {
+		app.logger.Errorw("Reloading permissions failed", "error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// publishScheduledPosts publishes scheduled posts once their time has come.
+// Every replica runs it, PublishDue makes sure each post is published once.
+// It runs until ctx is done.
+func (app *application) publishScheduledPosts(ctx context.Context) {
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+	for {
+		app.publishDuePosts(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) publishDuePosts(ctx context.Context) {
+	for {
+		posts, err := app.store.Posts.PublishDue(ctx, app.config.scheduler.batch)
+		if err != nil {
+			app.logger.Errorw("Publishing scheduled posts failed", "error", err)
+			return
+		}
+		for _, post := range posts {
+			app.postPublished(post)
+		}
+		if len(posts) > 0 {
+			app.logger.Infow("Published scheduled posts", "count", len(posts))
+		}
+		if len(posts) < app.config.scheduler.batch {
+			return
+		}
+	}
+}
+
+// postPublished pushes a post that just went out to the timelines and
+// streams of the followers of its author and notifies the users it mentions.
+func (app *application) postPublished(post store.Post) {
+	go app.fanOutPost(post)
+	go app.publishPost(post)
+	go app.mentionInPost(post)
+}
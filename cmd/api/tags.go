@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rijojohn85/social/internal/content"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// TrendingTagsQuery picks the window trending tags are counted over.
+type TrendingTagsQuery struct {
+	Window time.Duration `validate:"min=1h,max=168h"`
+	Limit  int           `validate:"gte=1,lte=50"`
+}
+
+// ListTagPosts godoc
+//
+//	@Summary		Lists the posts with a tag
+//	@Description	Lists the posts tagged with the tag, paged and filtered like the feed. The tag is matched normalized, without # and lowercase
+//	@Tags			tags
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			search	query		string	false	"Search"
+//	@Param			since	query		string	false	"Only posts created at or after this RFC3339 time"
+//	@Param			until	query		string	false	"Only posts created before this RFC3339 time"
+//	@Success		200		{object}	FeedPage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/posts [GET]
+func (app *application) listTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag := content.NormalizeTag(chi.URLParam(r, "tag"))
+	if tag == "" {
+		app.badRequestError(w, r, errors.New("invalid tag"))
+		return
+	}
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	viewer := r.Context().Value(userCtxKey).(*store.User)
+	posts, err := app.store.Posts.GetTagPosts(r.Context(), viewer.ID, tag, fq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, newFeedPage(posts, fq)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// TrendingTags godoc
+//
+//	@Summary		Lists trending tags
+//	@Description	Lists the tags used by the most public posts of the last window, the most used first
+//	@Tags			tags
+//	@Produce		json
+//	@Param			window	query		string	false	"Window like 6h, from 1h to 168h, default 24h"
+//	@Param			limit	query		int		false	"Limit, up to 50, default 10"
+//	@Success		200		{array}		store.TrendingTag
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/tags/trending [GET]
+func (app *application) trendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	q := TrendingTagsQuery{Window: time.Hour * 24, Limit: 10}
+	qs := r.URL.Query()
+	if window := qs.Get("window"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		q.Window = d
+	}
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		q.Limit = l
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	tags, err := app.store.Posts.TrendingTags(r.Context(), time.Now().Add(-q.Window), q.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
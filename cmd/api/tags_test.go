@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestTags(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"should list trending tags", "/v1/tags/trending", http.StatusOK},
+		{"should take a window", "/v1/tags/trending?window=6h&limit=5", http.StatusOK},
+		{"should refuse a short window", "/v1/tags/trending?window=30m", http.StatusBadRequest},
+		{"should refuse an invalid window", "/v1/tags/trending?window=day", http.StatusBadRequest},
+		{"should check the limit", "/v1/tags/trending?limit=51", http.StatusBadRequest},
+		{"should list the posts with a tag", "/v1/tags/Go/posts", http.StatusOK},
+		{"should refuse an empty tag", "/v1/tags/%23/posts", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			w := executeRequest(t, req, mux)
+			checkStatus(t, w.Code, tt.want)
+		})
+	}
+	t.Run("should merge hashtags into the tags", func(t *testing.T) {
+		body := `{"title": "gophers", "content": "I like #Go and #gophers", "tags": ["go", "Rust"]}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusCreated)
+		var resp struct {
+			Data store.Post `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"go", "rust", "gophers"}; !slices.Equal(resp.Data.Tags, want) {
+			t.Errorf("got tags %v, wanted %v", resp.Data.Tags, want)
+		}
+	})
+}
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/rijojohn85/social/internal/blob"
 	"github.com/rijojohn85/social/internal/db/auth"
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/lockout"
+	"github.com/rijojohn85/social/internal/notifications"
 	"github.com/rijojohn85/social/internal/store"
 	"github.com/rijojohn85/social/internal/store/cache"
 	"go.uber.org/zap"
 )
 
+var testLockoutConfig = lockout.Config{
+	FreeAttempts:    2,
+	BaseDelay:       time.Minute,
+	MaxDelay:        time.Minute,
+	MaxAttempts:     5,
+	LockoutDuration: time.Minute * 15,
+	Window:          time.Hour,
+}
+
 func NewTestApplication(t *testing.T) *application {
 	t.Helper()
 
@@ -18,12 +33,30 @@ func NewTestApplication(t *testing.T) *application {
 	mockStore := store.NewMockStore()
 	mockCache := cache.NewMockCache()
 	mockAuth := auth.NewTestAuthenticator("hello world")
+	lockoutBackend := lockout.NewMemoryBackend()
+	broker := events.NewMemoryBroker(events.NewHub(10), 10)
 
 	app := application{
 		logger:        logger,
 		store:         mockStore,
 		cacheStorage:  mockCache,
 		authenticator: mockAuth,
+		loginGuards: loginGuards{
+			email: lockout.NewGuard(lockoutBackend, testLockoutConfig),
+			ip:    lockout.NewGuard(lockoutBackend, testLockoutConfig),
+		},
+		permissions:   &permissionCache{},
+		notifications: notifications.NewService(mockStore.Notifications, broker, logger),
+		events:        broker,
+		blobs:         blob.NewLocalStorage(t.TempDir()),
+		config: config{
+			requestTimeout: time.Minute,
+			events:         eventsConfig{heartbeat: time.Second * 15},
+			media:          mediaConfig{maxSize: 1 << 20, thumbnailSize: 64},
+		},
+	}
+	if err := app.loadPermissions(context.Background()); err != nil {
+		t.Fatal(err)
 	}
 	return &app
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+	"github.com/rijojohn85/social/internal/store/cache"
+)
+
+// fanOutTimeout bounds pushing a post onto the timelines of the followers.
+const fanOutTimeout = time.Second * 30
+
+// homeTimeline reads a page of the feed. Plain pages of the newest posts come
+// from the timeline cache when it is enabled, everything else and pages past
+// the end of the cache come from the database.
+func (app *application) homeTimeline(
+	ctx context.Context,
+	userID int64,
+	fq store.PaginatedFeedQuery,
+) ([]store.UserFeed, error) {
+	if app.config.timeline.enabled && timelineCacheable(fq) {
+		posts, err := app.cachedTimeline(ctx, userID, fq)
+		switch {
+		case err != nil:
+			app.logger.Errorw("Error reading timeline cache", "error", err, "user", userID)
+		case len(posts) == fq.Limit:
+			return posts, nil
+		}
+	}
+	return app.store.Posts.GetUserFeed(ctx, userID, fq)
+}
+
+// timelineCacheable tells if the cache can answer the query, it only holds
+// the newest posts without any filter.
+func timelineCacheable(fq store.PaginatedFeedQuery) bool {
+	if fq.Sort != "desc" || fq.Offset != 0 || fq.Search != "" || len(fq.Tags) != 0 ||
+		fq.Since != nil || fq.Until != nil {
+		return false
+	}
+	if fq.Cursor != "" {
+		c, err := store.DecodeCursor(fq.Cursor)
+		return err == nil && !c.Prev
+	}
+	return true
+}
+
+// cachedTimeline reads a page from the cached timeline of the user, merged
+// with the posts of followed authors that are too big to fan out. It returns a
+// short page when the cache runs out.
+func (app *application) cachedTimeline(
+	ctx context.Context,
+	userID int64,
+	fq store.PaginatedFeedQuery,
+) ([]store.UserFeed, error) {
+	var before store.Cursor
+	if fq.Cursor != "" {
+		var err error
+		if before, err = store.DecodeCursor(fq.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	entries, err := app.cacheStorage.Timelines.Get(ctx, userID, before, fq.Limit)
+	if errors.Is(err, cache.ErrNotCached) {
+		if err := app.fillTimeline(ctx, userID); err != nil {
+			return nil, err
+		}
+		entries, err = app.cacheStorage.Timelines.Get(ctx, userID, before, fq.Limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) < fq.Limit {
+		return nil, nil
+	}
+	pulled, err := app.store.Posts.GetTimelineEntries(
+		ctx,
+		userID,
+		before,
+		fq.Limit,
+		app.config.timeline.fanoutLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return app.store.Posts.GetFeedByIDs(ctx, userID, mergeTimeline(fq.Limit, entries, pulled))
+}
+
+func (app *application) fillTimeline(ctx context.Context, userID int64) error {
+	entries, err := app.store.Posts.GetTimelineEntries(
+		ctx,
+		userID,
+		store.Cursor{},
+		app.config.timeline.size,
+		0,
+	)
+	if err != nil {
+		return err
+	}
+	return app.cacheStorage.Timelines.Fill(ctx, userID, entries)
+}
+
+// mergeTimeline returns the ids of the newest limit posts of the timelines,
+// each post once.
+func mergeTimeline(limit int, timelines ...[]store.TimelineEntry) []int64 {
+	var entries []store.TimelineEntry
+	for _, timeline := range timelines {
+		entries = append(entries, timeline...)
+	}
+	slices.SortFunc(entries, func(a, b store.TimelineEntry) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.PostID, a.PostID)
+	})
+	// the same post is not always next to itself, the timelines may disagree on
+	// when it was created
+	seen := map[int64]bool{}
+	ids := []int64{}
+	for _, entry := range entries {
+		if len(ids) == limit {
+			break
+		}
+		if seen[entry.PostID] {
+			continue
+		}
+		seen[entry.PostID] = true
+		ids = append(ids, entry.PostID)
+	}
+	return ids
+}
+
+// timelineAudience returns the users whose cached timelines get the posts of
+// the author. Followers of authors with more than fanoutLimit followers pull
+// them in when they read their timeline instead.
+func (app *application) timelineAudience(ctx context.Context, authorID int64) ([]int64, error) {
+	followers, err := app.store.Users.GetFollowerIDs(ctx, authorID, app.config.timeline.fanoutLimit)
+	if err != nil && !errors.Is(err, store.ErrTooManyFollowers) {
+		return nil, err
+	}
+	return append(followers, authorID), nil
+}
+
+// fanOutPost pushes a new post onto the cached timelines of its audience. It
+// runs after the request is done.
+func (app *application) fanOutPost(post store.Post) {
+	if !app.config.timeline.enabled {
+		return
+	}
+	createdAt, err := time.Parse(time.RFC3339, post.CreateAt)
+	if err != nil {
+		app.logger.Errorw("Error fanning out post", "error", err, "post", post.ID)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	userIDs, err := app.timelineAudience(ctx, post.UserID)
+	if err == nil {
+		entry := store.TimelineEntry{PostID: post.ID, CreatedAt: createdAt}
+		err = app.cacheStorage.Timelines.Push(ctx, entry, userIDs...)
+	}
+	if err != nil {
+		app.logger.Errorw("Error fanning out post", "error", err, "post", post.ID)
+	}
+}
+
+// removeFromTimelines takes a deleted post out of the cached timelines. Posts
+// that are missed are dropped when the timeline is read.
+func (app *application) removeFromTimelines(post store.Post) {
+	if !app.config.timeline.enabled {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fanOutTimeout)
+	defer cancel()
+	userIDs, err := app.timelineAudience(ctx, post.UserID)
+	if err == nil {
+		err = app.cacheStorage.Timelines.Remove(ctx, post.ID, userIDs...)
+	}
+	if err != nil {
+		app.logger.Errorw("Error removing post from timelines", "error", err, "post", post.ID)
+	}
+}
+
+// forgetTimeline drops the cached timeline of the user after their follows
+// changed, it is filled again on the next read.
+func (app *application) forgetTimeline(ctx context.Context, userID int64) {
+	if !app.config.timeline.enabled {
+		return
+	}
+	if err := app.cacheStorage.Timelines.Delete(ctx, userID); err != nil {
+		app.logger.Errorw("Error deleting timeline from cache", "error", err, "user", userID)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
+)
+
+func TestMergeTimeline(t *testing.T) {
+	at := func(minute int) time.Time {
+		return time.Date(2024, 5, 1, 10, minute, 0, 0, time.UTC)
+	}
+	cached := []store.TimelineEntry{
+		{PostID: 7, CreatedAt: at(5)},
+		{PostID: 5, CreatedAt: at(3)},
+		{PostID: 4, CreatedAt: at(3)},
+	}
+	pulled := []store.TimelineEntry{
+		{PostID: 6, CreatedAt: at(3)},
+		{PostID: 5, CreatedAt: at(3)},
+		{PostID: 2, CreatedAt: at(1)},
+	}
+	got := mergeTimeline(4, cached, pulled)
+	want := []int64{7, 6, 5, 4}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	// a post read back with another time is still only taken once, even with
+	// other posts between the two
+	late := []store.TimelineEntry{
+		{PostID: 7, CreatedAt: at(6)},
+		{PostID: 8, CreatedAt: at(5).Add(time.Second)},
+	}
+	got = mergeTimeline(4, cached, late)
+	want = []int64{7, 8, 5, 4}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if got := mergeTimeline(4, nil, nil); len(got) != 0 {
+		t.Errorf("got %v, wanted no posts", got)
+	}
+}
+
+func TestTimelineCacheable(t *testing.T) {
+	since := time.Now()
+	tests := []struct {
+		name string
+		fq   store.PaginatedFeedQuery
+		want bool
+	}{
+		{"first page", store.PaginatedFeedQuery{Sort: "desc"}, true},
+		{
+			"next page",
+			store.PaginatedFeedQuery{Sort: "desc", Cursor: store.Cursor{CreatedAt: "2024-05-01T10:00:00Z", ID: 3}.Encode()},
+			true,
+		},
+		{
+			"previous page",
+			store.PaginatedFeedQuery{
+				Sort:   "desc",
+				Cursor: store.Cursor{CreatedAt: "2024-05-01T10:00:00Z", ID: 3, Prev: true}.Encode(),
+			},
+			false,
+		},
+		{"oldest first", store.PaginatedFeedQuery{Sort: "asc"}, false},
+		{"offset", store.PaginatedFeedQuery{Sort: "desc", Offset: 10}, false},
+		{"search", store.PaginatedFeedQuery{Sort: "desc", Search: "go"}, false},
+		{"tags", store.PaginatedFeedQuery{Sort: "desc", Tags: []string{"go"}}, false},
+		{"since", store.PaginatedFeedQuery{Sort: "desc", Since: &since}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timelineCacheable(tt.fq); got != tt.want {
+				t.Errorf("got %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/rijojohn85/social/internal/store"
 )
 
@@ -15,14 +17,16 @@ const flrCtxKey userKey = "follower"
 
 const userCtxKey userKey = "user"
 
+const sessionCtxKey userKey = "session"
+
 // GetUser godoc
 //
 //	@Summary		Activates/Registers a user
 //	@Description	Activates/Registers a user by invitation token
 //	@Tags			users
 //	@Produce		json
-//	@Param			token path		string true	"Invitation Token"
-//	@Success		204		{string}	string "User Activated"
+//	@Param			token	path		string	true	"Invitation Token"
+//	@Success		204		{string}	string	"User Activated"
 //	@Failure		404		{object}	error
 //	@Failure		400		{object}	error
 //	@Failure		500		{object}	error
@@ -40,7 +44,9 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		case errors.Is(err, store.ErrInvalidToken):
 			app.badRequestError(w, r, err)
 		case errors.Is(err, store.ErrInvitationExpired):
-			app.badRequestError(w, r, err)
+			app.badRequestError(w, r, fmt.Errorf(
+				"%w: request a new one at /v1/users/activate/resend", err),
+			)
 		case errors.Is(err, store.ErrorNotFound):
 			app.internalServerError(w, r, errors.New(
 				"user not found. Contact developer"),
@@ -56,15 +62,74 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// ResendActivation godoc
+//
+//	@Summary		Resends the activation email
+//	@Description	Issues a new invitation token for an account that was never activated. The old token stops working
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendActivationPayload	true	"Resend payload"
+//	@Success		202		{string}	string					"Activation email sent"
+//	@Failure		400		{object}	error
+//	@Failure		429		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/users/activate/resend [POST]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJson(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	const sent = "if the account is waiting for activation an email was sent"
+
+	plainToken := uuid.New().String()
+	user, err := app.store.Users.ReplaceInvitation(
+		r.Context(),
+		payload.Email,
+		plainToken,
+		app.config.mail.exp,
+		app.config.mail.resendCooldown,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound), errors.Is(err, store.ErrInvitationTooSoon):
+			// unknown and already active accounts get the same answer, and so do
+			// accounts still in the cooldown, they would stand out otherwise
+			if err := app.jsonResponse(w, http.StatusAccepted, sent); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := app.sendActivationEmail(user, plainToken); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, sent); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 // GetUser godoc
 //
 //	@Summary		Fetches a user profile
-//	@Description	Fetches a user profile by ID
+//	@Description	Fetches a user profile by ID with follower, following and post counts. The email is only shown to the user themselves
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			userID	path		int	true	"User ID"
-//	@Success		200		{object}	store.User
+//	@Success		200		{object}	store.Profile
 //	@Failure		400		{object}	error
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
@@ -77,12 +142,21 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
-	var user store.User
-	err = app.getUser(ctx, &user, userId)
+	viewer := ctx.Value(userCtxKey).(*store.User)
+	profile, err := app.store.Users.GetProfile(ctx, userId, viewer.ID)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
-	err = app.jsonResponse(w, http.StatusOK, user)
+	if profile.ID != viewer.ID {
+		profile.Email = ""
+	}
+	err = app.jsonResponse(w, http.StatusOK, profile)
 	if err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -91,35 +165,59 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // FollowUser godoc
 //
 //	@Summary		Follows a user
-//	@Description	Follows a user by id
+//	@Description	Follows a user by id. Following a private account sends a follow request the owner has to approve
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			userID	path		int	true	"User ID to Follow"
-//	@Success		204		{string}	 string "User Followed"
-//	@Failure		400		{object}	error "Bad Request: Payload missing/error"
-//	@Failure		404		{object}	error "User not found"
+//	@Param			userID	path		int		true	"User ID to Follow"
+//	@Success		204		{string}	string	"User Followed"
+//	@Success		202		{string}	string	"Follow requested"
+//	@Failure		400		{object}	error	"Bad Request: Payload missing/error"
+//	@Failure		403		{object}	error	"Blocked by or blocking the user"
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		409		{object}	error	"Already following"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [PUT]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(userCtxKey).(*store.User)
-	followerUser, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
-	if err != nil {
-		app.badRequestError(w, r, err)
+	target, ok := app.profileUser(w, r)
+	if !ok {
+		return
+	}
+	if target.ID == user.ID {
+		app.badRequestError(w, r, errors.New("can't follow yourself"))
 		return
 	}
 	userID := user.ID
-	err = app.store.Users.AddFollower(r.Context(), userID, followerUser)
-	if err != nil {
-		if errors.Is(err, store.ErrUserAlreadyFollows) {
-			app.conflictRequestError(w, r, err)
+	if target.IsPrivate {
+		if err := app.store.Users.CreateFollowRequest(r.Context(), userID, target.ID); err != nil {
+			app.followError(w, r, err)
 			return
-		} else {
+		}
+		go app.notifications.FollowRequest(target.ID, userID)
+		if err := app.jsonResponse(w, http.StatusAccepted, "follow requested"); err != nil {
 			app.internalServerError(w, r, err)
-			return
 		}
+		return
 	}
-	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+	if err := app.store.Users.AddFollower(r.Context(), userID, target.ID); err != nil {
+		app.followError(w, r, err)
+		return
+	}
+	app.forgetTimeline(r.Context(), userID)
+	go app.notifications.Follow(target.ID, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) followError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrUserAlreadyFollows):
+		app.conflictRequestError(w, r, err)
+	case errors.Is(err, store.ErrBlocked):
+		app.forbiddenError(w, r, err)
+	case errors.Is(err, store.ErrorNotFound):
+		app.notFoundError(w, r, err)
+	default:
 		app.internalServerError(w, r, err)
 	}
 }
@@ -127,14 +225,14 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 // UnfollowUser godoc
 //
 //	@Summary		Unfollows a user
-//	@Description	Unfollows a user by id
+//	@Description	Unfollows a user by id, or withdraws the request to follow them
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			userID	path		int	true	"User ID"
-//	@Success		204		{string}	 string "User Unfollowed"
-//	@Failure		400		{object}	error "Bad Request: Payload missing/error"
-//	@Failure		404		{object}	error "User not found"
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User Unfollowed"
+//	@Failure		400		{object}	error	"Bad Request: Payload missing/error"
+//	@Failure		404		{object}	error	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/unfollow [PUT]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -150,7 +248,6 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		app.internalServerError(w, r, err)
 		return
 	}
-	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
-		app.internalServerError(w, r, err)
-	}
+	app.forgetTimeline(r.Context(), userID)
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/rijojohn85/social/internal/store"
 )
 
 func TestGetUser(t *testing.T) {
@@ -39,4 +45,219 @@ func TestGetUser(t *testing.T) {
 		w := executeRequest(t, req, mux)
 		checkStatus(t, w.Code, http.StatusOK)
 	})
+	getProfile := func(t *testing.T, path string) store.Profile {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := executeRequest(t, req, mux)
+		checkStatus(t, w.Code, http.StatusOK)
+		var body struct {
+			Data store.Profile `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Data
+	}
+	t.Run("should hide the email from other users", func(t *testing.T) {
+		if profile := getProfile(t, "/v1/users/1"); profile.Email != "" {
+			t.Errorf("got email %q, wanted none", profile.Email)
+		}
+	})
+	t.Run("should show the email to the user themselves", func(t *testing.T) {
+		// the mock store signs everybody in as user 0
+		if profile := getProfile(t, "/v1/users/0"); profile.Email == "" {
+			t.Error("got no email")
+		}
+	})
+}
+
+func TestUserLists(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	for _, path := range []string{
+		"/v1/users/1/followers",
+		"/v1/users/1/following",
+		"/v1/users/1/posts",
+	} {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, mux).Code, http.StatusOK)
+
+			req, err = http.NewRequest(http.MethodGet, path+"?limit=0", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, mux).Code, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"updates the given fields", `{"display_name": "Gopher", "bio": "digging"}`, http.StatusOK},
+		{"accepts an empty payload", `{}`, http.StatusOK},
+		{"rejects an empty username", `{"username": ""}`, http.StatusBadRequest},
+		{"rejects a long bio", `{"bio": "` + strings.Repeat("a", 501) + `"}`, http.StatusBadRequest},
+		{"rejects unknown fields", `{"email": "new@example.com"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, mux).Code, tt.want)
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	req, err := http.NewRequest(http.MethodPut, "/v1/users/email/confirm/token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, executeRequest(t, req, mux).Code, http.StatusOK)
+}
+
+// invitedUsers waits for the activation of gopher@example.com, which was
+// invited again recently, and knows no other account.
+type invitedUsers struct {
+	store.MockUserStore
+	recent bool
+}
+
+func (m *invitedUsers) ReplaceInvitation(
+	ctx context.Context,
+	email, token string,
+	exp, cooldown time.Duration,
+) (*store.User, error) {
+	switch {
+	case email != "gopher@example.com":
+		return nil, store.ErrorNotFound
+	case m.recent:
+		return nil, store.ErrInvitationTooSoon
+	}
+	return &store.User{ID: 1, Username: "gopher", Email: email}, nil
+}
+
+func TestResendActivation(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		recent   bool
+		want     int
+		wantMail bool
+	}{
+		{"should refuse an invalid email", `{"email":"gopher"}`, false, http.StatusBadRequest, false},
+		{"should email an inactive account", `{"email":"gopher@example.com"}`, false, http.StatusAccepted, true},
+		{"should accept an unknown email", `{"email":"nobody@example.com"}`, false, http.StatusAccepted, false},
+		{"should answer the same during the cooldown", `{"email":"gopher@example.com"}`, true, http.StatusAccepted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApplication(t)
+			app.store.Users = &invitedUsers{recent: tt.recent}
+			mail := &sentMail{}
+			app.mailer = mail
+			req, err := http.NewRequest(http.MethodPost, "/v1/users/activate/resend", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStatus(t, executeRequest(t, req, app.mount()).Code, tt.want)
+			if got := len(mail.to) > 0; got != tt.wantMail {
+				t.Errorf("sent mail to %v", mail.to)
+			}
+		})
+	}
+}
+
+func TestFollowRequests(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		// the mock store signs everybody in as user 0
+		{"should not follow yourself", http.MethodPut, "/v1/users/0/follow", http.StatusBadRequest},
+		{"should follow a public account", http.MethodPut, "/v1/users/1/follow", http.StatusNoContent},
+		{"should list follow requests", http.MethodGet, "/v1/users/me/follow-requests", http.StatusOK},
+		{"should approve a follow request", http.MethodPut, "/v1/users/me/follow-requests/1/approve", http.StatusNoContent},
+		{"should not reject a missing request", http.MethodPut, "/v1/users/me/follow-requests/1/reject", http.StatusNotFound},
+		{"should check the requester id", http.MethodPut, "/v1/users/me/follow-requests/x/reject", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			checkStatus(t, executeRequest(t, req, mux).Code, tt.want)
+		})
+	}
+}
+
+func TestCurrentPasswordLockout(t *testing.T) {
+	app := NewTestApplication(t)
+	user := store.User{ID: 1, Email: "gopher@example.com", IsActive: true}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+	app.store.Users = &mfaUserStore{user: user}
+	app.cacheStorage.Users = &uncachedUsers{}
+	mux := app.mount()
+	testToken, _ := app.authenticator.GenerateToken(nil)
+	request := func(method, path, body string) int {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		return executeRequest(t, req, mux).Code
+	}
+	wrong := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPut, "/v1/users/me/password", `{"current_password":"wrong","new_password":"secret"}`},
+		{http.MethodPost, "/v1/users/me/email", `{"email":"new@example.com","password":"wrong"}`},
+		{http.MethodDelete, "/v1/users/me", `{"password":"wrong"}`},
+	}
+	for i := 0; i <= int(testLockoutConfig.FreeAttempts); i++ {
+		tt := wrong[i%len(wrong)]
+		checkStatus(t, request(tt.method, tt.path, tt.body), http.StatusUnauthorized)
+	}
+	for _, tt := range wrong {
+		t.Run("should lock out "+tt.path, func(t *testing.T) {
+			checkStatus(t, request(tt.method, tt.path, tt.body), http.StatusTooManyRequests)
+		})
+	}
+	t.Run("should lock out the right password too", func(t *testing.T) {
+		code := request(http.MethodDelete, "/v1/users/me", `{"password":"password"}`)
+		checkStatus(t, code, http.StatusTooManyRequests)
+	})
 }
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_invitations_user_id;
+ALTER TABLE user_invitations
+drop column created_at;
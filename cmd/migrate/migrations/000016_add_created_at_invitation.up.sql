@@ -0,0 +1,4 @@
+ALTER TABLE user_invitations
+ADD COLUMN created_at TIMESTAMP(0) with time zone not null DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_user_invitations_user_id ON user_invitations (user_id);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY,
+    secret text NOT NULL,
+    -- NULL until the user proved the authenticator app works
+    confirmed_at timestamp(0) with time zone,
+    -- the last accepted time step, codes can't be replayed within their window
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    user_id bigint NOT NULL,
+    code bytea NOT NULL,
+    used_at timestamp(0) with time zone,
+    PRIMARY KEY (user_id, code),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
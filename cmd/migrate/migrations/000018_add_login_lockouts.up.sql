@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id bigserial PRIMARY KEY,
+    -- what was locked: an email or an ip
+    kind VARCHAR(10) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    failures INT NOT NULL,
+    locked_until timestamp(0) with time zone NOT NULL,
+    unlocked_at timestamp(0) with time zone,
+    unlocked_by bigint REFERENCES users (id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_lockouts_locked_until ON login_lockouts (locked_until);
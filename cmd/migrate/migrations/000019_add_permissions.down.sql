@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_name_key;
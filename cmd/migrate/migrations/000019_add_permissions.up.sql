@@ -0,0 +1,31 @@
+ALTER TABLE roles ADD CONSTRAINT roles_name_key UNIQUE (name);
+
+CREATE TABLE IF NOT EXISTS permissions(
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) UNIQUE NOT NULL,
+  description VARCHAR(1000) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+  role_id BIGINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+  ('posts:update:any', 'can modify posts of other users'),
+  ('posts:delete:any', 'can delete posts of other users'),
+  ('comments:update:any', 'can modify comments of other users'),
+  ('comments:delete:any', 'can delete comments of other users'),
+  ('users:manage', 'can view, change and delete other users'),
+  ('roles:manage', 'can create roles and change their permissions'),
+  ('lockouts:manage', 'can view and lift login lockouts');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'moderator'
+  AND p.name IN ('posts:update:any', 'comments:update:any', 'comments:delete:any');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin';
@@ -0,0 +1,4 @@
+-- set while an admin has deactivated the account, is_active only tracks the
+-- email confirmation
+ALTER TABLE users
+ADD COLUMN deactivated_at timestamp(0) with time zone;
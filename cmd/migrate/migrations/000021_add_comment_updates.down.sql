@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,5 @@
+ALTER TABLE comments
+ADD COLUMN updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+-- comments are paged per post by (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_created_at ON comments (post_id, created_at, id);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+DROP INDEX IF EXISTS idx_comments_post_id_thread;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_created_at ON comments (post_id, created_at, id);
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS deleted_at,
+DROP COLUMN IF EXISTS path,
+DROP COLUMN IF EXISTS depth,
+DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,18 @@
+ALTER TABLE comments
+ADD COLUMN parent_id bigint REFERENCES comments (id),
+ADD COLUMN depth INT NOT NULL DEFAULT 0,
+-- ids from the thread root down to the comment itself, sorting by it keeps
+-- replies under their parent
+ADD COLUMN path bigint[],
+-- deleted comments with replies stay as tombstones
+ADD COLUMN deleted_at timestamp(0) with time zone;
+
+UPDATE comments SET path = ARRAY[id];
+
+ALTER TABLE comments ALTER COLUMN path SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_comments_post_id_created_at;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_thread ON comments (post_id, (path[1]) DESC, path);
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
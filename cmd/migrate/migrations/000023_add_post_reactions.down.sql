@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN IF EXISTS reaction_counts;
+
+DROP TABLE IF EXISTS post_reactions;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS post_reactions (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('like', 'love', 'laugh', 'wow', 'sad', 'angry')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions (user_id);
+
+-- reactions per kind, kept in step with post_reactions so reading posts and
+-- feeds never has to count
+ALTER TABLE posts
+ADD COLUMN reaction_counts jsonb NOT NULL DEFAULT '{}';
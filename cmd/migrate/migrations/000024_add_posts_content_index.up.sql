@@ -0,0 +1,2 @@
+-- lets the feed search match post content as well as titles
+CREATE INDEX IF NOT EXISTS idx_posts_content ON posts USING gin (content gin_trgm_ops);
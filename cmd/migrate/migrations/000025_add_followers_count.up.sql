@@ -0,0 +1,9 @@
+-- kept by the follow and unfollow queries, tells which authors are too big to
+-- fan their posts out to every follower
+ALTER TABLE users ADD COLUMN followers_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users u SET followers_count = (
+  SELECT COUNT(*) FROM followers f WHERE f.follower_id = u.id
+);
+
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
@@ -0,0 +1,9 @@
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+
+DROP INDEX IF EXISTS idx_followers_user_id_created_at;
+
+DROP INDEX IF EXISTS idx_followers_follower_id_created_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
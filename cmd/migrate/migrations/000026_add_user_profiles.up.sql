@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN avatar_url VARCHAR(1000) NOT NULL DEFAULT '';
+
+-- followers and following lists are paged newest follow first
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_created_at ON followers (follower_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_followers_user_id_created_at ON followers (user_id, created_at DESC);
+
+DROP INDEX IF EXISTS idx_followers_follower_id;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS email_changes;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '';
+
+-- set when the user deletes their account, it is purged after a grace period
+-- unless they sign in again
+ALTER TABLE users ADD COLUMN deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS email_changes (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL,
+    email citext NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
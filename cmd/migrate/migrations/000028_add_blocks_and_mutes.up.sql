@@ -0,0 +1,23 @@
+-- user_id blocked blocked_id, blocks work both ways
+CREATE TABLE IF NOT EXISTS blocks (
+    user_id bigint NOT NULL,
+    blocked_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, blocked_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (user_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks (blocked_id);
+
+-- user_id muted muted_id, only the feed of user_id is affected
+CREATE TABLE IF NOT EXISTS mutes (
+    user_id bigint NOT NULL,
+    muted_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, muted_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_id) REFERENCES users (id) ON DELETE CASCADE,
+    CHECK (user_id <> muted_id)
+);
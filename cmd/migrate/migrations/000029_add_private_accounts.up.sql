@@ -0,0 +1,15 @@
+-- the posts of private accounts are only shown to their followers, following
+-- them takes a request the owner approves
+ALTER TABLE users ADD COLUMN is_private boolean NOT NULL DEFAULT FALSE;
+
+-- user_id asked to follow target_id
+CREATE TABLE IF NOT EXISTS follow_requests (
+    user_id bigint NOT NULL,
+    target_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, target_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (target_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_requests_target_id ON follow_requests (target_id, created_at DESC);
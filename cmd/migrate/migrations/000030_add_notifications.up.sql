@@ -0,0 +1,31 @@
+-- user_id is told that actor_id did something, post_id and comment_id point at
+-- what it was about
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    actor_id bigint NOT NULL,
+    type varchar(20) NOT NULL,
+    post_id bigint,
+    comment_id bigint,
+    read_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_actor_id ON notifications (actor_id);
+
+-- every type is on unless the user turned it off
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id bigint NOT NULL,
+    type varchar(20) NOT NULL,
+    enabled boolean NOT NULL,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_posts_created_at;
+
+DROP TABLE IF EXISTS comment_mentions;
+
+DROP TABLE IF EXISTS post_mentions;
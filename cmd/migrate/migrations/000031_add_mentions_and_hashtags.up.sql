@@ -0,0 +1,30 @@
+-- users mentioned with @username in the content of posts and comments
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
+
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_user_id ON comment_mentions (user_id);
+
+-- trending tags are counted over the posts of a recent window
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at DESC);
+
+-- tags are stored lowercase without the #, like the server parses hashtags
+UPDATE posts
+SET tags = (SELECT array_agg(DISTINCT lower(ltrim(t, '#'))) FROM unnest(tags) t WHERE ltrim(t, '#') <> '')
+WHERE cardinality(tags) > 0;
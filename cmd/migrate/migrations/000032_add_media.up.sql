@@ -0,0 +1,21 @@
+-- uploaded files, kept in blob storage under key. Media that is not attached
+-- to a post is purged after a while. Deleting the post or the user only
+-- detaches it, so the cleanup gets to delete the blobs too.
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    user_id bigint,
+    post_id bigint,
+    content_type varchar(100) NOT NULL,
+    size bigint NOT NULL,
+    key varchar(255) NOT NULL,
+    thumbnail_key varchar(255),
+    width int,
+    height int,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_post_id ON media (post_id);
+
+CREATE INDEX IF NOT EXISTS idx_media_unattached ON media (created_at) WHERE post_id IS NULL;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_posts_scheduled;
+
+-- posts that were never published go with the columns
+DELETE FROM posts WHERE status <> 'published';
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_publish_at_check,
+    DROP CONSTRAINT IF EXISTS posts_status_check,
+    DROP COLUMN IF EXISTS publish_at,
+    DROP COLUMN IF EXISTS status;
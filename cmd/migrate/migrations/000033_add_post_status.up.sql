@@ -0,0 +1,14 @@
+-- drafts are only seen by their author, scheduled posts are published by the
+-- scheduler once publish_at has passed. publish_at is when a published post
+-- went out.
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'published',
+    ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+
+UPDATE posts SET publish_at = created_at WHERE publish_at IS NULL;
+
+ALTER TABLE posts
+    ADD CONSTRAINT posts_status_check CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD CONSTRAINT posts_publish_at_check CHECK (status = 'draft' OR publish_at IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
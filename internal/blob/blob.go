@@ -0,0 +1,24 @@
+// Package blob keeps uploaded files, on the local disk or in an S3 compatible
+// object store.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Storage keeps blobs under slash separated keys.
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing what was there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob, the caller closes it. Missing blobs are ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob, missing blobs are not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,65 @@
+// Package content pulls #hashtags and @mentions out of the text of posts and
+// comments.
+package content
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTagLength is the longest tag a post can hold.
+const MaxTagLength = 100
+
+var (
+	// a # or @ in the middle of a word, an url or an email is not a tag or a
+	// mention
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#@])#([\p{L}\p{N}_]+)`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_./#@])@([\p{L}\p{N}_]+(?:[.\-][\p{L}\p{N}_]+)*)`)
+)
+
+// NormalizeTag lowercases the tag and drops a leading #. Tags that are empty
+// or too long come back empty.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if utf8.RuneCountInString(tag) > MaxTagLength {
+		return ""
+	}
+	return tag
+}
+
+// Hashtags returns the normalized hashtags of the text in order, each once.
+func Hashtags(text string) []string {
+	tags := []string{}
+	for _, m := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		if tag := NormalizeTag(m[1]); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Mentions returns the usernames mentioned in the text in order, each once.
+func Mentions(text string) []string {
+	usernames := []string{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(usernames, m[1]) {
+			usernames = append(usernames, m[1])
+		}
+	}
+	return usernames
+}
+
+// MergeTags normalizes the tag lists and joins them, each tag once.
+func MergeTags(lists ...[]string) []string {
+	tags := []string{}
+	for _, list := range lists {
+		for _, tag := range list {
+			if tag = NormalizeTag(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
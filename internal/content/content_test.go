@@ -0,0 +1,47 @@
+package content
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"#Go is #fun, #go!", []string{"go", "fun"}},
+		{"(#Gophers) #über_cool", []string{"gophers", "über_cool"}},
+		{"not a#tag, https://example.com/#anchor, &#39; ##double", []string{}},
+		{"#" + strings.Repeat("a", MaxTagLength+1), []string{}},
+	}
+	for _, tt := range tests {
+		if got := Hashtags(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Hashtags(%q) = %v, wanted %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hi @alice and @bob.", []string{"alice", "bob"}},
+		{"@alice, @alice @jane.doe @first-last", []string{"alice", "jane.doe", "first-last"}},
+		{"mail me@example.com or see example.com/@alice", []string{}},
+	}
+	for _, tt := range tests {
+		if got := Mentions(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Mentions(%q) = %v, wanted %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	got := MergeTags([]string{"Go", " #rust", ""}, []string{"go", "gophers"})
+	if want := []string{"go", "rust", "gophers"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
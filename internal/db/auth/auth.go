@@ -6,3 +6,9 @@ type Authenticator interface {
 	GenerateToken(claim jwt.Claims) (string, error)
 	ValidateToken(tokenString string) (*jwt.Token, error)
 }
+
+// KeyPublisher is implemented by authenticators whose tokens other services
+// can verify with public keys only.
+type KeyPublisher interface {
+	JWKS() JWKS
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTKeySetAuthenticator signs tokens with one asymmetric key and verifies them
+// against every key of the set, so tokens signed by a retired key stay valid
+// until they expire.
+type JWTKeySetAuthenticator struct {
+	keys    map[string]*Key
+	signing *Key
+	aud     string
+	iss     string
+}
+
+func NewJWTKeySetAuthenticator(keys []*Key, signingKID, aud, iss string) (*JWTKeySetAuthenticator, error) {
+	a := &JWTKeySetAuthenticator{
+		keys: make(map[string]*Key, len(keys)),
+		aud:  aud,
+		iss:  iss,
+	}
+	for _, key := range keys {
+		if _, ok := a.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		a.keys[key.ID] = key
+	}
+	signing, ok := a.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found", signingKID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKID)
+	}
+	a.signing = signing
+	return a, nil
+}
+
+func (a *JWTKeySetAuthenticator) GenerateToken(claim jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(a.signing.Method, claim)
+	token.Header["kid"] = a.signing.ID
+	tokenString, err := token.SignedString(a.signing.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+func (a *JWTKeySetAuthenticator) ValidateToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		// a key only verifies tokens of its own algorithm
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.PublicKey, nil
+	},
+		jwt.WithIssuer(a.iss),
+		jwt.WithAudience(a.aud),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodEdDSA.Alg(),
+		}),
+	)
+}
+
+func (a *JWTKeySetAuthenticator) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(a.keys))}
+	for _, key := range a.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+	return jwks
+}
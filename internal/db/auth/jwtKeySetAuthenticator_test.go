@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testClaim() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": 42,
+		"aud": "test-aud",
+		"iss": "test-aud",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTKeySetAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "old.pem", "PRIVATE KEY", der)
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "new.pem", "PRIVATE KEY", der)
+
+	keys, err := LoadKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, wanted 2", len(keys))
+	}
+
+	old, err := NewJWTKeySetAuthenticator(keys, "old", "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := old.GenerateToken(testClaim())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate: sign with the new key, keep only the public half of the old one
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "old.pem", "PUBLIC KEY", pubDER)
+	keys, err = LoadKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewJWTKeySetAuthenticator(keys, "new", "test-aud", "test-aud")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should sign with the kid header", func(t *testing.T) {
+		tokenString, err := rotated.GenerateToken(testClaim())
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := rotated.ValidateToken(tokenString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.Header["kid"] != "new" {
+			t.Errorf("got kid %v, wanted new", token.Header["kid"])
+		}
+		if token.Method != jwt.SigningMethodEdDSA {
+			t.Errorf("got method %v, wanted EdDSA", token.Method.Alg())
+		}
+	})
+	t.Run("should verify tokens of a retired key", func(t *testing.T) {
+		if _, err := rotated.ValidateToken(oldToken); err != nil {
+			t.Errorf("got error %v, wanted nil", err)
+		}
+	})
+	t.Run("should not sign with a public only key", func(t *testing.T) {
+		if _, err := NewJWTKeySetAuthenticator(keys, "old", "test-aud", "test-aud"); err == nil {
+			t.Error("got nil error, wanted error")
+		}
+	})
+	t.Run("should reject unknown kid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaim())
+		token.Header["kid"] = "unknown"
+		tokenString, err := token.SignedString(edKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rotated.ValidateToken(tokenString); err == nil {
+			t.Error("got nil error, wanted error")
+		}
+	})
+	t.Run("should reject HMAC tokens", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaim())
+		token.Header["kid"] = "new"
+		tokenString, err := token.SignedString([]byte(edPub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rotated.ValidateToken(tokenString); err == nil {
+			t.Error("got nil error, wanted error")
+		}
+	})
+	t.Run("should publish public keys", func(t *testing.T) {
+		jwks := rotated.JWKS()
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("got %d keys, wanted 2", len(jwks.Keys))
+		}
+		for _, jwk := range jwks.Keys {
+			switch jwk.Kid {
+			case "new":
+				if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.X == "" {
+					t.Errorf("unexpected Ed25519 JWK %+v", jwk)
+				}
+			case "old":
+				if jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.N == "" || jwk.E != "AQAB" {
+					t.Errorf("unexpected RSA JWK %+v", jwk)
+				}
+			default:
+				t.Errorf("unexpected kid %s", jwk.Kid)
+			}
+		}
+	})
+}
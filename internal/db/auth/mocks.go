@@ -15,6 +15,7 @@ var testClaims = jwt.MapClaims{
 	"aud": "test-aud",
 	"iss": "test-aud",
 	"sub": int64(42),
+	"sid": "test-session",
 	"exp": time.Now().Add(time.Hour).Unix(),
 }
 
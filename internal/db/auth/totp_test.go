@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 key truncated to the 6 digits apps use
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(
+		[]byte("12345678901234567890"),
+	)
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, v := range vectors {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("got code %s at %d, wanted %s", code, v.unix, v.code)
+		}
+	}
+
+	t.Run("should accept codes of the adjacent period", func(t *testing.T) {
+		now := time.Unix(1111111111, 0)
+		code, _ := TOTPCode(secret, TOTPStep(now)-1)
+		step, ok := ValidateTOTP(secret, code, now)
+		if !ok || step != TOTPStep(now)-1 {
+			t.Errorf("got step %d ok %v, wanted step %d", step, ok, TOTPStep(now)-1)
+		}
+	})
+	t.Run("should reject old codes", func(t *testing.T) {
+		now := time.Unix(1111111111, 0)
+		code, _ := TOTPCode(secret, TOTPStep(now)-2)
+		if _, ok := ValidateTOTP(secret, code, now); ok {
+			t.Error("got ok, wanted rejected")
+		}
+	})
+	t.Run("should tell TOTP codes from recovery codes", func(t *testing.T) {
+		for code, want := range map[string]bool{
+			"005924":     true,
+			"05924":      false,
+			"0059240":    false,
+			"00592a":     false,
+			"0123456789": false,
+		} {
+			if got := IsTOTPCode(code); got != want {
+				t.Errorf("got %v for %q, wanted %v", got, code, want)
+			}
+		}
+	})
+	t.Run("should build an otpauth uri", func(t *testing.T) {
+		uri := TOTPURI("GopherSocial", "gopher@example.com", secret)
+		if !strings.HasPrefix(uri, "otpauth://totp/GopherSocial:gopher@example.com?") ||
+			!strings.Contains(uri, "secret="+secret) {
+			t.Errorf("unexpected uri %s", uri)
+		}
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		normalized := NormalizeRecoveryCode(strings.ToUpper(" " + code + " "))
+		if len(normalized) != 10 || strings.ContainsAny(normalized, "- ") {
+			t.Errorf("unexpected normalized code %q", normalized)
+		}
+		if seen[normalized] {
+			t.Errorf("duplicate code %s", code)
+		}
+		seen[normalized] = true
+	}
+}
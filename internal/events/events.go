@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Event types pushed to the streams.
+const (
+	TypePost         = "post"
+	TypeComment      = "comment"
+	TypeNotification = "notification"
+)
+
+var ErrInvalidEventID = errors.New("invalid event id")
+
+// Event is pushed to the stream of UserID. ID orders the events of a user, it
+// is what clients send back in Last-Event-ID to resume.
+type Event struct {
+	ID     string          `json:"id"`
+	UserID int64           `json:"user_id"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// New makes an event of the given type carrying data as JSON.
+func New(userID int64, kind string, data any) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{UserID: userID, Type: kind, Data: b}, nil
+}
+
+// Broker delivers events to the subscribers of a user on every API instance.
+type Broker interface {
+	// Publish gives the event its ID and delivers it.
+	Publish(ctx context.Context, ev Event) error
+	// Subscribe starts delivering the events of the user. The kept events
+	// after lastEventID are replayed first, an empty lastEventID replays
+	// nothing.
+	Subscribe(ctx context.Context, userID int64, lastEventID string) (*Subscription, error)
+}
+
+// subscribe registers a subscriber with the hub before reading the events to
+// replay, so nothing published in between is lost.
+func subscribe(
+	hub *Hub,
+	userID int64,
+	lastEventID string,
+	since func(userID int64, lastEventID string) ([]Event, error),
+) (*Subscription, error) {
+	sub := hub.add(userID)
+	var replay []Event
+	if lastEventID != "" {
+		var err error
+		if replay, err = since(userID, lastEventID); err != nil {
+			sub.Close()
+			return nil, err
+		}
+	}
+	hub.start(sub, replay)
+	return sub, nil
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func publish(t *testing.T, b Broker, userID int64, n int) {
+	t.Helper()
+	for range n {
+		ev, err := New(userID, TypePost, map[string]int64{"user": userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Publish(context.Background(), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// received drains the events waiting for the subscription.
+func received(sub *Subscription) []string {
+	ids := []string{}
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return append(ids, "closed")
+			}
+			ids = append(ids, ev.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestMemoryBroker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should deliver to the subscribers of the user", func(t *testing.T) {
+		b := NewMemoryBroker(NewHub(10), 10)
+		alice, err := b.Subscribe(ctx, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer alice.Close()
+		bob, err := b.Subscribe(ctx, 2, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bob.Close()
+		publish(t, b, 1, 2)
+		if got := received(alice); !slices.Equal(got, []string{"1", "2"}) {
+			t.Errorf("alice got %v", got)
+		}
+		if got := received(bob); len(got) != 0 {
+			t.Errorf("bob got %v", got)
+		}
+	})
+	t.Run("should replay the events after the last id", func(t *testing.T) {
+		b := NewMemoryBroker(NewHub(10), 3)
+		publish(t, b, 1, 5)
+		sub, err := b.Subscribe(ctx, 1, "3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+		publish(t, b, 1, 1)
+		if got := received(sub); !slices.Equal(got, []string{"4", "5", "6"}) {
+			t.Errorf("got %v", got)
+		}
+		old, err := b.Subscribe(ctx, 1, "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer old.Close()
+		if got := received(old); !slices.Equal(got, []string{"4", "5", "6"}) {
+			t.Errorf("got %v, wanted the kept events", got)
+		}
+	})
+	t.Run("should refuse invalid ids", func(t *testing.T) {
+		b := NewMemoryBroker(NewHub(10), 3)
+		if _, err := b.Subscribe(ctx, 1, "abc"); err != ErrInvalidEventID {
+			t.Errorf("got %v, wanted %v", err, ErrInvalidEventID)
+		}
+		if n := b.hub.Subscribers(); n != 0 {
+			t.Errorf("left %d subscribers", n)
+		}
+	})
+	t.Run("should drop subscribers that fall behind", func(t *testing.T) {
+		b := NewMemoryBroker(NewHub(2), 10)
+		sub, err := b.Subscribe(ctx, 1, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Close()
+		publish(t, b, 1, 3)
+		if got := received(sub); !slices.Equal(got, []string{"1", "2", "closed"}) {
+			t.Errorf("got %v", got)
+		}
+		if n := b.hub.Subscribers(); n != 0 {
+			t.Errorf("left %d subscribers", n)
+		}
+	})
+}
+
+func TestHubSkipsReplayedEvents(t *testing.T) {
+	hub := NewHub(10)
+	sub := hub.add(1)
+	// published while the replay was read, the first one is part of it
+	hub.Dispatch(Event{ID: "2", UserID: 1})
+	hub.Dispatch(Event{ID: "3", UserID: 1})
+	hub.start(sub, []Event{{ID: "1", UserID: 1}, {ID: "2", UserID: 1}})
+	defer sub.Close()
+	if got := received(sub); !slices.Equal(got, []string{"1", "2", "3"}) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package events
+
+import "sync"
+
+// Subscription receives the events of a user.
+type Subscription struct {
+	// Events is closed when the subscriber falls behind by more than the
+	// buffer of the hub. It should then resume with the last ID it got.
+	Events <-chan Event
+
+	events chan Event
+	hub    *Hub
+	userID int64
+	// events published before the replay was read, they go out after it
+	queued  []Event
+	started bool
+	closed  bool
+}
+
+// Close stops the subscription, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub hands events to the subscribers connected to this instance.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[*Subscription]struct{}
+	buffer int
+}
+
+// NewHub makes a hub that lets subscribers fall behind by buffer events.
+func NewHub(buffer int) *Hub {
+	return &Hub{subs: make(map[int64]map[*Subscription]struct{}), buffer: buffer}
+}
+
+// Dispatch hands the event to the local subscribers of its user.
+func (h *Hub) Dispatch(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[ev.UserID] {
+		if !sub.started {
+			if len(sub.queued) == h.buffer {
+				h.remove(sub)
+				continue
+			}
+			sub.queued = append(sub.queued, ev)
+			continue
+		}
+		h.send(sub, ev)
+	}
+}
+
+// Subscribers returns the number of local subscribers.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, subs := range h.subs {
+		n += len(subs)
+	}
+	return n
+}
+
+func (h *Hub) add(userID int64) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &Subscription{hub: h, userID: userID}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// start sends the replay and then the events queued while it was read,
+// leaving out the ones that were in the replay already.
+func (h *Hub) start(sub *Subscription, replay []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub.events = make(chan Event, h.buffer+len(replay))
+	sub.Events = sub.events
+	sub.started = true
+	if sub.closed {
+		close(sub.events)
+		return
+	}
+	replayed := make(map[string]bool, len(replay))
+	for _, ev := range replay {
+		replayed[ev.ID] = true
+		sub.events <- ev
+	}
+	for _, ev := range sub.queued {
+		if !replayed[ev.ID] {
+			h.send(sub, ev)
+		}
+	}
+	sub.queued = nil
+}
+
+// send drops subscribers that are too far behind, their stream ends and they
+// resume from the kept events. Callers hold h.mu.
+func (h *Hub) send(sub *Subscription, ev Event) {
+	select {
+	case sub.events <- ev:
+	default:
+		h.remove(sub)
+	}
+}
+
+// remove is called with h.mu held.
+func (h *Hub) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	if sub.started {
+		close(sub.events)
+	}
+	delete(h.subs[sub.userID], sub)
+	if len(h.subs[sub.userID]) == 0 {
+		delete(h.subs, sub.userID)
+	}
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// MemoryBroker delivers events in process, subscribers only get the events
+// published on the same API instance.
+type MemoryBroker struct {
+	hub *Hub
+	// events kept per user for resuming
+	keep    int
+	mu      sync.Mutex
+	seq     int64
+	history map[int64][]Event
+}
+
+func NewMemoryBroker(hub *Hub, keep int) *MemoryBroker {
+	return &MemoryBroker{hub: hub, keep: keep, history: make(map[int64][]Event)}
+}
+
+func (m *MemoryBroker) Publish(_ context.Context, ev Event) error {
+	m.mu.Lock()
+	m.seq++
+	ev.ID = strconv.FormatInt(m.seq, 10)
+	history := append(m.history[ev.UserID], ev)
+	if len(history) > m.keep {
+		history = history[len(history)-m.keep:]
+	}
+	m.history[ev.UserID] = history
+	m.mu.Unlock()
+
+	m.hub.Dispatch(ev)
+	return nil
+}
+
+func (m *MemoryBroker) Subscribe(_ context.Context, userID int64, lastEventID string) (*Subscription, error) {
+	return subscribe(m.hub, userID, lastEventID, m.since)
+}
+
+func (m *MemoryBroker) since(userID int64, lastEventID string) ([]Event, error) {
+	last, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidEventID
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var replay []Event
+	for _, ev := range m.history[userID] {
+		if seq, _ := strconv.ParseInt(ev.ID, 10, 64); seq > last {
+			replay = append(replay, ev)
+		}
+	}
+	return replay, nil
+}
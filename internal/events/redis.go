@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// streamIDPattern matches the ids of redis streams, <milliseconds>-<sequence>.
+var streamIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// RedisBroker shares events between API instances. Every event is kept in a
+// capped stream of its user for resuming and published on one channel that
+// each instance hands to its local subscribers, see Run.
+type RedisBroker struct {
+	rdb    *redis.Client
+	hub    *Hub
+	prefix string
+	// events kept per user for resuming, and for how long after the last one
+	keep int
+	ttl  time.Duration
+}
+
+func NewRedisBroker(rdb *redis.Client, hub *Hub, prefix string, keep int, ttl time.Duration) *RedisBroker {
+	return &RedisBroker{rdb: rdb, hub: hub, prefix: prefix, keep: keep, ttl: ttl}
+}
+
+func (r *RedisBroker) streamKey(userID int64) string {
+	return fmt.Sprintf("%s-%d", r.prefix, userID)
+}
+
+func (r *RedisBroker) Publish(ctx context.Context, ev Event) error {
+	key := r.streamKey(ev.UserID)
+	id, err := r.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: int64(r.keep),
+		Approx: true,
+		Values: map[string]interface{}{"type": ev.Type, "data": string(ev.Data)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	ev.ID = id
+	if err := r.rdb.Expire(ctx, key, r.ttl).Err(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Publish(ctx, r.prefix, b).Err()
+}
+
+func (r *RedisBroker) Subscribe(ctx context.Context, userID int64, lastEventID string) (*Subscription, error) {
+	return subscribe(r.hub, userID, lastEventID, func(userID int64, lastEventID string) ([]Event, error) {
+		return r.since(ctx, userID, lastEventID)
+	})
+}
+
+func (r *RedisBroker) since(ctx context.Context, userID int64, lastEventID string) ([]Event, error) {
+	if !streamIDPattern.MatchString(lastEventID) {
+		return nil, ErrInvalidEventID
+	}
+	messages, err := r.rdb.XRange(ctx, r.streamKey(userID), "("+lastEventID, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	replay := make([]Event, 0, len(messages))
+	for _, m := range messages {
+		kind, _ := m.Values["type"].(string)
+		data, _ := m.Values["data"].(string)
+		replay = append(replay, Event{ID: m.ID, UserID: userID, Type: kind, Data: json.RawMessage(data)})
+	}
+	return replay, nil
+}
+
+// Run hands the events published by every instance to the local subscribers
+// until ctx is done. The redis client reconnects on its own, open streams miss
+// the events published while it is away and get them when they resume.
+func (r *RedisBroker) Run(ctx context.Context) {
+	pubsub := r.rdb.Subscribe(ctx, r.prefix)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				continue
+			}
+			r.hub.Dispatch(ev)
+		}
+	}
+}
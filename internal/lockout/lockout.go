@@ -0,0 +1,87 @@
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Backend keeps failure counters and blocks. Implementations must make Incr
+// atomic, several API instances share one Redis backend.
+type Backend interface {
+	// Incr adds a failure for key and returns the failures within ttl.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Block refuses attempts for key during d.
+	Block(ctx context.Context, key string, d time.Duration) error
+	// Blocked returns how long key is still blocked, 0 if it isn't.
+	Blocked(ctx context.Context, key string) (time.Duration, error)
+	// Reset forgets failures and blocks of key.
+	Reset(ctx context.Context, key string) error
+}
+
+type Config struct {
+	// failures that are tolerated before any delay applies
+	FreeAttempts int64
+	// the first delay, it doubles with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// failures that lock the key for LockoutDuration
+	MaxAttempts     int64
+	LockoutDuration time.Duration
+	// failures older than Window are forgotten
+	Window time.Duration
+}
+
+type Result struct {
+	Failures   int64
+	RetryAfter time.Duration
+	// Locked is set by the failure that reached MaxAttempts
+	Locked bool
+}
+
+// Guard applies exponential backoff and a temporary lockout to repeated
+// failures of the same key.
+type Guard struct {
+	backend Backend
+	cfg     Config
+}
+
+func NewGuard(backend Backend, cfg Config) *Guard {
+	return &Guard{backend: backend, cfg: cfg}
+}
+
+func (g *Guard) Check(ctx context.Context, key string) (time.Duration, error) {
+	return g.backend.Blocked(ctx, key)
+}
+
+func (g *Guard) Fail(ctx context.Context, key string) (Result, error) {
+	failures, err := g.backend.Incr(ctx, key, g.cfg.Window)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Failures: failures}
+	switch {
+	case failures >= g.cfg.MaxAttempts:
+		result.RetryAfter = g.cfg.LockoutDuration
+		result.Locked = failures == g.cfg.MaxAttempts
+	case failures > g.cfg.FreeAttempts:
+		result.RetryAfter = g.delay(failures - g.cfg.FreeAttempts)
+	default:
+		return result, nil
+	}
+	return result, g.backend.Block(ctx, key, result.RetryAfter)
+}
+
+func (g *Guard) Reset(ctx context.Context, key string) error {
+	return g.backend.Reset(ctx, key)
+}
+
+func (g *Guard) delay(n int64) time.Duration {
+	delay := g.cfg.BaseDelay
+	for i := int64(1); i < n; i++ {
+		delay *= 2
+		if delay >= g.cfg.MaxDelay {
+			return g.cfg.MaxDelay
+		}
+	}
+	return min(delay, g.cfg.MaxDelay)
+}
@@ -0,0 +1,84 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        4 * time.Second,
+		MaxAttempts:     6,
+		LockoutDuration: time.Minute,
+		Window:          time.Hour,
+	}
+	backend := NewMemoryBackend()
+	now := time.Unix(1_700_000_000, 0)
+	backend.now = func() time.Time { return now }
+	guard := NewGuard(backend, cfg)
+
+	want := []struct {
+		retryAfter time.Duration
+		locked     bool
+	}{
+		{0, false},
+		{0, false},
+		{time.Second, false},
+		{2 * time.Second, false},
+		{4 * time.Second, false},
+		{time.Minute, true},
+	}
+	for i, w := range want {
+		result, err := guard.Fail(ctx, "email:gopher@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RetryAfter != w.retryAfter || result.Locked != w.locked {
+			t.Errorf(
+				"failure %d: got retry after %v locked %v, wanted %v %v",
+				i+1, result.RetryAfter, result.Locked, w.retryAfter, w.locked,
+			)
+		}
+		blocked, err := guard.Check(ctx, "email:gopher@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked != w.retryAfter {
+			t.Errorf("failure %d: got blocked %v, wanted %v", i+1, blocked, w.retryAfter)
+		}
+	}
+
+	t.Run("should not block other keys", func(t *testing.T) {
+		blocked, _ := guard.Check(ctx, "email:other@example.com")
+		if blocked != 0 {
+			t.Errorf("got blocked %v, wanted 0", blocked)
+		}
+	})
+	t.Run("should lift the lockout after it expired", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		blocked, _ := guard.Check(ctx, "email:gopher@example.com")
+		if blocked != 0 {
+			t.Errorf("got blocked %v, wanted 0", blocked)
+		}
+	})
+	t.Run("should forget failures on reset", func(t *testing.T) {
+		if err := guard.Reset(ctx, "email:gopher@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		result, _ := guard.Fail(ctx, "email:gopher@example.com")
+		if result.Failures != 1 || result.RetryAfter != 0 {
+			t.Errorf("got %+v, wanted a first failure", result)
+		}
+	})
+	t.Run("should forget failures outside the window", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		result, _ := guard.Fail(ctx, "email:gopher@example.com")
+		if result.Failures != 1 {
+			t.Errorf("got %d failures, wanted 1", result.Failures)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is the number of calls between removals of expired entries.
+const sweepEvery = 1000
+
+type memoryEntry struct {
+	failures     int64
+	expiry       time.Time
+	blockedUntil time.Time
+}
+
+// MemoryBackend keeps counters in process. Every API instance counts on its own,
+// use the Redis backend when running more than one.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	calls   int
+	now     func() time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryBackend) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	entry := m.entry(key, now)
+	if now.After(entry.expiry) {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.expiry = now.Add(ttl)
+	return entry.failures, nil
+}
+
+func (m *MemoryBackend) Block(_ context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	entry := m.entry(key, now)
+	entry.blockedUntil = now.Add(d)
+	return nil
+}
+
+func (m *MemoryBackend) Blocked(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(entry.blockedUntil.Sub(m.now()), 0), nil
+}
+
+func (m *MemoryBackend) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// entry returns the entry of key, creating it if needed. m.mu must be held.
+func (m *MemoryBackend) entry(key string, now time.Time) *memoryEntry {
+	m.calls++
+	if m.calls%sweepEvery == 0 {
+		for k, e := range m.entries {
+			if now.After(e.expiry) && now.After(e.blockedUntil) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		m.entries[key] = entry
+	}
+	return entry
+}
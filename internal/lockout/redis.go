@@ -0,0 +1,52 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RedisBackend struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func NewRedisBackend(rdb *redis.Client, prefix string) *RedisBackend {
+	return &RedisBackend{rdb: rdb, prefix: prefix}
+}
+
+func (r *RedisBackend) failKey(key string) string {
+	return r.prefix + "-fail-" + key
+}
+
+func (r *RedisBackend) blockKey(key string) string {
+	return r.prefix + "-block-" + key
+}
+
+func (r *RedisBackend) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := r.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, r.failKey(key))
+	pipe.PExpire(ctx, r.failKey(key), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (r *RedisBackend) Block(ctx context.Context, key string, d time.Duration) error {
+	return r.rdb.Set(ctx, r.blockKey(key), 1, d).Err()
+}
+
+func (r *RedisBackend) Blocked(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.rdb.PTTL(ctx, r.blockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// negative values mean the key is missing or has no expiry
+	return max(ttl, 0), nil
+}
+
+func (r *RedisBackend) Reset(ctx context.Context, key string) error {
+	return r.rdb.Del(ctx, r.failKey(key), r.blockKey(key)).Err()
+}
@@ -3,9 +3,11 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "GopherSocial"
-	maxRetries          = 3
-	UserWelcomeTemplate = "userInvitation.tmpl"
+	FromName              = "GopherSocial"
+	maxRetries            = 3
+	UserWelcomeTemplate   = "userInvitation.tmpl"
+	PasswordResetTemplate = "passwordReset.tmpl"
+	EmailChangeTemplate   = "emailChange.tmpl"
 )
 
 //go:embed "templates"
@@ -46,7 +46,7 @@ func (m *MailTripMailer) Send(
 	// Set email headers
 	message.SetHeader("From", m.fromEmail)
 	message.SetHeader("To", userEmail)
-	message.SetHeader("Subject", "Hello from the Mailtrap team")
+	message.SetHeader("Subject", subject.String())
 
 	// Set email body
 	message.SetBody("text/html", body.String())
@@ -63,5 +63,4 @@ func (m *MailTripMailer) Send(
 		}
 	}
 	return fmt.Errorf("failed to send email after %d retries", maxRetries)
-	return nil
 }
@@ -0,0 +1,133 @@
+// Package media checks uploaded files and makes thumbnails of images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // registers the gif decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// maxPixels bounds the images that are decoded, so a small file can't
+// unpack into a huge image. Decoded that is up to 80MB.
+const maxPixels = 20_000_000
+
+// maxSamples bounds the source pixels read per thumbnail pixel on each axis.
+const maxSamples = 4
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrImageTooLarge   = errors.New("image dimensions too large")
+)
+
+// types are the content types that can be uploaded, with whether a thumbnail
+// can be made of them.
+var types = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": false,
+	"video/mp4":  false,
+}
+
+// Sniff tells the content type of a file from its first bytes, files that
+// can't be uploaded are ErrUnsupportedType.
+func Sniff(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	if _, ok := types[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Thumbnail is a small copy of an image.
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	// size of the original image
+	Width  int
+	Height int
+}
+
+// MakeThumbnail scales the image down to fit in size x size. It returns nil
+// for types that don't get thumbnails.
+func MakeThumbnail(data []byte, contentType string, size int) (*Thumbnail, error) {
+	if !types[contentType] {
+		return nil, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	thumb := scale(src, size)
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Thumbnail{
+		Data:        buf.Bytes(),
+		ContentType: contentType,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}, nil
+}
+
+// scale shrinks the image to fit in size x size keeping its aspect, each
+// pixel is the average of up to maxSamples x maxSamples pixels of the area it
+// covers. The source is read in place, so no full size copy is made. Smaller
+// images are kept.
+func scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		yStep := max((y1-y0)/maxSamples, 1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			xStep := max((x1-x0)/maxSamples, 1)
+			var sum [4]uint64
+			var n uint64
+			for sy := y0; sy < y1; sy += yStep {
+				for sx := x0; sx < x1; sx += xStep {
+					r, g, b2, a := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					sum[0] += uint64(r)
+					sum[1] += uint64(g)
+					sum[2] += uint64(b2)
+					sum[3] += uint64(a)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[i+c] = uint8(sum[c] / n >> 8)
+			}
+		}
+	}
+	return dst
+}
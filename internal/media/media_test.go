@@ -0,0 +1,103 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	if got, err := Sniff(encodePNG(t, 2, 2)); err != nil || got != "image/png" {
+		t.Errorf("got %q, %v for a png", got, err)
+	}
+	if _, err := Sniff([]byte("<html><script>alert(1)</script>")); err != ErrUnsupportedType {
+		t.Errorf("got %v for html, wanted %v", err, ErrUnsupportedType)
+	}
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	thumb, err := MakeThumbnail(encodePNG(t, 400, 200), "image/png", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != 400 || thumb.Height != 200 || thumb.ContentType != "image/png" {
+		t.Errorf("got %+v", thumb)
+	}
+	img, err := png.Decode(bytes.NewReader(thumb.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(100, 50) {
+		t.Errorf("got a %v thumbnail, wanted 100x50", got)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 50, 300)), nil); err != nil {
+		t.Fatal(err)
+	}
+	thumb, err = MakeThumbnail(buf.Bytes(), "image/jpeg", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = jpeg.Decode(bytes.NewReader(thumb.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(16, 100) {
+		t.Errorf("got a %v thumbnail, wanted 16x100", got)
+	}
+
+	if thumb, err := MakeThumbnail([]byte("video"), "video/mp4", 100); thumb != nil || err != nil {
+		t.Errorf("got %v, %v for a video", thumb, err)
+	}
+}
+
+func TestScale(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(10, 10, 1010, 510))
+	for y := 10; y < 510; y++ {
+		for x := 10; x < 1010; x++ {
+			src.Set(x, y, color.NRGBA{200, 40, 90, 255})
+		}
+	}
+	thumb := scale(src, 100)
+	if got := thumb.Bounds().Size(); got != image.Pt(100, 50) {
+		t.Fatalf("got a %v thumbnail, wanted 100x50", got)
+	}
+	if got := thumb.At(50, 25); got != (color.RGBA{200, 40, 90, 255}) {
+		t.Errorf("got color %v, wanted the color of the source", got)
+	}
+}
+
+func TestMakeThumbnailTooLarge(t *testing.T) {
+	// a png header claiming more pixels than are allowed, the image data is
+	// never read
+	data := encodePNG(t, 1, 1)
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], 5000)
+	binary.BigEndian.PutUint32(ihdr[4:8], 5000)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	if _, err := MakeThumbnail(data, "image/png", 100); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("got error %v, wanted ErrImageTooLarge", err)
+	}
+}
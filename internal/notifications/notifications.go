@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// Store keeps notifications, Create leaves out the ones the user doesn't want.
+type Store interface {
+	Create(ctx context.Context, n *store.Notification) (bool, error)
+}
+
+// Publisher pushes stored notifications to the live streams of their users.
+type Publisher interface {
+	Publish(ctx context.Context, ev events.Event) error
+}
+
+// Service takes the notifications emitted by the handlers. It runs after the
+// request is done, so a failure never fails the action that caused it.
+type Service struct {
+	store     Store
+	publisher Publisher
+	logger    *zap.SugaredLogger
+	timeout   time.Duration
+}
+
+func NewService(s Store, publisher Publisher, logger *zap.SugaredLogger) *Service {
+	return &Service{store: s, publisher: publisher, logger: logger, timeout: time.Second * 10}
+}
+
+// Notify stores a notification for n.UserID and pushes it to their streams.
+// Acting on your own things is not worth a notification.
+func (s *Service) Notify(n store.Notification) {
+	if n.UserID == 0 || n.UserID == n.ActorID {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	created, err := s.store.Create(ctx, &n)
+	if err != nil {
+		s.logger.Errorw("Error storing notification", "error", err, "user", n.UserID, "type", n.Type)
+		return
+	}
+	if !created {
+		return
+	}
+	ev, err := events.New(n.UserID, events.TypeNotification, n)
+	if err == nil {
+		err = s.publisher.Publish(ctx, ev)
+	}
+	if err != nil {
+		s.logger.Errorw("Error publishing notification", "error", err, "user", n.UserID, "id", n.ID)
+	}
+}
+
+// Follow tells the user that actorID follows them now.
+func (s *Service) Follow(userID, actorID int64) {
+	s.Notify(store.Notification{UserID: userID, ActorID: actorID, Type: store.NotificationFollow})
+}
+
+// FollowRequest tells the owner of a private account that actorID asked to
+// follow them.
+func (s *Service) FollowRequest(userID, actorID int64) {
+	s.Notify(store.Notification{UserID: userID, ActorID: actorID, Type: store.NotificationFollowRequest})
+}
+
+// Comment tells the author of the post and, for replies, the author of the
+// parent comment about a new comment. parentAuthorID is 0 for top level
+// comments.
+func (s *Service) Comment(comment store.Comment, postAuthorID, parentAuthorID int64) {
+	if parentAuthorID != 0 {
+		s.Notify(store.Notification{
+			UserID:    parentAuthorID,
+			ActorID:   comment.UserId,
+			Type:      store.NotificationReply,
+			PostID:    &comment.PostID,
+			CommentID: &comment.ID,
+		})
+		if parentAuthorID == postAuthorID {
+			return
+		}
+	}
+	s.Notify(store.Notification{
+		UserID:    postAuthorID,
+		ActorID:   comment.UserId,
+		Type:      store.NotificationComment,
+		PostID:    &comment.PostID,
+		CommentID: &comment.ID,
+	})
+}
+
+// Reaction tells the author of the post that actorID reacted to it.
+func (s *Service) Reaction(post store.Post, actorID int64) {
+	s.Notify(store.Notification{
+		UserID:  post.UserID,
+		ActorID: actorID,
+		Type:    store.NotificationReaction,
+		PostID:  &post.ID,
+	})
+}
+
+// Mention tells the users that actorID mentioned them in the post, or in one
+// of its comments when commentID is set.
+func (s *Service) Mention(userIDs []int64, actorID, postID int64, commentID *int64) {
+	for _, userID := range userIDs {
+		s.Notify(store.Notification{
+			UserID:    userID,
+			ActorID:   actorID,
+			Type:      store.NotificationMention,
+			PostID:    &postID,
+			CommentID: commentID,
+		})
+	}
+}
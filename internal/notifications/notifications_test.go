@@ -0,0 +1,109 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rijojohn85/social/internal/events"
+	"github.com/rijojohn85/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type recordingStore struct {
+	created []store.Notification
+}
+
+func (s *recordingStore) Create(ctx context.Context, n *store.Notification) (bool, error) {
+	s.created = append(s.created, *n)
+	return true, nil
+}
+
+type sent struct {
+	userID int64
+	kind   string
+}
+
+func sentOf(notifications []store.Notification) []sent {
+	got := []sent{}
+	for _, n := range notifications {
+		got = append(got, sent{n.UserID, n.Type})
+	}
+	return got
+}
+
+func TestComment(t *testing.T) {
+	const (
+		postAuthor   = 1
+		parentAuthor = 2
+		commenter    = 3
+	)
+	tests := []struct {
+		name           string
+		commenter      int64
+		parentAuthorID int64
+		want           []sent
+	}{
+		{"top level comment", commenter, 0, []sent{{postAuthor, store.NotificationComment}}},
+		{"reply", commenter, parentAuthor, []sent{
+			{parentAuthor, store.NotificationReply},
+			{postAuthor, store.NotificationComment},
+		}},
+		{"reply to the post author", commenter, postAuthor, []sent{{postAuthor, store.NotificationReply}}},
+		{"comment on your own post", postAuthor, 0, []sent{}},
+		{"reply to yourself", parentAuthor, parentAuthor, []sent{{postAuthor, store.NotificationComment}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &recordingStore{}
+			service := NewService(s, events.NewMemoryBroker(events.NewHub(10), 10), zap.NewNop().Sugar())
+			service.Comment(store.Comment{ID: 10, PostID: 20, UserId: tt.commenter}, postAuthor, tt.parentAuthorID)
+			got := sentOf(s.created)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, wanted %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, wanted %v", got, tt.want)
+				}
+			}
+			for _, n := range s.created {
+				if n.ActorID != tt.commenter || *n.PostID != 20 || *n.CommentID != 10 {
+					t.Errorf("got %+v", n)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifySkipsYourself(t *testing.T) {
+	s := &recordingStore{}
+	service := NewService(s, events.NewMemoryBroker(events.NewHub(10), 10), zap.NewNop().Sugar())
+	service.Follow(1, 1)
+	service.Reaction(store.Post{ID: 5, UserID: 1}, 1)
+	if len(s.created) != 0 {
+		t.Errorf("got %v", s.created)
+	}
+	service.Follow(1, 2)
+	if got := sentOf(s.created); len(got) != 1 || got[0] != (sent{1, store.NotificationFollow}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestNotifyPublishes(t *testing.T) {
+	broker := events.NewMemoryBroker(events.NewHub(10), 10)
+	sub, err := broker.Subscribe(context.Background(), 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	service := NewService(&recordingStore{}, broker, zap.NewNop().Sugar())
+	service.Follow(1, 2)
+	select {
+	case ev := <-sub.Events:
+		if ev.Type != events.TypeNotification || ev.UserID != 1 {
+			t.Errorf("got %+v", ev)
+		}
+	default:
+		t.Error("nothing was published")
+	}
+}
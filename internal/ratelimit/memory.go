@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is the number of calls between removals of stale entries.
+const sweepEvery = 1000
+
+type memoryEntry struct {
+	// fixed window
+	window int64
+	count  int64
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	expiry time.Time
+}
+
+// MemoryLimiter counts in process, every API instance enforces its own limits.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	calls   int
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	key = string(limit.Algorithm) + ":" + key
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoryEntry{tokens: float64(limit.Requests), last: now}
+		m.entries[key] = entry
+	}
+
+	if limit.Algorithm == TokenBucket {
+		rate := float64(limit.Requests) / float64(limit.Period)
+		entry.tokens = min(
+			float64(limit.Requests),
+			entry.tokens+float64(now.Sub(entry.last))*rate,
+		)
+		entry.last = now
+		entry.expiry = now.Add(limit.Period)
+		allowed := entry.tokens >= 1
+		if allowed {
+			entry.tokens--
+		}
+		return tokenBucketResult(allowed, entry.tokens, limit), nil
+	}
+
+	window := now.UnixNano() / int64(limit.Period)
+	if entry.window != window {
+		entry.window = window
+		entry.count = 0
+	}
+	entry.count++
+	end := time.Unix(0, (window+1)*int64(limit.Period))
+	entry.expiry = end
+	return fixedWindowResult(entry.count, limit, end.Sub(now)), nil
+}
+
+// sweep drops entries that no longer limit anything. m.mu must be held.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	m.calls++
+	if m.calls%sweepEvery != 0 {
+		return
+	}
+	for k, e := range m.entries {
+		if now.After(e.expiry) {
+			delete(m.entries, k)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	// FixedWindow allows Requests per aligned Period, bursts at the window
+	// borders can reach twice the limit.
+	FixedWindow Algorithm = "fixed-window"
+	// TokenBucket refills Requests tokens evenly over Period and allows bursts
+	// up to Requests.
+	TokenBucket Algorithm = "token-bucket"
+)
+
+type Limit struct {
+	Requests  int
+	Period    time.Duration
+	Algorithm Algorithm
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s:%s", l.Requests, l.Period, l.Algorithm)
+}
+
+// ParseLimit reads limits written as <requests>/<period>[:<algorithm>], for
+// example 100/1m or 10/1s:token-bucket. The algorithm defaults to fixed-window.
+func ParseLimit(s string) (Limit, error) {
+	limit := Limit{Algorithm: FixedWindow}
+	spec, algorithm, found := strings.Cut(s, ":")
+	if found {
+		limit.Algorithm = Algorithm(algorithm)
+	}
+	requests, period, found := strings.Cut(spec, "/")
+	if !found {
+		return limit, fmt.Errorf("rate limit %q: missing period", s)
+	}
+	var err error
+	limit.Requests, err = strconv.Atoi(requests)
+	if err != nil || limit.Requests < 1 {
+		return limit, fmt.Errorf("rate limit %q: invalid request count", s)
+	}
+	limit.Period, err = time.ParseDuration(period)
+	if err != nil || limit.Period <= 0 {
+		return limit, fmt.Errorf("rate limit %q: invalid period", s)
+	}
+	switch limit.Algorithm {
+	case FixedWindow, TokenBucket:
+	default:
+		return limit, fmt.Errorf("rate limit %q: unknown algorithm %q", s, limit.Algorithm)
+	}
+	return limit, nil
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the full quota is available again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, 0 when allowed
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+func fixedWindowResult(count int64, limit Limit, reset time.Duration) Result {
+	result := Result{
+		Allowed:   count <= int64(limit.Requests),
+		Limit:     limit.Requests,
+		Remaining: max(limit.Requests-int(count), 0),
+		Reset:     reset,
+	}
+	if !result.Allowed {
+		result.RetryAfter = reset
+	}
+	return result
+}
+
+// tokenBucketResult describes a bucket that holds tokens after the request was
+// taken from it.
+func tokenBucketResult(allowed bool, tokens float64, limit Limit) Result {
+	perToken := limit.Period / time.Duration(limit.Requests)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(limit.Requests) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return result
+}
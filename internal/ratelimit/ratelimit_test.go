@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  Limit
+		valid bool
+	}{
+		{"100/1m", Limit{100, time.Minute, FixedWindow}, true},
+		{"10/1s:token-bucket", Limit{10, time.Second, TokenBucket}, true},
+		{"10/1s:fixed-window", Limit{10, time.Second, FixedWindow}, true},
+		{"10", Limit{}, false},
+		{"0/1m", Limit{}, false},
+		{"10/never", Limit{}, false},
+		{"10/1m:leaky-bucket", Limit{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, wanted valid %v", tt.in, err, tt.valid)
+			continue
+		}
+		if tt.valid && got != tt.want {
+			t.Errorf("%s: got %v, wanted %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+
+	t.Run("fixed window", func(t *testing.T) {
+		limit := Limit{Requests: 3, Period: time.Minute, Algorithm: FixedWindow}
+		for i := 0; i < 3; i++ {
+			result, _ := limiter.Allow(ctx, "ip:1.2.3.4", limit)
+			if !result.Allowed || result.Remaining != 2-i {
+				t.Errorf("request %d: got %+v, wanted allowed", i+1, result)
+			}
+		}
+		result, _ := limiter.Allow(ctx, "ip:1.2.3.4", limit)
+		if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > time.Minute {
+			t.Errorf("got %+v, wanted denied until the window ends", result)
+		}
+		if other, _ := limiter.Allow(ctx, "ip:5.6.7.8", limit); !other.Allowed {
+			t.Error("got denied, wanted other keys to be allowed")
+		}
+		now = now.Add(result.RetryAfter)
+		if result, _ := limiter.Allow(ctx, "ip:1.2.3.4", limit); !result.Allowed {
+			t.Errorf("got %+v, wanted allowed in the next window", result)
+		}
+	})
+
+	t.Run("token bucket", func(t *testing.T) {
+		limit := Limit{Requests: 2, Period: 2 * time.Second, Algorithm: TokenBucket}
+		for i := 0; i < 2; i++ {
+			if result, _ := limiter.Allow(ctx, "user:42", limit); !result.Allowed {
+				t.Errorf("request %d: got denied, wanted the burst to be allowed", i+1)
+			}
+		}
+		result, _ := limiter.Allow(ctx, "user:42", limit)
+		if result.Allowed || result.RetryAfter != time.Second {
+			t.Errorf("got %+v, wanted denied for a second", result)
+		}
+		now = now.Add(time.Second)
+		result, _ = limiter.Allow(ctx, "user:42", limit)
+		if !result.Allowed || result.Remaining != 0 {
+			t.Errorf("got %+v, wanted one refilled token", result)
+		}
+		now = now.Add(time.Minute)
+		result, _ = limiter.Allow(ctx, "user:42", limit)
+		if !result.Allowed || result.Remaining != 1 {
+			t.Errorf("got %+v, wanted the bucket capped at its size", result)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript refills and takes from a bucket atomically. The redis clock
+// is used so instances with skewed clocks agree on the refill.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + (now - ts) * capacity / period)
+
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisLimiter shares the counters between all API instances.
+type RedisLimiter struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func NewRedisLimiter(rdb *redis.Client, prefix string) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb, prefix: prefix}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Algorithm == TokenBucket {
+		return r.tokenBucket(ctx, key, limit)
+	}
+	return r.fixedWindow(ctx, key, limit)
+}
+
+func (r *RedisLimiter) fixedWindow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	window := now.UnixNano() / int64(limit.Period)
+	end := time.Unix(0, (window+1)*int64(limit.Period))
+	cacheKey := fmt.Sprintf("%s-fw-%s-%d", r.prefix, key, window)
+
+	pipe := r.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, cacheKey)
+	pipe.PExpireAt(ctx, cacheKey, end)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Result{}, err
+	}
+	return fixedWindowResult(incr.Val(), limit, end.Sub(now)), nil
+}
+
+func (r *RedisLimiter) tokenBucket(ctx context.Context, key string, limit Limit) (Result, error) {
+	cacheKey := fmt.Sprintf("%s-tb-%s", r.prefix, key)
+	values, err := tokenBucketScript.Run(
+		ctx,
+		r.rdb,
+		[]string{cacheKey},
+		limit.Requests,
+		limit.Period.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected token bucket reply %v", values)
+	}
+	allowed, _ := values[0].(int64)
+	tokensString, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensString, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return tokenBucketResult(allowed == 1, tokens, limit), nil
+}
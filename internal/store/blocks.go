@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// ListedUser is a user on the block, mute or follow request list of another
+// user.
+type ListedUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+	// when the user was put on the list
+	ListedAt string `json:"listed_at"`
+}
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block puts blockedID on the block list of the user and removes the follows
+// and follow requests between them in both directions. Blocking a user twice
+// is not an error.
+func (s *BlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+INSERT INTO blocks(user_id, blocked_id) VALUES($1, $2) ON CONFLICT DO NOTHING
+`
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return listConstraintError(err)
+		}
+		query = `
+DELETE FROM follow_requests
+WHERE (user_id = $1 AND target_id = $2) OR (user_id = $2 AND target_id = $1)
+`
+		if _, err := tx.ExecContext(ctx, query, userID, blockedID); err != nil {
+			return err
+		}
+		query = `
+DELETE FROM followers
+WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+RETURNING follower_id
+`
+		rows, err := tx.QueryContext(ctx, query, userID, blockedID)
+		if err != nil {
+			return err
+		}
+		unfollowed := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			unfollowed = append(unfollowed, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range unfollowed {
+			query = `UPDATE users SET followers_count = followers_count - 1 WHERE id = $1`
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Unblock takes blockedID off the block list of the user. Follows removed by
+// the block are not restored.
+func (s *BlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	return s.unlist(ctx, `DELETE FROM blocks WHERE user_id = $1 AND blocked_id = $2`, userID, blockedID)
+}
+
+// Mute hides the posts of mutedID from the feed of the user. Muting a user
+// twice is not an error.
+func (s *BlockStore) Mute(ctx context.Context, userID, mutedID int64) error {
+	query := `
+INSERT INTO mutes(user_id, muted_id) VALUES($1, $2) ON CONFLICT DO NOTHING
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, userID, mutedID)
+	return listConstraintError(err)
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, userID, mutedID int64) error {
+	return s.unlist(ctx, `DELETE FROM mutes WHERE user_id = $1 AND muted_id = $2`, userID, mutedID)
+}
+
+func (s *BlockStore) unlist(ctx context.Context, query string, userID, listedID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID, listedID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// IsBlocked tells if either user blocked the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	query := `
+SELECT EXISTS(
+  SELECT 1 FROM blocks
+  WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+)
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+// ListBlocked returns a page of the block list of the user, the latest
+// blocks first.
+func (s *BlockStore) ListBlocked(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error) {
+	return s.list(ctx, "blocks", "blocked_id", userID, q)
+}
+
+// ListMuted returns a page of the mute list of the user, the latest mutes
+// first.
+func (s *BlockStore) ListMuted(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error) {
+	return s.list(ctx, "mutes", "muted_id", userID, q)
+}
+
+func (s *BlockStore) list(
+	ctx context.Context,
+	table, listed string,
+	userID int64,
+	q PaginatedFollowQuery,
+) ([]ListedUser, error) {
+	after := Cursor{CreatedAt: "epoch"}
+	if q.Cursor != "" {
+		var err error
+		if after, err = DecodeCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	query := `
+SELECT u.id, u.username, u.avatar_url, l.created_at
+FROM ` + table + ` l
+JOIN users u ON u.id = l.` + listed + `
+WHERE l.user_id = $1
+  AND ($2 = 0 OR (l.created_at, u.id) < ($3::timestamptz, $2))
+ORDER BY l.created_at DESC, u.id DESC
+LIMIT $4
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, after.ID, after.CreatedAt, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []ListedUser{}
+	for rows.Next() {
+		var u ListedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.AvatarURL, &u.ListedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// listConstraintError maps listing a user that does not exist to ErrorNotFound.
+func listConstraintError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		return ErrorNotFound
+	}
+	return err
+}
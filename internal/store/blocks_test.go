@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBlocksAndMutes(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db}
+	posts := &PostStore{db}
+	comments := &CommentStore{db}
+	blocks := &BlockStore{db}
+	ctx := context.Background()
+
+	viewer := insertUser(t, db, "viewer")
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	for _, follow := range [][2]int64{{viewer, alice}, {alice, viewer}, {viewer, bob}} {
+		if err := users.AddFollower(ctx, follow[0], follow[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alicePost := insertPost(t, db, alice, testPost{})
+	bobPost := insertPost(t, db, bob, testPost{})
+	viewerPost := insertPost(t, db, viewer, testPost{})
+	insertComment(t, db, viewerPost, alice)
+	bobComment := insertComment(t, db, viewerPost, bob)
+
+	t.Run("should remove follows both ways when blocking", func(t *testing.T) {
+		if err := blocks.Block(ctx, viewer, alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := blocks.Block(ctx, viewer, alice); err != nil {
+			t.Errorf("blocking twice: %v", err)
+		}
+		for _, id := range []int64{viewer, alice} {
+			p, err := users.GetProfile(ctx, id, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.FollowersCount != 0 {
+				t.Errorf("user %d has %d followers", id, p.FollowersCount)
+			}
+		}
+	})
+	t.Run("should refuse follows between blocked users", func(t *testing.T) {
+		if err := users.AddFollower(ctx, alice, viewer); !errors.Is(err, ErrBlocked) {
+			t.Errorf("got %v, wanted %v", err, ErrBlocked)
+		}
+		blocked, err := blocks.IsBlocked(ctx, alice, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !blocked {
+			t.Error("block should work both ways")
+		}
+	})
+	t.Run("should hide blocked content", func(t *testing.T) {
+		follow(t, db, viewer, alice)
+		if got := feedIDs(t, posts, viewer, PaginatedFeedQuery{}); slices.Contains(got, alicePost) {
+			t.Errorf("feed %v has a post of a blocked user", got)
+		}
+		own, err := posts.GetUserPosts(ctx, viewer, alice, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(own) != 0 {
+			t.Errorf("got %d posts of a blocked user", len(own))
+		}
+		listed, err := comments.GetByPostID(ctx, viewerPost, viewer, PaginatedCommentQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != 1 || listed[0].ID != bobComment {
+			t.Errorf("got comments %+v, wanted only %d", listed, bobComment)
+		}
+	})
+	t.Run("should hide muted posts from the feed only", func(t *testing.T) {
+		if err := blocks.Mute(ctx, viewer, bob); err != nil {
+			t.Fatal(err)
+		}
+		if got := feedIDs(t, posts, viewer, PaginatedFeedQuery{}); slices.Contains(got, bobPost) {
+			t.Errorf("feed %v has a post of a muted user", got)
+		}
+		own, err := posts.GetUserPosts(ctx, viewer, bob, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(own) != 1 {
+			t.Errorf("got %d posts of a muted user, wanted 1", len(own))
+		}
+		if err := blocks.Unmute(ctx, viewer, bob); err != nil {
+			t.Fatal(err)
+		}
+		if got := feedIDs(t, posts, viewer, PaginatedFeedQuery{}); !slices.Contains(got, bobPost) {
+			t.Errorf("feed %v misses a post of an unmuted user", got)
+		}
+	})
+	t.Run("should list and unblock", func(t *testing.T) {
+		listed, err := blocks.ListBlocked(ctx, viewer, PaginatedFollowQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != 1 || listed[0].ID != alice {
+			t.Errorf("got %+v", listed)
+		}
+		if err := blocks.Unblock(ctx, viewer, alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := blocks.Unblock(ctx, viewer, alice); !errors.Is(err, ErrorNotFound) {
+			t.Errorf("got %v, wanted %v", err, ErrorNotFound)
+		}
+	})
+	t.Run("should not list unknown users", func(t *testing.T) {
+		if err := blocks.Block(ctx, viewer, 1000); !errors.Is(err, ErrorNotFound) {
+			t.Errorf("got %v, wanted %v", err, ErrorNotFound)
+		}
+	})
+}
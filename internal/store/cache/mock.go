@@ -8,7 +8,8 @@ import (
 
 func NewMockCache() Storage {
 	return Storage{
-		Users: &MockUserCache{},
+		Users:     &MockUserCache{},
+		Timelines: &MockTimelineCache{},
 	}
 }
 
@@ -21,3 +22,30 @@ func (m *MockUserCache) Get(context.Context, *store.User, int64) error {
 func (m *MockUserCache) Set(context.Context, *store.User) error {
 	return nil
 }
+
+func (m *MockUserCache) Delete(context.Context, int64) error {
+	return nil
+}
+
+// MockTimelineCache never has a timeline cached.
+type MockTimelineCache struct{}
+
+func (m *MockTimelineCache) Get(context.Context, int64, store.Cursor, int) ([]store.TimelineEntry, error) {
+	return nil, ErrNotCached
+}
+
+func (m *MockTimelineCache) Fill(context.Context, int64, []store.TimelineEntry) error {
+	return nil
+}
+
+func (m *MockTimelineCache) Push(context.Context, store.TimelineEntry, ...int64) error {
+	return nil
+}
+
+func (m *MockTimelineCache) Remove(context.Context, int64, ...int64) error {
+	return nil
+}
+
+func (m *MockTimelineCache) Delete(context.Context, int64) error {
+	return nil
+}
@@ -11,11 +11,22 @@ type Storage struct {
 	Users interface {
 		Get(context.Context, *store.User, int64) error
 		Set(context.Context, *store.User) error
+		Delete(ctx context.Context, userID int64) error
+	}
+	Timelines interface {
+		Get(ctx context.Context, userID int64, before store.Cursor, limit int) ([]store.TimelineEntry, error)
+		Fill(ctx context.Context, userID int64, entries []store.TimelineEntry) error
+		Push(ctx context.Context, entry store.TimelineEntry, userIDs ...int64) error
+		Remove(ctx context.Context, postID int64, userIDs ...int64) error
+		Delete(ctx context.Context, userID int64) error
 	}
 }
 
-func NewRedisStorage(rdb *redis.Client) Storage {
+// NewRedisStorage returns the redis cache, timelines keep up to timelineSize
+// posts.
+func NewRedisStorage(rdb *redis.Client, timelineSize int) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Users:     &UserStore{rdb: rdb},
+		Timelines: &TimelineStore{rdb: rdb, size: int64(timelineSize)},
 	}
 }
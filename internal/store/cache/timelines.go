@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rijojohn85/social/internal/store"
+)
+
+// ErrNotCached is returned for timelines that have to be filled first.
+var ErrNotCached = errors.New("timeline not cached")
+
+// timelineTTL is how long a timeline nobody reads is kept.
+const timelineTTL = time.Hour * 24
+
+// timelineSentinel is kept below every post so empty timelines still exist.
+const timelineSentinel = "0"
+
+// TimelineStore keeps home timelines as sorted sets of post ids scored by the
+// creation time of the post in microseconds, so posts created in the same
+// second still get distinct, ordered scores. The ids are zero padded so posts
+// created at the same time are ordered by id, like in the database.
+type TimelineStore struct {
+	rdb *redis.Client
+	// posts kept per timeline
+	size int64
+}
+
+// timelineKey changed when the scores went from seconds to microseconds, the
+// timelines under the old key expire unread.
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("home-timeline-%d", userID)
+}
+
+func timelineMember(postID int64) string {
+	return fmt.Sprintf("%019d", postID)
+}
+
+// pushScript adds a post to a timeline that is cached and drops the oldest
+// posts beyond the size.
+var pushScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZREMRANGEBYRANK', KEYS[1], 1, -(tonumber(ARGV[3]) + 1))
+return 1
+`)
+
+// getScript reads posts at or below a score. Posts sharing the score of the
+// cursor may come before it, so that many more are read.
+var getScript = redis.NewScript(`
+if redis.call('EXPIRE', KEYS[1], ARGV[3]) == 0 then
+  return false
+end
+local ties = 0
+if ARGV[1] ~= '+inf' then
+  ties = redis.call('ZCOUNT', KEYS[1], ARGV[1], ARGV[1])
+end
+return redis.call(
+  'ZREVRANGEBYSCORE', KEYS[1], ARGV[1], '-inf', 'WITHSCORES', 'LIMIT', 0, tonumber(ARGV[2]) + ties
+)
+`)
+
+// Get returns up to limit posts of the cached timeline of the user that come
+// before the cursor, newest first. Fewer posts are returned when the cache
+// runs out.
+func (s *TimelineStore) Get(
+	ctx context.Context,
+	userID int64,
+	before store.Cursor,
+	limit int,
+) ([]store.TimelineEntry, error) {
+	maxScore := "+inf"
+	var beforeAt int64
+	if before.ID != 0 {
+		t, err := time.Parse(time.RFC3339, before.CreatedAt)
+		if err != nil {
+			return nil, store.ErrInvalidCursor
+		}
+		beforeAt = t.UnixMicro()
+		maxScore = strconv.FormatInt(beforeAt, 10)
+	}
+	values, err := getScript.Run(
+		ctx,
+		s.rdb,
+		[]string{timelineKey(userID)},
+		maxScore,
+		limit,
+		int(timelineTTL.Seconds()),
+	).StringSlice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotCached
+		}
+		return nil, err
+	}
+	entries := []store.TimelineEntry{}
+	for i := 0; i+1 < len(values) && len(entries) < limit; i += 2 {
+		if values[i] == timelineSentinel {
+			break
+		}
+		id, err := strconv.ParseInt(values[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		score, err := strconv.ParseInt(values[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if before.ID != 0 && score == beforeAt && id >= before.ID {
+			continue
+		}
+		entries = append(entries, store.TimelineEntry{PostID: id, CreatedAt: time.UnixMicro(score)})
+	}
+	return entries, nil
+}
+
+// Fill replaces the timeline of the user with the given posts.
+func (s *TimelineStore) Fill(ctx context.Context, userID int64, entries []store.TimelineEntry) error {
+	key := timelineKey(userID)
+	members := []*redis.Z{{Score: math.Inf(-1), Member: timelineSentinel}}
+	for _, entry := range entries {
+		members = append(members, &redis.Z{
+			Score:  float64(entry.CreatedAt.UnixMicro()),
+			Member: timelineMember(entry.PostID),
+		})
+	}
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZAdd(ctx, key, members...)
+		pipe.ZRemRangeByRank(ctx, key, 1, -(s.size + 1))
+		pipe.Expire(ctx, key, timelineTTL)
+		return nil
+	})
+	return err
+}
+
+// Push adds a post to the cached timelines of the given users. Timelines that
+// are not cached are left alone, they are filled when they are read.
+func (s *TimelineStore) Push(ctx context.Context, entry store.TimelineEntry, userIDs ...int64) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range userIDs {
+			pushScript.Eval(
+				ctx,
+				pipe,
+				[]string{timelineKey(userID)},
+				entry.CreatedAt.UnixMicro(),
+				timelineMember(entry.PostID),
+				s.size,
+			)
+		}
+		return nil
+	})
+	return err
+}
+
+// Remove takes a post out of the timelines of the given users.
+func (s *TimelineStore) Remove(ctx context.Context, postID int64, userIDs ...int64) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range userIDs {
+			pipe.ZRem(ctx, timelineKey(userID), timelineMember(postID))
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete drops the timeline of the user, it is filled again on the next read.
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) error {
+	return s.rdb.Del(ctx, timelineKey(userID)).Err()
+}
@@ -41,3 +41,7 @@ func (r *UserStore) Set(ctx context.Context, user *store.User) error {
 
 	return r.rdb.SetEX(ctx, cacheKey, json, time.Minute*10).Err()
 }
+
+func (r *UserStore) Delete(ctx context.Context, userID int64) error {
+	return r.rdb.Del(ctx, fmt.Sprintf("user-%d", userID)).Err()
+}
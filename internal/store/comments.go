@@ -3,74 +3,369 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
 )
 
+// MaxCommentDepth is how deep replies can nest, top level comments have depth 0.
+var MaxCommentDepth = 5
+
+// DeletedCommentContent replaces the content of deleted comments that are kept
+// because they have replies.
+const DeletedCommentContent = "[deleted]"
+
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserId    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	User      User   `json:"user"`
+	ID        int64   `json:"id"`
+	PostID    int64   `json:"post_id"`
+	ParentID  *int64  `json:"parent_id"`
+	Depth     int     `json:"depth"`
+	UserId    int64   `json:"user_id"`
+	Content   string  `json:"content"`
+	Deleted   bool    `json:"deleted"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+	User      User    `json:"user"`
+	Path      []int64 `json:"-"`
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
-	query := `
-  INSERT INTO comments(content, user_id, post_id)
-  VALUES ($1, $2, $3) RETURNING id, created_at
-  `
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
-	defer cancel()
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		comment.Content,
-		comment.UserId,
-		comment.PostID,
-	).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
+const commentColumns = `
+	c.id, c.post_id, c.parent_id, c.depth, c.path, c.user_id, c.content,
+	c.deleted_at IS NOT NULL, c.created_at, c.updated_at, COALESCE(users.username, '')
+`
+
+func scanComment(row interface{ Scan(...any) error }, c *Comment) error {
+	err := row.Scan(
+		&c.ID,
+		&c.PostID,
+		&c.ParentID,
+		&c.Depth,
+		pq.Array(&c.Path),
+		&c.UserId,
+		&c.Content,
+		&c.Deleted,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.User.Username,
 	)
 	if err != nil {
 		return err
 	}
+	c.User.ID = c.UserId
+	if c.Deleted {
+		c.Content = DeletedCommentContent
+		c.UserId = 0
+		c.User = User{}
+	}
 	return nil
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// Create adds a comment, or a reply when ParentID is set. The parent has to be
+// a comment of the same post that was not deleted.
+func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		parentPath := []int64{}
+		comment.Depth = 0
+		if comment.ParentID != nil {
+			query := `
+  SELECT depth, path FROM comments
+  WHERE id = $1 AND post_id = $2 AND deleted_at IS NULL
+  FOR SHARE
+  `
+			var depth int
+			err := tx.QueryRowContext(ctx, query, *comment.ParentID, comment.PostID).Scan(
+				&depth,
+				pq.Array(&parentPath),
+			)
+			if err != nil {
+				switch {
+				case errors.Is(err, sql.ErrNoRows):
+					return ErrParentNotFound
+				default:
+					return err
+				}
+			}
+			if depth+1 > MaxCommentDepth {
+				return ErrMaxDepth
+			}
+			comment.Depth = depth + 1
+		}
+		query := `
+  INSERT INTO comments(id, content, user_id, post_id, parent_id, depth, path)
+  SELECT v.id, $1, $2, $3, $4, $5, $6::bigint[] || v.id
+  FROM (SELECT nextval('comments_id_seq') AS id) v
+  RETURNING id, path, created_at, updated_at
+  `
+		return tx.QueryRowContext(
+			ctx,
+			query,
+			comment.Content,
+			comment.UserId,
+			comment.PostID,
+			comment.ParentID,
+			comment.Depth,
+			pq.Array(parentPath),
+		).Scan(
+			&comment.ID,
+			pq.Array(&comment.Path),
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+		)
+	})
+}
+
+// GetByPostID returns a page of the comments of a post as a flat list in
+// thread order: newest threads first, replies below their parent oldest first.
+// The page starts after cq.Cursor when it is set. Comments of users that
+// viewerID blocked or was blocked by are left out.
+func (s *CommentStore) GetByPostID(
+	ctx context.Context,
+	postID, viewerID int64,
+	cq PaginatedCommentQuery,
+) ([]Comment, error) {
+	after, err := threadCursor(cq)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	SELECT ` + commentColumns + `
+	FROM comments c
+	LEFT JOIN users on c.user_id = users.id
+	WHERE c.post_id = $1
+	  AND (
+	    cardinality($2::bigint[]) = 0
+	    OR c.path[1] < ($2::bigint[])[1]
+	    OR (c.path[1] = ($2::bigint[])[1] AND c.path > $2::bigint[])
+	  )
+	  AND ` + commentNotBlocked("$4") + `
+	ORDER BY c.path[1] DESC, c.path
+	LIMIT $3
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return s.queryComments(ctx, query, postID, pq.Array(after.Path), cq.Limit, viewerID)
+}
+
+// GetThread returns a page of the comment with the given id and its replies in
+// thread order, without the comments hidden from viewerID by blocks.
+func (s *CommentStore) GetThread(
+	ctx context.Context,
+	root *Comment,
+	viewerID int64,
+	cq PaginatedCommentQuery,
+) ([]Comment, error) {
+	after, err := threadCursor(cq)
+	if err != nil {
+		return nil, err
+	}
 	query := `
-	SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id   from comments c
-	JOIN users on c.user_id = users.id
-	where c.post_id = $1
-ORDER BY c.created_at DESC
+	SELECT ` + commentColumns + `
+	FROM comments c
+	LEFT JOIN users on c.user_id = users.id
+	WHERE c.post_id = $1
+	  AND c.path[$2] = $3
+	  AND (cardinality($4::bigint[]) = 0 OR c.path > $4::bigint[])
+	  AND ` + commentNotBlocked("$6") + `
+	ORDER BY c.path
+	LIMIT $5
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	return s.queryComments(
+		ctx,
+		query,
+		root.PostID,
+		root.Depth+1,
+		root.ID,
+		pq.Array(after.Path),
+		cq.Limit,
+		viewerID,
+	)
+}
+
+// commentNotBlocked leaves out comments of users that the viewer in the given
+// argument blocked or was blocked by.
+func commentNotBlocked(viewer string) string {
+	return `NOT EXISTS (
+	    SELECT 1 FROM blocks b
+	    WHERE (b.user_id = ` + viewer + ` AND b.blocked_id = c.user_id)
+	      OR (b.user_id = c.user_id AND b.blocked_id = ` + viewer + `)
+	  )`
+}
+
+func threadCursor(cq PaginatedCommentQuery) (ThreadCursor, error) {
+	if cq.Cursor == "" {
+		return ThreadCursor{Path: []int64{}}, nil
+	}
+	return DecodeThreadCursor(cq.Cursor)
+}
+
+func (s *CommentStore) queryComments(ctx context.Context, query string, args ...any) ([]Comment, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
-	var comments []Comment
+	defer rows.Close()
+	comments := []Comment{}
 	for rows.Next() {
 		var c Comment
-		c.User = User{}
-		err := rows.Scan(
-			&c.ID,
-			&c.PostID,
-			&c.User.ID,
-			&c.Content,
-			&c.CreatedAt,
-			&c.User.Username,
-			&c.UserId,
-		)
-		if err != nil {
+		if err := scanComment(rows, &c); err != nil {
 			return nil, err
 		}
 		comments = append(comments, c)
 	}
-	return comments, nil
+	return comments, rows.Err()
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM comments c
+	LEFT JOIN users on c.user_id = users.id
+	WHERE c.id = $1
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	c := &Comment{}
+	err := scanComment(s.db.QueryRowContext(ctx, query, id), c)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+	UPDATE comments SET content = $1, updated_at = NOW()
+	WHERE id = $2 AND deleted_at IS NULL
+	RETURNING updated_at
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		comment.Content,
+		comment.ID,
+	).Scan(&comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a comment. A comment with replies is kept as a tombstone
+// without content so the thread below it stays intact. Tombstones left without
+// replies by the delete are removed too, up the thread.
+func (s *CommentStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// the lock keeps replies from being added until we decided
+		query := `
+	SELECT EXISTS(SELECT 1 FROM comments WHERE parent_id = c.id)
+	FROM comments c
+	WHERE c.id = $1 AND c.deleted_at IS NULL
+	FOR UPDATE
+`
+		var hasReplies bool
+		if err := tx.QueryRowContext(ctx, query, id).Scan(&hasReplies); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		if hasReplies {
+			query = `UPDATE comments SET content = '', deleted_at = NOW() WHERE id = $1`
+			_, err := tx.ExecContext(ctx, query, id)
+			return err
+		}
+		for {
+			// the parent is locked before its reply goes, so replies deleted at
+			// the same time see each other gone
+			parentID, tombstone, err := lockParent(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			query = `
+	DELETE FROM comments c
+	WHERE c.id = $1
+	  AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+`
+			res, err := tx.ExecContext(ctx, query, id)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 || parentID == nil || !tombstone {
+				return nil
+			}
+			id = *parentID
+		}
+	})
+}
+
+// deleteEmptyTombstones removes the tombstones on the posts that have no
+// replies left, a level of the threads at a time until none is left.
+func deleteEmptyTombstones(ctx context.Context, tx *sql.Tx, postIDs []int64) error {
+	query := `
+	DELETE FROM comments c
+	WHERE c.post_id = ANY($1)
+	  AND c.deleted_at IS NOT NULL
+	  AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)
+`
+	for {
+		res, err := tx.ExecContext(ctx, query, pq.Array(postIDs))
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+// lockParent locks the parent of a comment and returns its id, nil for top
+// level comments, and whether it is a tombstone.
+func lockParent(ctx context.Context, tx *sql.Tx, id int64) (*int64, bool, error) {
+	query := `
+	SELECT p.id, p.deleted_at IS NOT NULL
+	FROM comments c
+	JOIN comments p ON p.id = c.parent_id
+	WHERE c.id = $1
+	FOR UPDATE OF p
+`
+	var parentID int64
+	var tombstone bool
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&parentID, &tombstone); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, false, nil
+		default:
+			return nil, false, err
+		}
+	}
+	return &parentID, tombstone, nil
 }
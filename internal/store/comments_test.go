@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeleteComment(t *testing.T) {
+	db := newTestDB(t)
+	comments := &CommentStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	post := insertPost(t, db, alice, testPost{})
+	reply := func(t *testing.T, parentID int64) int64 {
+		t.Helper()
+		comment := &Comment{PostID: post, UserId: alice, Content: "reply", ParentID: &parentID}
+		if err := comments.Create(ctx, comment); err != nil {
+			t.Fatal(err)
+		}
+		return comment.ID
+	}
+	del := func(t *testing.T, id int64) {
+		t.Helper()
+		if err := comments.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(t *testing.T, id int64) bool {
+		t.Helper()
+		var found bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1)`, id).Scan(&found); err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+
+	t.Run("should keep a tombstone while it has replies", func(t *testing.T) {
+		parent := insertComment(t, db, post, alice)
+		first, second := reply(t, parent), reply(t, parent)
+		del(t, parent)
+		del(t, first)
+		if !exists(t, parent) {
+			t.Fatal("tombstone deleted with a reply left")
+		}
+		del(t, second)
+		if exists(t, parent) {
+			t.Error("tombstone kept without replies")
+		}
+	})
+	t.Run("should delete tombstones up the thread", func(t *testing.T) {
+		root := insertComment(t, db, post, alice)
+		mid := reply(t, root)
+		leaf := reply(t, mid)
+		del(t, root)
+		del(t, mid)
+		del(t, leaf)
+		for _, id := range []int64{root, mid, leaf} {
+			if exists(t, id) {
+				t.Errorf("comment %d kept", id)
+			}
+		}
+	})
+	t.Run("should keep the parent that was not deleted", func(t *testing.T) {
+		parent := insertComment(t, db, post, alice)
+		del(t, reply(t, parent))
+		if !exists(t, parent) {
+			t.Error("parent deleted with its reply")
+		}
+	})
+}
+
+func TestDeleteUserComments(t *testing.T) {
+	db := newTestDB(t)
+	comments := &CommentStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	post := insertPost(t, db, alice, testPost{})
+	reply := func(t *testing.T, userID, parentID int64) int64 {
+		t.Helper()
+		comment := &Comment{PostID: post, UserId: userID, Content: "reply", ParentID: &parentID}
+		if err := comments.Create(ctx, comment); err != nil {
+			t.Fatal(err)
+		}
+		return comment.ID
+	}
+	exists := func(t *testing.T, id int64) bool {
+		t.Helper()
+		var found bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM comments WHERE id = $1)`, id).Scan(&found); err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+
+	// bob answered himself, and was the last to answer a deleted comment of
+	// alice
+	own := insertComment(t, db, post, bob)
+	ownReply := reply(t, bob, own)
+	tombstone := insertComment(t, db, post, alice)
+	bobReply := reply(t, bob, tombstone)
+	if err := comments.Delete(ctx, tombstone); err != nil {
+		t.Fatal(err)
+	}
+	// alice answered bob, his comment stays for her reply
+	kept := insertComment(t, db, post, bob)
+	aliceReply := reply(t, alice, kept)
+
+	if err := (&UserStore{db}).Delete(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{own, ownReply, tombstone, bobReply} {
+		if exists(t, id) {
+			t.Errorf("comment %d kept", id)
+		}
+	}
+	for _, id := range []int64{kept, aliceReply} {
+		if !exists(t, id) {
+			t.Errorf("comment %d deleted", id)
+		}
+	}
+}
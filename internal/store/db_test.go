@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// newTestDB returns a connection to the database in TEST_DB_ADDR with a fresh
+// schema built from the migrations. The public schema is dropped, so point it
+// at a throwaway database. Tests are skipped when it is not set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+	db, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+	}
+	return db
+}
+
+func insertUser(t *testing.T, db *sql.DB, username string) int64 {
+	t.Helper()
+	var id int64
+	err := db.QueryRow(
+		`INSERT INTO users(email, username, password, is_active) VALUES ($1, $2, '', TRUE) RETURNING id`,
+		username+"@example.com",
+		username,
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// follow makes userID follow followeeID.
+func follow(t *testing.T, db *sql.DB, userID, followeeID int64) {
+	t.Helper()
+	_, err := db.Exec(`INSERT INTO followers(user_id, follower_id) VALUES ($1, $2)`, userID, followeeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testPost struct {
+	title     string
+	content   string
+	tags      []string
+	createdAt time.Time
+}
+
+func insertPost(t *testing.T, db *sql.DB, userID int64, p testPost) int64 {
+	t.Helper()
+	if p.title == "" {
+		p.title = fmt.Sprintf("post of %d", userID)
+	}
+	if p.createdAt.IsZero() {
+		p.createdAt = time.Now()
+	}
+	var id int64
+	err := db.QueryRow(
+		`INSERT INTO posts(user_id, title, content, tags, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		userID,
+		p.title,
+		p.content,
+		pq.Array(p.tags),
+		p.createdAt,
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func insertComment(t *testing.T, db *sql.DB, postID, userID int64) int64 {
+	t.Helper()
+	comment := &Comment{PostID: postID, UserId: userID, Content: "nice"}
+	if err := (&CommentStore{db}).Create(context.Background(), comment); err != nil {
+		t.Fatal(err)
+	}
+	return comment.ID
+}
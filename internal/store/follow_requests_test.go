@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPrivateAccounts(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db}
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	viewer := insertUser(t, db, "viewer")
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	if err := users.UpdateProfile(ctx, &User{ID: alice, Username: "alice", IsPrivate: true}); err != nil {
+		t.Fatal(err)
+	}
+	alicePost := insertPost(t, db, alice, testPost{})
+	userPosts := func(viewerID int64) []int64 {
+		t.Helper()
+		feed, err := posts.GetUserPosts(ctx, viewerID, alice, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return feedIDsOf(feed)
+	}
+
+	t.Run("should hide posts from non followers", func(t *testing.T) {
+		if got := userPosts(viewer); len(got) != 0 {
+			t.Errorf("got posts %v", got)
+		}
+		if got := userPosts(alice); !slices.Equal(got, []int64{alicePost}) {
+			t.Errorf("author got posts %v", got)
+		}
+	})
+	t.Run("should follow after the request is approved", func(t *testing.T) {
+		if err := users.CreateFollowRequest(ctx, viewer, alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.CreateFollowRequest(ctx, viewer, alice); err != nil {
+			t.Errorf("asking twice: %v", err)
+		}
+		p, err := users.GetProfile(ctx, alice, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.IsPrivate || !p.ViewerRequested || p.ViewerFollows {
+			t.Errorf("got %+v", p)
+		}
+		requests, err := users.ListFollowRequests(ctx, alice, PaginatedFollowQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(requests) != 1 || requests[0].ID != viewer {
+			t.Errorf("got requests %+v", requests)
+		}
+		if err := users.ApproveFollowRequest(ctx, alice, viewer); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.ApproveFollowRequest(ctx, alice, viewer); !errors.Is(err, ErrorNotFound) {
+			t.Errorf("got %v, wanted %v", err, ErrorNotFound)
+		}
+		if got := userPosts(viewer); !slices.Equal(got, []int64{alicePost}) {
+			t.Errorf("follower got posts %v", got)
+		}
+		if got := feedIDs(t, posts, viewer, PaginatedFeedQuery{}); !slices.Contains(got, alicePost) {
+			t.Errorf("feed %v misses the post", got)
+		}
+		if err := users.CreateFollowRequest(ctx, viewer, alice); !errors.Is(err, ErrUserAlreadyFollows) {
+			t.Errorf("got %v, wanted %v", err, ErrUserAlreadyFollows)
+		}
+	})
+	t.Run("should reject requests", func(t *testing.T) {
+		if err := users.CreateFollowRequest(ctx, bob, alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.RejectFollowRequest(ctx, alice, bob); err != nil {
+			t.Fatal(err)
+		}
+		following, err := users.IsFollowing(ctx, bob, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if following {
+			t.Error("rejected request was followed")
+		}
+	})
+	t.Run("should approve pending requests when going public", func(t *testing.T) {
+		if err := users.CreateFollowRequest(ctx, bob, alice); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.UpdateProfile(ctx, &User{ID: alice, Username: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+		p, err := users.GetProfile(ctx, alice, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.ViewerFollows || p.ViewerRequested || p.FollowersCount != 2 {
+			t.Errorf("got %+v", p)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	LockoutKindEmail = "email"
+	LockoutKindIP    = "ip"
+)
+
+// Lockout records that repeated failed logins locked an email or an ip.
+type Lockout struct {
+	ID          int64      `json:"id"`
+	Kind        string     `json:"kind"`
+	Key         string     `json:"key"`
+	Failures    int64      `json:"failures"`
+	LockedUntil time.Time  `json:"locked_until"`
+	UnlockedAt  *time.Time `json:"unlocked_at"`
+	UnlockedBy  *int64     `json:"unlocked_by"`
+	CreatedAt   string     `json:"created_at"`
+}
+
+type LockoutStore struct {
+	db *sql.DB
+}
+
+func (s *LockoutStore) Create(ctx context.Context, lockout *Lockout) error {
+	query := `
+INSERT INTO login_lockouts(kind, key, failures, locked_until)
+VALUES ($1, $2, $3, $4) RETURNING id, created_at
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		lockout.Kind,
+		lockout.Key,
+		lockout.Failures,
+		lockout.LockedUntil,
+	).Scan(&lockout.ID, &lockout.CreatedAt)
+}
+
+// ListActive returns the lockouts that are still in force, newest first.
+func (s *LockoutStore) ListActive(ctx context.Context) ([]Lockout, error) {
+	query := `
+SELECT id, kind, key, failures, locked_until, unlocked_at, unlocked_by, created_at
+FROM login_lockouts
+WHERE locked_until > NOW() AND unlocked_at IS NULL
+ORDER BY created_at DESC
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lockouts := []Lockout{}
+	for rows.Next() {
+		var l Lockout
+		if err := rows.Scan(
+			&l.ID,
+			&l.Kind,
+			&l.Key,
+			&l.Failures,
+			&l.LockedUntil,
+			&l.UnlockedAt,
+			&l.UnlockedBy,
+			&l.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
+
+// Unlock marks a lockout as lifted by an admin and returns it, so the caller
+// can clear the key in the lockout backend.
+func (s *LockoutStore) Unlock(ctx context.Context, id int64, adminID int64) (*Lockout, error) {
+	query := `
+UPDATE login_lockouts SET unlocked_at = NOW(), unlocked_by = $2
+WHERE id = $1 AND unlocked_at IS NULL
+RETURNING id, kind, key, failures, locked_until, unlocked_at, unlocked_by, created_at
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	l := &Lockout{}
+	err := s.db.QueryRowContext(ctx, query, id, adminID).Scan(
+		&l.ID,
+		&l.Kind,
+		&l.Key,
+		&l.Failures,
+		&l.LockedUntil,
+		&l.UnlockedAt,
+		&l.UnlockedBy,
+		&l.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Media is an uploaded file kept in blob storage. Posts reference it by id.
+type Media struct {
+	ID          int64  `json:"id"`
+	UserID      int64  `json:"user_id"`
+	PostID      *int64 `json:"post_id"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// dimensions of images, nil for other media
+	Width  *int `json:"width"`
+	Height *int `json:"height"`
+	// blob keys, the thumbnail is nil for media without one
+	Key          string  `json:"-"`
+	ThumbnailKey *string `json:"-"`
+	// where the file and thumbnail are served, set by the API
+	URL          string  `json:"url"`
+	ThumbnailURL *string `json:"thumbnail_url"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, m *Media) error {
+	query := `
+INSERT INTO media(user_id, content_type, size, key, thumbnail_key, width, height)
+VALUES($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		m.UserID,
+		m.ContentType,
+		m.Size,
+		m.Key,
+		m.ThumbnailKey,
+		m.Width,
+		m.Height,
+	).Scan(&m.ID, &m.CreatedAt)
+}
+
+func (s *MediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	query := `
+SELECT id, COALESCE(user_id, 0), post_id, content_type, size, key, thumbnail_key, width, height, created_at
+FROM media WHERE id = $1
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	m := &Media{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&m.ID,
+		&m.UserID,
+		&m.PostID,
+		&m.ContentType,
+		&m.Size,
+		&m.Key,
+		&m.ThumbnailKey,
+		&m.Width,
+		&m.Height,
+		&m.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// DeleteUnattached deletes up to limit media that are not attached to a post
+// and older than age, and returns them so their blobs can be deleted.
+func (s *MediaStore) DeleteUnattached(ctx context.Context, age time.Duration, limit int) ([]Media, error) {
+	query := `
+DELETE FROM media
+WHERE id IN (
+  SELECT id FROM media
+  WHERE post_id IS NULL AND created_at < $1
+  ORDER BY created_at
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+) AND post_id IS NULL
+RETURNING id, key, thumbnail_key
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, time.Now().Add(-age), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deleted := []Media{}
+	for rows.Next() {
+		var m Media
+		if err := rows.Scan(&m.ID, &m.Key, &m.ThumbnailKey); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, m)
+	}
+	return deleted, rows.Err()
+}
+
+// setPostMedia makes ids the media attached to the post, they have to be
+// uploaded by userID and not attached to another post. Media that was
+// attached before and is not in ids is detached.
+func setPostMedia(ctx context.Context, tx *sql.Tx, userID, postID int64, ids []int64) error {
+	query := `
+UPDATE media SET post_id = NULL WHERE post_id = $1 AND NOT (id = ANY($2::bigint[]))
+`
+	if _, err := tx.ExecContext(ctx, query, postID, pq.Array(ids)); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	query = `
+UPDATE media SET post_id = $1
+WHERE id = ANY($2::bigint[]) AND user_id = $3 AND (post_id IS NULL OR post_id = $1)
+`
+	result, err := tx.ExecContext(ctx, query, postID, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	unique := slices.Compact(slices.Sorted(slices.Values(ids)))
+	if rows != int64(len(unique)) {
+		return ErrMediaNotFound
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMedia(t *testing.T) {
+	db := newTestDB(t)
+	media := &MediaStore{db}
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	upload := func(t *testing.T, userID int64) int64 {
+		t.Helper()
+		m := &Media{UserID: userID, ContentType: "image/png", Size: 10, Key: "media/key"}
+		if err := media.Create(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		return m.ID
+	}
+
+	t.Run("should attach media to a post", func(t *testing.T) {
+		first, second := upload(t, alice), upload(t, alice)
+		post := &Post{UserID: alice, Title: "t", Content: "c", Tags: []string{}, MediaIDs: []int64{first, second}}
+		if err := posts.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		got := &Post{}
+		if err := posts.GetPostById(ctx, got, post.ID); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.MediaIDs, []int64{first, second}) {
+			t.Errorf("got media %v", got.MediaIDs)
+		}
+
+		post.MediaIDs = []int64{second}
+		if err := posts.Update(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		m, err := media.GetByID(ctx, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.PostID != nil {
+			t.Errorf("got media attached to %d, wanted it detached", *m.PostID)
+		}
+	})
+	t.Run("should refuse media of others", func(t *testing.T) {
+		post := &Post{UserID: alice, Title: "t", Content: "c", Tags: []string{}, MediaIDs: []int64{upload(t, bob)}}
+		if err := posts.Create(ctx, post); !errors.Is(err, ErrMediaNotFound) {
+			t.Errorf("got error %v, wanted ErrMediaNotFound", err)
+		}
+	})
+	t.Run("should delete old unattached media", func(t *testing.T) {
+		attached := upload(t, alice)
+		post := &Post{UserID: alice, Title: "t", Content: "c", Tags: []string{}, MediaIDs: []int64{attached}}
+		if err := posts.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`UPDATE media SET created_at = NOW() - INTERVAL '2 days'`); err != nil {
+			t.Fatal(err)
+		}
+		deleted, err := media.DeleteUnattached(ctx, time.Hour*24, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range deleted {
+			if m.ID == attached {
+				t.Error("deleted attached media")
+			}
+		}
+		if _, err := media.GetByID(ctx, attached); err != nil {
+			t.Errorf("got error %v for attached media", err)
+		}
+		if len(deleted) == 0 {
+			t.Error("deleted no media")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// mentionable picks the users that can be mentioned by username, $2.
+const mentionable = `
+SELECT id FROM users
+WHERE username = ANY($2::varchar[])
+  AND is_active AND deactivated_at IS NULL AND deleted_at IS NULL
+`
+
+type MentionStore struct {
+	db *sql.DB
+}
+
+// SetPostMentions makes the users with the given usernames the ones mentioned
+// in the post, unknown usernames are skipped. It returns the ids of the users
+// that were not mentioned in the post before.
+func (s *MentionStore) SetPostMentions(ctx context.Context, postID int64, usernames []string) ([]int64, error) {
+	return s.set(ctx, "post_mentions", "post_id", postID, usernames)
+}
+
+// SetCommentMentions is SetPostMentions for a comment.
+func (s *MentionStore) SetCommentMentions(ctx context.Context, commentID int64, usernames []string) ([]int64, error) {
+	return s.set(ctx, "comment_mentions", "comment_id", commentID, usernames)
+}
+
+// set replaces the mentions of the row id of the table, column is the name of
+// its id.
+func (s *MentionStore) set(
+	ctx context.Context,
+	table, column string,
+	id int64,
+	usernames []string,
+) ([]int64, error) {
+	if usernames == nil {
+		usernames = []string{}
+	}
+	added := []int64{}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+DELETE FROM ` + table + `
+WHERE ` + column + ` = $1 AND user_id NOT IN (` + mentionable + `)
+`
+		if _, err := tx.ExecContext(ctx, query, id, pq.Array(usernames)); err != nil {
+			return err
+		}
+		query = `
+INSERT INTO ` + table + `(` + column + `, user_id)
+SELECT $1, id FROM (` + mentionable + `) m
+ON CONFLICT DO NOTHING
+RETURNING user_id
+`
+		rows, err := tx.QueryContext(ctx, query, id, pq.Array(usernames))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var userID int64
+			if err := rows.Scan(&userID); err != nil {
+				return err
+			}
+			added = append(added, userID)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	db := newTestDB(t)
+	mentions := &MentionStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	carol := insertUser(t, db, "carol")
+	post := insertPost(t, db, alice, testPost{})
+	comment := insertComment(t, db, post, alice)
+
+	mentioned := func(t *testing.T, table, column string, id int64) []int64 {
+		t.Helper()
+		rows, err := db.Query(`SELECT user_id FROM `+table+` WHERE `+column+` = $1 ORDER BY user_id`, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	t.Run("should store the mentions of a post", func(t *testing.T) {
+		added, err := mentions.SetPostMentions(ctx, post, []string{"bob", "nobody"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(added, []int64{bob}) {
+			t.Errorf("got added %v", added)
+		}
+		added, err = mentions.SetPostMentions(ctx, post, []string{"carol", "bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(added, []int64{carol}) {
+			t.Errorf("got added %v, wanted only the new mention", added)
+		}
+		if _, err := mentions.SetPostMentions(ctx, post, []string{"carol"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := mentioned(t, "post_mentions", "post_id", post); !slices.Equal(got, []int64{carol}) {
+			t.Errorf("got %v", got)
+		}
+	})
+	t.Run("should store the mentions of a comment", func(t *testing.T) {
+		added, err := mentions.SetCommentMentions(ctx, comment, []string{"bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(added, []int64{bob}) {
+			t.Errorf("got added %v", added)
+		}
+		if got := mentioned(t, "comment_mentions", "comment_id", comment); !slices.Equal(got, []int64{bob}) {
+			t.Errorf("got %v", got)
+		}
+	})
+}
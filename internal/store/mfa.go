@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	Confirmed    bool
+	LastUsedStep int64
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+// CreateTOTP starts an enrollment. An unconfirmed secret is replaced, a
+// confirmed one has to be disabled first.
+func (s *MFAStore) CreateTOTP(ctx context.Context, userID int64, secret string) error {
+	query := `
+INSERT INTO user_totp(user_id, secret) VALUES($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+WHERE user_totp.confirmed_at IS NULL;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *MFAStore) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	query := `
+SELECT user_id, secret, confirmed_at IS NOT NULL, last_used_step FROM user_totp WHERE user_id = $1;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	totp := &TOTP{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.Confirmed,
+		&totp.LastUsedStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return totp, nil
+}
+
+// ConfirmTOTP turns 2FA on and replaces the recovery codes, which are only
+// stored hashed.
+func (s *MFAStore) ConfirmTOTP(
+	ctx context.Context,
+	userID int64,
+	step int64,
+	recoveryCodes []string,
+) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL;
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		result, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrMFAAlreadyEnabled
+		}
+		query = `
+DELETE FROM user_recovery_codes WHERE user_id = $1;
+`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+		query = `
+INSERT INTO user_recovery_codes(user_id, code) VALUES($1, $2);
+`
+		for _, code := range recoveryCodes {
+			if _, err := tx.ExecContext(ctx, query, userID, hashToken(code)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseTOTPStep records a successful code. A step at or before the last used one
+// is a replay and returns ErrInvalidToken.
+func (s *MFAStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	query := `
+UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+UPDATE user_recovery_codes SET used_at = NOW()
+WHERE user_id = $1 AND code = $2 AND used_at IS NULL;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (s *MFAStore) DeleteTOTP(ctx context.Context, userID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		query := `
+DELETE FROM user_recovery_codes WHERE user_id = $1;
+`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+		query = `
+DELETE FROM user_totp WHERE user_id = $1;
+`
+		_, err := tx.ExecContext(ctx, query, userID)
+		return err
+	})
+}
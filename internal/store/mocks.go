@@ -3,12 +3,25 @@ package store
 import (
 	"context"
 	"database/sql"
+	"slices"
+	"sync"
 	"time"
 )
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:         &MockUserStore{},
+		Sessions:      &MockSessionStore{},
+		MFA:           &MockMFAStore{},
+		Lockouts:      &MockLockoutStore{},
+		Roles:         &MockRoleStore{},
+		Posts:         &MockPostStore{},
+		Comments:      &MockCommentStore{},
+		Reactions:     &MockReactionStore{},
+		Blocks:        &MockBlockStore{},
+		Notifications: &MockNotificationStore{},
+		Mentions:      &MockMentionStore{},
+		Media:         &MockMediaStore{},
 	}
 }
 
@@ -30,6 +43,79 @@ func (m *MockUserStore) DeleteFollower(ctx context.Context, userID, followerID i
 	return nil
 }
 
+func (m *MockUserStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (m *MockUserStore) GetProfile(ctx context.Context, userID, viewerID int64) (*Profile, error) {
+	return &Profile{ID: userID, Username: "test", Email: "test@example.com"}, nil
+}
+
+func (m *MockUserStore) IsFollowing(ctx context.Context, userID, targetID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockUserStore) CreateFollowRequest(ctx context.Context, userID, targetID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) ListFollowRequests(
+	ctx context.Context,
+	userID int64,
+	q PaginatedFollowQuery,
+) ([]ListedUser, error) {
+	return []ListedUser{}, nil
+}
+
+func (m *MockUserStore) ApproveFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	return ErrorNotFound
+}
+
+func (m *MockUserStore) UpdateProfile(ctx context.Context, user *User) error {
+	return nil
+}
+
+func (m *MockUserStore) ChangePassword(ctx context.Context, user *User, keepSessionID string) error {
+	return nil
+}
+
+func (m *MockUserStore) CreateEmailChange(
+	ctx context.Context,
+	userID int64,
+	email, token string,
+	exp time.Duration,
+) error {
+	return nil
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (int64, error) {
+	return 1, nil
+}
+
+func (m *MockUserStore) SoftDelete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) Restore(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) PurgeDeleted(ctx context.Context, grace time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) ListFollowers(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]FollowUser, error) {
+	return []FollowUser{}, nil
+}
+
+func (m *MockUserStore) ListFollowing(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]FollowUser, error) {
+	return []FollowUser{}, nil
+}
+
 func (m *MockUserStore) CreateAndInvite(
 	ctx context.Context,
 	user *User,
@@ -44,9 +130,434 @@ func (m *MockUserStore) Activate(ctx context.Context, token string) error {
 }
 
 func (m *MockUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	return nil, nil
+	return nil, ErrorNotFound
 }
 
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) error {
 	return nil
 }
+
+func (m *MockUserStore) CreatePasswordReset(
+	ctx context.Context,
+	userID int64,
+	token string,
+	exp time.Duration,
+) error {
+	return nil
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return nil
+}
+
+func (m *MockUserStore) ReplaceInvitation(
+	ctx context.Context,
+	email, token string,
+	exp, cooldown time.Duration,
+) (*User, error) {
+	return &User{Email: email}, nil
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) DeleteUnactivated(ctx context.Context, age time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) List(ctx context.Context, q PaginatedUserQuery) ([]User, error) {
+	return []User{}, nil
+}
+
+func (m *MockUserStore) SetRole(ctx context.Context, userID, roleID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) Deactivate(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) Reactivate(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) ForcePasswordReset(
+	ctx context.Context,
+	userID int64,
+	token string,
+	exp time.Duration,
+) (*User, error) {
+	return &User{ID: userID}, nil
+}
+
+type MockSessionStore struct{}
+
+func (m *MockSessionStore) Create(
+	ctx context.Context,
+	userID int64,
+	refreshToken string,
+	exp time.Duration,
+) (*Session, error) {
+	return &Session{UserID: userID}, nil
+}
+
+func (m *MockSessionStore) Rotate(
+	ctx context.Context,
+	refreshToken, newRefreshToken string,
+	exp time.Duration,
+) (*Session, error) {
+	return &Session{}, nil
+}
+
+func (m *MockSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	return &Session{ID: id}, nil
+}
+
+func (m *MockSessionStore) Revoke(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *MockSessionStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockMFAStore struct{}
+
+func (m *MockMFAStore) CreateTOTP(ctx context.Context, userID int64, secret string) error {
+	return nil
+}
+
+func (m *MockMFAStore) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	return nil, ErrorNotFound
+}
+
+func (m *MockMFAStore) ConfirmTOTP(
+	ctx context.Context,
+	userID int64,
+	step int64,
+	recoveryCodes []string,
+) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	return nil
+}
+
+func (m *MockMFAStore) DeleteTOTP(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockLockoutStore struct{}
+
+func (m *MockLockoutStore) Create(ctx context.Context, lockout *Lockout) error {
+	return nil
+}
+
+func (m *MockLockoutStore) ListActive(ctx context.Context) ([]Lockout, error) {
+	return []Lockout{}, nil
+}
+
+func (m *MockLockoutStore) Unlock(ctx context.Context, id int64, adminID int64) (*Lockout, error) {
+	return &Lockout{ID: id, Kind: LockoutKindEmail}, nil
+}
+
+type MockRoleStore struct{}
+
+// mockRoles mirrors the roles and permissions seeded by the migrations.
+var mockRoles = []Role{
+	{RoleID: 1, RoleName: "user", Level: 1, Permissions: []string{}},
+	{
+		RoleID:      2,
+		RoleName:    "moderator",
+		Level:       2,
+		Permissions: []string{"comments:delete:any", "comments:update:any", "posts:update:any"},
+	},
+	{
+		RoleID:   3,
+		RoleName: "admin",
+		Level:    3,
+		Permissions: []string{
+			"comments:delete:any",
+			"comments:update:any",
+			"lockouts:manage",
+			"posts:delete:any",
+			"posts:update:any",
+			"roles:manage",
+			"users:manage",
+		},
+	},
+}
+
+func (m *MockRoleStore) GetIDByName(ctx context.Context, name string) (*Role, error) {
+	for _, role := range mockRoles {
+		if role.RoleName == name {
+			return &role, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MockRoleStore) List(ctx context.Context) ([]Role, error) {
+	return mockRoles, nil
+}
+
+func (m *MockRoleStore) ListPermissions(ctx context.Context) ([]Permission, error) {
+	return []Permission{}, nil
+}
+
+func (m *MockRoleStore) Create(ctx context.Context, role *Role) error {
+	return nil
+}
+
+func (m *MockRoleStore) Update(ctx context.Context, role *Role) error {
+	return nil
+}
+
+func (m *MockRoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return nil
+}
+
+func (m *MockRoleStore) Delete(ctx context.Context, roleID int64) error {
+	return nil
+}
+
+type MockPostStore struct{}
+
+func (m *MockPostStore) Create(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (m *MockPostStore) GetPostById(ctx context.Context, post *Post, id int64) error {
+	post.ID = id
+	post.UserID = 1
+	post.Reactions = ReactionCounts{}
+	post.Status = PostPublished
+	return nil
+}
+
+func (m *MockPostStore) Update(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (m *MockPostStore) GetUserFeed(
+	ctx context.Context,
+	id int64,
+	fq PaginatedFeedQuery,
+) ([]UserFeed, error) {
+	return []UserFeed{}, nil
+}
+
+func (m *MockPostStore) GetTimelineEntries(
+	ctx context.Context,
+	userID int64,
+	before Cursor,
+	limit, minFollowers int,
+) ([]TimelineEntry, error) {
+	return []TimelineEntry{}, nil
+}
+
+func (m *MockPostStore) GetUserPosts(
+	ctx context.Context,
+	viewerID, authorID int64,
+	fq PaginatedFeedQuery,
+) ([]UserFeed, error) {
+	return []UserFeed{}, nil
+}
+
+func (m *MockPostStore) GetTagPosts(ctx context.Context, viewerID int64, tag string, fq PaginatedFeedQuery) ([]UserFeed, error) {
+	return []UserFeed{}, nil
+}
+
+func (m *MockPostStore) TrendingTags(ctx context.Context, since time.Time, limit int) ([]TrendingTag, error) {
+	return []TrendingTag{}, nil
+}
+
+func (m *MockPostStore) GetDrafts(ctx context.Context, userID int64, dq PaginatedDraftQuery) ([]Post, error) {
+	return []Post{}, nil
+}
+
+func (m *MockPostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+	return []Post{}, nil
+}
+
+func (m *MockPostStore) GetFeedByIDs(ctx context.Context, userID int64, ids []int64) ([]UserFeed, error) {
+	return []UserFeed{}, nil
+}
+
+func (m *MockPostStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+type MockCommentStore struct{}
+
+func (m *MockCommentStore) Create(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (m *MockCommentStore) GetByPostID(
+	ctx context.Context,
+	postID, viewerID int64,
+	cq PaginatedCommentQuery,
+) ([]Comment, error) {
+	return []Comment{}, nil
+}
+
+func (m *MockCommentStore) GetThread(
+	ctx context.Context,
+	root *Comment,
+	viewerID int64,
+	cq PaginatedCommentQuery,
+) ([]Comment, error) {
+	return []Comment{*root}, nil
+}
+
+func (m *MockCommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	return nil, ErrorNotFound
+}
+
+func (m *MockCommentStore) Update(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (m *MockCommentStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+type MockReactionStore struct{}
+
+func (m *MockReactionStore) Set(
+	ctx context.Context,
+	postID, userID int64,
+	kind string,
+) (ReactionCounts, bool, error) {
+	return ReactionCounts{kind: 1}, true, nil
+}
+
+func (m *MockReactionStore) Delete(ctx context.Context, postID, userID int64) (ReactionCounts, error) {
+	return nil, ErrorNotFound
+}
+
+func (m *MockReactionStore) Get(ctx context.Context, postID, userID int64) (string, error) {
+	return "", ErrorNotFound
+}
+
+type MockBlockStore struct{}
+
+func (m *MockBlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	return nil
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	return ErrorNotFound
+}
+
+func (m *MockBlockStore) Mute(ctx context.Context, userID, mutedID int64) error {
+	return nil
+}
+
+func (m *MockBlockStore) Unmute(ctx context.Context, userID, mutedID int64) error {
+	return ErrorNotFound
+}
+
+func (m *MockBlockStore) IsBlocked(ctx context.Context, userID, otherID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockBlockStore) ListBlocked(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error) {
+	return []ListedUser{}, nil
+}
+
+func (m *MockBlockStore) ListMuted(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error) {
+	return []ListedUser{}, nil
+}
+
+type MockNotificationStore struct{}
+
+func (m *MockNotificationStore) Create(ctx context.Context, n *Notification) (bool, error) {
+	return n.UserID != n.ActorID, nil
+}
+
+func (m *MockNotificationStore) List(
+	ctx context.Context,
+	userID int64,
+	q PaginatedNotificationQuery,
+) ([]Notification, error) {
+	return []Notification{}, nil
+}
+
+func (m *MockNotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	return ErrorNotFound
+}
+
+func (m *MockNotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockNotificationStore) UnreadCount(ctx context.Context, userID int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockNotificationStore) GetPreferences(ctx context.Context, userID int64) (NotificationPreferences, error) {
+	prefs := NotificationPreferences{}
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+	return prefs, nil
+}
+
+func (m *MockNotificationStore) SetPreferences(
+	ctx context.Context,
+	userID int64,
+	prefs NotificationPreferences,
+) error {
+	for t := range prefs {
+		if !slices.Contains(NotificationTypes, t) {
+			return ErrUnknownNotificationType
+		}
+	}
+	return nil
+}
+
+type MockMentionStore struct{}
+
+func (m *MockMentionStore) SetPostMentions(ctx context.Context, postID int64, usernames []string) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (m *MockMentionStore) SetCommentMentions(ctx context.Context, commentID int64, usernames []string) ([]int64, error) {
+	return []int64{}, nil
+}
+
+// MockMediaStore keeps created media in memory, so uploads can be read back.
+type MockMediaStore struct {
+	mu    sync.Mutex
+	media []Media
+}
+
+func (m *MockMediaStore) Create(ctx context.Context, media *Media) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	media.ID = int64(len(m.media) + 1)
+	m.media = append(m.media, *media)
+	return nil
+}
+
+func (m *MockMediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.media)) {
+		return nil, ErrorNotFound
+	}
+	media := m.media[id-1]
+	return &media, nil
+}
+
+func (m *MockMediaStore) DeleteUnattached(ctx context.Context, age time.Duration, limit int) ([]Media, error) {
+	return []Media{}, nil
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+)
+
+// Notification types, users can turn each of them off.
+const (
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "follow_request"
+	NotificationComment       = "comment"
+	NotificationReply         = "reply"
+	NotificationReaction      = "reaction"
+	NotificationMention       = "mention"
+)
+
+var NotificationTypes = []string{
+	NotificationFollow,
+	NotificationFollowRequest,
+	NotificationComment,
+	NotificationReply,
+	NotificationReaction,
+	NotificationMention,
+}
+
+// Notification tells the user that Actor did something. PostID and CommentID
+// point at what it was about when there is something.
+type Notification struct {
+	ID        int64             `json:"id"`
+	UserID    int64             `json:"user_id"`
+	Type      string            `json:"type"`
+	ActorID   int64             `json:"actor_id"`
+	Actor     NotificationActor `json:"actor"`
+	PostID    *int64            `json:"post_id"`
+	CommentID *int64            `json:"comment_id"`
+	Read      bool              `json:"read"`
+	CreatedAt string            `json:"created_at"`
+}
+
+// NotificationActor is the user that did what a notification is about.
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// NotificationPreferences tells for every notification type whether the user
+// wants it.
+type NotificationPreferences map[string]bool
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// Create stores the notification unless the user turned its type off, acted
+// themselves or blocks the actor. It returns whether it was stored, stored
+// notifications get the username of the actor.
+func (s *NotificationStore) Create(ctx context.Context, n *Notification) (bool, error) {
+	query := `
+INSERT INTO notifications(user_id, actor_id, type, post_id, comment_id)
+SELECT $1, $2, $3, $4, $5
+WHERE $1 <> $2
+  AND NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE user_id = $1 AND type = $3 AND NOT enabled
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+  )
+RETURNING id, created_at, (SELECT username FROM users WHERE id = $2)
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		n.UserID,
+		n.ActorID,
+		n.Type,
+		n.PostID,
+		n.CommentID,
+	).Scan(&n.ID, &n.CreatedAt, &n.Actor.Username)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	n.Actor.ID = n.ActorID
+	return true, nil
+}
+
+// List returns a page of the notifications of the user, the newest first.
+func (s *NotificationStore) List(
+	ctx context.Context,
+	userID int64,
+	q PaginatedNotificationQuery,
+) ([]Notification, error) {
+	after := Cursor{CreatedAt: "epoch"}
+	if q.Cursor != "" {
+		var err error
+		if after, err = DecodeCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	query := `
+SELECT n.id, n.user_id, n.type, n.actor_id, u.username, n.post_id, n.comment_id,
+  n.read_at IS NOT NULL, n.created_at
+FROM notifications n
+JOIN users u ON u.id = n.actor_id
+WHERE n.user_id = $1
+  AND (NOT $2 OR n.read_at IS NULL)
+  AND ($3 = 0 OR (n.created_at, n.id) < ($4::timestamptz, $3))
+ORDER BY n.created_at DESC, n.id DESC
+LIMIT $5
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, q.Unread, after.ID, after.CreatedAt, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Type,
+			&n.ActorID,
+			&n.Actor.Username,
+			&n.PostID,
+			&n.CommentID,
+			&n.Read,
+			&n.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		n.Actor.ID = n.ActorID
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkRead marks a notification of the user as read.
+func (s *NotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	query := `
+UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every notification of the user as read and returns how
+// many were unread.
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `
+UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *NotificationStore) UnreadCount(ctx context.Context, userID int64) (int64, error) {
+	query := `
+SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// GetPreferences returns the preferences of the user for every type.
+func (s *NotificationStore) GetPreferences(ctx context.Context, userID int64) (NotificationPreferences, error) {
+	query := `
+SELECT type, enabled FROM notification_preferences WHERE user_id = $1
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	prefs := NotificationPreferences{}
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+	for rows.Next() {
+		var (
+			t       string
+			enabled bool
+		)
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		if _, ok := prefs[t]; ok {
+			prefs[t] = enabled
+		}
+	}
+	return prefs, rows.Err()
+}
+
+// SetPreferences turns the given types on or off, the others are left alone.
+func (s *NotificationStore) SetPreferences(ctx context.Context, userID int64, prefs NotificationPreferences) error {
+	for t := range prefs {
+		if !slices.Contains(NotificationTypes, t) {
+			return ErrUnknownNotificationType
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+INSERT INTO notification_preferences(user_id, type, enabled) VALUES($1, $2, $3)
+ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled
+`
+		for t, enabled := range prefs {
+			if _, err := tx.ExecContext(ctx, query, userID, t, enabled); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNotifications(t *testing.T) {
+	db := newTestDB(t)
+	notifications := &NotificationStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	post := insertPost(t, db, alice, testPost{})
+
+	notify := func(t *testing.T, n Notification) bool {
+		t.Helper()
+		created, err := notifications.Create(ctx, &n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	unread := func(t *testing.T) int64 {
+		t.Helper()
+		count, err := notifications.UnreadCount(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	t.Run("should store and page notifications", func(t *testing.T) {
+		if !notify(t, Notification{UserID: alice, ActorID: bob, Type: NotificationFollow}) ||
+			!notify(t, Notification{UserID: alice, ActorID: bob, Type: NotificationReaction, PostID: &post}) {
+			t.Fatal("notification was not stored")
+		}
+		if notify(t, Notification{UserID: alice, ActorID: alice, Type: NotificationReaction, PostID: &post}) {
+			t.Error("stored a notification about the user themselves")
+		}
+		first, err := notifications.List(ctx, alice, PaginatedNotificationQuery{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor := Cursor{CreatedAt: first[0].CreatedAt, ID: first[0].ID}.Encode()
+		second, err := notifications.List(ctx, alice, PaginatedNotificationQuery{Limit: 1, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(second) != 1 || first[0].Type != NotificationReaction || second[0].Type != NotificationFollow {
+			t.Errorf("got %+v then %+v", first, second)
+		}
+		if first[0].Actor.Username != "bob" || *first[0].PostID != post {
+			t.Errorf("got %+v", first[0])
+		}
+	})
+	t.Run("should mark notifications read", func(t *testing.T) {
+		if got := unread(t); got != 2 {
+			t.Fatalf("got %d unread, wanted 2", got)
+		}
+		list, err := notifications.List(ctx, alice, PaginatedNotificationQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := notifications.MarkRead(ctx, bob, list[0].ID); err == nil {
+			t.Error("marked the notification of another user")
+		}
+		if err := notifications.MarkRead(ctx, alice, list[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := unread(t); got != 1 {
+			t.Errorf("got %d unread, wanted 1", got)
+		}
+		left, err := notifications.List(ctx, alice, PaginatedNotificationQuery{Limit: 10, Unread: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != 1 || left[0].ID != list[1].ID {
+			t.Errorf("got unread %+v", left)
+		}
+		if _, err := notifications.MarkAllRead(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+		if got := unread(t); got != 0 {
+			t.Errorf("got %d unread, wanted 0", got)
+		}
+	})
+	t.Run("should follow preferences", func(t *testing.T) {
+		if err := notifications.SetPreferences(ctx, alice, NotificationPreferences{NotificationReaction: false}); err != nil {
+			t.Fatal(err)
+		}
+		prefs, err := notifications.GetPreferences(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefs[NotificationReaction] || !prefs[NotificationFollow] || len(prefs) != len(NotificationTypes) {
+			t.Errorf("got %v", prefs)
+		}
+		if notify(t, Notification{UserID: alice, ActorID: bob, Type: NotificationReaction, PostID: &post}) {
+			t.Error("stored a notification of a type that is off")
+		}
+		if !notify(t, Notification{UserID: alice, ActorID: bob, Type: NotificationFollow}) {
+			t.Error("did not store a notification of a type that is on")
+		}
+		if err := notifications.SetPreferences(ctx, alice, NotificationPreferences{"poke": true}); err != ErrUnknownNotificationType {
+			t.Errorf("got %v, wanted %v", err, ErrUnknownNotificationType)
+		}
+	})
+}
@@ -1,18 +1,27 @@
 package store
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/rijojohn85/social/internal/content"
 )
 
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
+	Limit  int `json:"limit" validate:"gte=1,lte=20"`
+	Offset int `json:"offset" validate:"gte=0"`
+	// Cursor replaces Offset when it is set
+	Cursor string   `json:"cursor"`
 	Sort   string   `json:"sort" validate:"oneof=asc desc"`
 	Search string   `json:"search" validate:"max=100"`
 	Tags   []string `json:"tags" validate:"max=5"`
-	//TODO: since and until
+	// Since and Until limit the feed to posts created in [Since, Until)
+	Since *time.Time `json:"since"`
+	Until *time.Time `json:"until"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -35,7 +44,11 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Offset = l
 	}
 	sort := qs.Get("sort")
-	fq.Sort = sort
+	if sort != "" {
+		fq.Sort = sort
+	}
+
+	fq.Cursor = qs.Get("cursor")
 
 	search := qs.Get("search")
 	if search != "" {
@@ -44,8 +57,231 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	tags := qs.Get("tags")
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		// tags are stored normalized, see content.NormalizeTag
+		fq.Tags = content.MergeTags(strings.Split(tags, ","))
+	}
+
+	since := qs.Get("since")
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return fq, err
+		}
+		fq.Since = &t
+	}
+	until := qs.Get("until")
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fq, err
+		}
+		fq.Until = &t
+	}
+	if fq.Since != nil && fq.Until != nil && !fq.Since.Before(*fq.Until) {
+		return fq, ErrInvalidTimeWindow
 	}
 
 	return fq, nil
 }
+
+type PaginatedUserQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Search string `json:"search" validate:"max=100"`
+	RoleID int64  `json:"role_id" validate:"gte=0"`
+	Status string `json:"status" validate:"omitempty,oneof=active pending deactivated"`
+}
+
+func (uq PaginatedUserQuery) Parse(r *http.Request) (PaginatedUserQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return uq, err
+		}
+		uq.Limit = l
+	}
+	offset := qs.Get("offset")
+	if offset != "" {
+		l, err := strconv.Atoi(offset)
+		if err != nil {
+			return uq, err
+		}
+		uq.Offset = l
+	}
+	roleID := qs.Get("role_id")
+	if roleID != "" {
+		id, err := strconv.ParseInt(roleID, 10, 64)
+		if err != nil {
+			return uq, err
+		}
+		uq.RoleID = id
+	}
+	uq.Search = qs.Get("search")
+	uq.Status = qs.Get("status")
+
+	return uq, nil
+}
+
+type PaginatedDraftQuery struct {
+	Limit  int `json:"limit" validate:"gte=1,lte=100"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (dq PaginatedDraftQuery) Parse(r *http.Request) (PaginatedDraftQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return dq, err
+		}
+		dq.Limit = l
+	}
+	offset := qs.Get("offset")
+	if offset != "" {
+		l, err := strconv.Atoi(offset)
+		if err != nil {
+			return dq, err
+		}
+		dq.Offset = l
+	}
+
+	return dq, nil
+}
+
+// Cursor points at the last row of a page for keyset pagination over
+// (created_at, id). Clients get it as an opaque string.
+type Cursor struct {
+	CreatedAt string `json:"c"`
+	ID        int64  `json:"i"`
+	// Prev pages towards the start of the list instead of away from it
+	Prev bool `json:"p,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	return encodeCursor(c)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	if err := decodeCursor(s, &c); err != nil {
+		return c, err
+	}
+	if _, err := time.Parse(time.RFC3339, c.CreatedAt); err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ThreadCursor points at the last comment of a page in thread order.
+type ThreadCursor struct {
+	Path []int64 `json:"p"`
+}
+
+func (c ThreadCursor) Encode() string {
+	return encodeCursor(c)
+}
+
+func DecodeThreadCursor(s string) (ThreadCursor, error) {
+	var c ThreadCursor
+	if err := decodeCursor(s, &c); err != nil {
+		return c, err
+	}
+	if len(c.Path) == 0 || len(c.Path) > MaxCommentDepth+1 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func encodeCursor(v any) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+type PaginatedCommentQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor string `json:"cursor"`
+}
+
+func (cq PaginatedCommentQuery) Parse(r *http.Request) (PaginatedCommentQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq, err
+		}
+		cq.Limit = l
+	}
+	cq.Cursor = qs.Get("cursor")
+
+	return cq, nil
+}
+
+type PaginatedFollowQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor string `json:"cursor"`
+}
+
+func (q PaginatedFollowQuery) Parse(r *http.Request) (PaginatedFollowQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+	q.Cursor = qs.Get("cursor")
+
+	return q, nil
+}
+
+type PaginatedNotificationQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Cursor string `json:"cursor"`
+	// only notifications that were not read yet
+	Unread bool `json:"unread"`
+}
+
+func (q PaginatedNotificationQuery) Parse(r *http.Request) (PaginatedNotificationQuery, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+	q.Cursor = qs.Get("cursor")
+	unread := qs.Get("unread")
+	if unread != "" {
+		u, err := strconv.ParseBool(unread)
+		if err != nil {
+			return q, err
+		}
+		q.Unread = u
+	}
+
+	return q, nil
+}
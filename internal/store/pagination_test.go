@@ -0,0 +1,82 @@
+package store
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("should round trip", func(t *testing.T) {
+		want := Cursor{CreatedAt: "2024-05-01T10:00:00Z", ID: 42, Prev: true}
+		got, err := DecodeCursor(want.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %+v, wanted %+v", got, want)
+		}
+	})
+	t.Run("should reject malformed cursors", func(t *testing.T) {
+		for _, s := range []string{
+			"not base64!",
+			"bm90IGpzb24",
+			Cursor{CreatedAt: "yesterday", ID: 1}.Encode(),
+			Cursor{CreatedAt: "2024-05-01T10:00:00Z"}.Encode(),
+		} {
+			if _, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("%q: got %v, wanted ErrInvalidCursor", s, err)
+			}
+		}
+	})
+}
+
+func TestThreadCursor(t *testing.T) {
+	want := ThreadCursor{Path: []int64{3, 9, 12}}
+	got, err := DecodeThreadCursor(want.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Path, want.Path) {
+		t.Errorf("got %v, wanted %v", got.Path, want.Path)
+	}
+	if _, err := DecodeThreadCursor(ThreadCursor{}.Encode()); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got %v, wanted ErrInvalidCursor for an empty path", err)
+	}
+}
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	parse := func(query string) (PaginatedFeedQuery, error) {
+		r := httptest.NewRequest(http.MethodGet, "/v1/users/feed?"+query, nil)
+		return PaginatedFeedQuery{}.Parse(r)
+	}
+	t.Run("should parse tags and the time window", func(t *testing.T) {
+		fq, err := parse("tags=go,%20rust,,&since=2024-05-01T00:00:00Z&until=2024-05-02T00:00:00%2B02:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(fq.Tags, []string{"go", "rust"}) {
+			t.Errorf("got tags %v", fq.Tags)
+		}
+		if fq.Since == nil || !fq.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("got since %v", fq.Since)
+		}
+		if fq.Until == nil || !fq.Until.Equal(time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)) {
+			t.Errorf("got until %v", fq.Until)
+		}
+	})
+	t.Run("should reject malformed times", func(t *testing.T) {
+		if _, err := parse("since=yesterday"); err == nil {
+			t.Error("wanted an error")
+		}
+	})
+	t.Run("should reject an empty window", func(t *testing.T) {
+		_, err := parse("since=2024-05-02T00:00:00Z&until=2024-05-01T00:00:00Z")
+		if !errors.Is(err, ErrInvalidTimeWindow) {
+			t.Errorf("got %v, wanted ErrInvalidTimeWindow", err)
+		}
+	})
+}
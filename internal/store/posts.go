@@ -4,20 +4,40 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"time"
+
 	"github.com/lib/pq"
 )
 
+// Post statuses. Drafts are seen only by their author, scheduled posts are
+// published by PublishDue once PublishAt has passed.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+)
+
 type Post struct {
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	CreateAt  string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Tags      []string  `json:"tags"`
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	Content   string         `json:"content"`
+	Title     string         `json:"title"`
+	CreateAt  string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
+	Tags      []string       `json:"tags"`
+	ID        int64          `json:"id"`
+	UserID    int64          `json:"user_id"`
+	Version   int            `json:"version"`
+	Comments  []Comment      `json:"comments"`
+	User      User           `json:"user"`
+	Reactions ReactionCounts `json:"reactions"`
+	// uploaded media attached to the post, see Media
+	MediaIDs []int64 `json:"media_ids"`
+	Status   string  `json:"status"`
+	// when a scheduled post goes out or a published post went out, nil for
+	// drafts
+	PublishAt *string `json:"publish_at"`
+	// the kind of reaction the requesting user left, nil when they didn't react
+	ViewerReaction *string `json:"viewer_reaction"`
 }
 
 type UserFeed struct {
@@ -29,38 +49,211 @@ type PostStore struct {
 	db *sql.DB
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]UserFeed, error) {
-	query := `
-		SELECT 
-			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
-			u.username,
-			COUNT(c.id) AS comments_count
+// feedColumns are the columns of a feed post as read by scanFeedPosts, $1 is
+// the user reading the feed.
+const feedColumns = `
+	p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+	u.username, p.reaction_counts, p.status, p.publish_at,
+	(SELECT r.kind FROM post_reactions r WHERE r.post_id = p.id AND r.user_id = $1),
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL),
+	` + postMediaIDs + `
+`
+
+// postMediaIDs selects the ids of the media attached to post p.
+const postMediaIDs = `
+	ARRAY(SELECT m.id FROM media m WHERE m.post_id = p.id ORDER BY m.id)
+`
+
+// published leaves out drafts and scheduled posts, no feed or listing shows
+// them.
+const published = `p.status = 'published'`
+
+// homeTimelineAuthors picks the posts of the home timeline of user $1: their
+// own posts and the posts of everyone they follow and did not mute. Following
+// is a subquery so each post shows up once.
+const homeTimelineAuthors = `
+	(
+		p.user_id = $1
+		OR p.user_id IN (SELECT f.follower_id FROM followers f WHERE f.user_id = $1)
+	)
+	AND NOT EXISTS (SELECT 1 FROM mutes m WHERE m.user_id = $1 AND m.muted_id = p.user_id)
+`
+
+// visibleTo leaves out the posts of private accounts that user $1 doesn't
+// follow.
+const visibleTo = `
+	(
+		NOT u.is_private
+		OR p.user_id = $1
+		OR EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = $1 AND vf.follower_id = p.user_id)
+	)
+`
+
+// notBlocked leaves out the posts of authors that user $1 blocked or was
+// blocked by.
+const notBlocked = `
+	NOT EXISTS (
+		SELECT 1 FROM blocks b
+		WHERE (b.user_id = $1 AND b.blocked_id = p.user_id)
+			OR (b.user_id = p.user_id AND b.blocked_id = $1)
+	)
+`
+
+// feedQuery selects a page of the feed posts picked by the authors condition
+// for user $1. Comments are counted in a subquery so nothing joined to the
+// post can multiply the count. $2 and $3 are limit and offset, $4 and $5 the
+// id and created_at of the keyset cursor (id 0 for none), $6 to $9 the search,
+// tags, since and until filters. Arguments from $10 on are for authors.
+func feedQuery(authors string, desc bool) string {
+	order, op := "ASC", ">"
+	if desc {
+		order, op = "DESC", "<"
+	}
+	return `
+		SELECT ` + feedColumns + `
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-			f.user_id = $1
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			(` + authors + `)
+			AND ` + published + `
+			AND u.deleted_at IS NULL
+			AND ` + visibleTo + `
+			AND ` + notBlocked + `
+			AND ($4 = 0 OR (p.created_at, p.id) ` + op + ` ($5::timestamptz, $4))
+			AND ($6 = '' OR p.title ILIKE '%' || $6 || '%' OR p.content ILIKE '%' || $6 || '%')
+			AND (cardinality($7::varchar[]) = 0 OR p.tags && $7::varchar[])
+			AND ($8::timestamptz IS NULL OR p.created_at >= $8)
+			AND ($9::timestamptz IS NULL OR p.created_at < $9)
+		ORDER BY p.created_at ` + order + `, p.id ` + order + `
 		LIMIT $2 OFFSET $3
 	`
+}
+
+// GetUserFeed returns a page of the home timeline of the user. With a cursor the page
+// continues after, or with a previous page cursor before, the post it points
+// at, otherwise it starts at fq.Offset. Posts are filtered on fq.Search in the
+// title or content, on sharing a tag with fq.Tags and on the fq.Since/fq.Until
+// window when those are set.
+func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]UserFeed, error) {
+	return s.getFeed(ctx, id, homeTimelineAuthors, fq)
+}
+
+// GetUserPosts returns a page of the posts of the author as user viewerID
+// sees them, paged and filtered like GetUserFeed.
+func (s *PostStore) GetUserPosts(
+	ctx context.Context,
+	viewerID, authorID int64,
+	fq PaginatedFeedQuery,
+) ([]UserFeed, error) {
+	return s.getFeed(ctx, viewerID, `p.user_id = $10`, fq, authorID)
+}
+
+func (s *PostStore) getFeed(
+	ctx context.Context,
+	viewerID int64,
+	authors string,
+	fq PaginatedFeedQuery,
+	authorArgs ...any,
+) ([]UserFeed, error) {
+	after := Cursor{CreatedAt: "epoch"}
+	offset := fq.Offset
+	if fq.Cursor != "" {
+		var err error
+		after, err = DecodeCursor(fq.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		offset = 0
+	}
+	tags := fq.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	// a previous page is read backwards from the cursor and flipped afterwards
+	desc := (fq.Sort == "desc") != after.Prev
+	query := feedQuery(authors, desc)
+	args := append([]any{
+		viewerID,
+		fq.Limit,
+		offset,
+		after.ID,
+		after.CreatedAt,
+		escapeLike(fq.Search),
+		pq.Array(tags),
+		fq.Since,
+		fq.Until,
+	}, authorArgs...)
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	rows, err := s.db.QueryContext(
-		ctx,
-		query,
-		id,
-		fq.Limit,
-		fq.Offset,
-		//fq.Search,
-		//pq.Array(fq.Tags),
-	)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var feed []UserFeed
+	feed, err := scanFeedPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if after.Prev {
+		slices.Reverse(feed)
+	}
+	return feed, nil
+}
+
+// GetTagPosts returns a page of the posts tagged with tag as user viewerID
+// sees them, paged and filtered like GetUserFeed.
+func (s *PostStore) GetTagPosts(
+	ctx context.Context,
+	viewerID int64,
+	tag string,
+	fq PaginatedFeedQuery,
+) ([]UserFeed, error) {
+	return s.getFeed(ctx, viewerID, `p.tags @> ARRAY[$10]::varchar[]`, fq, tag)
+}
+
+// TrendingTag is a tag with the number of recent posts carrying it.
+type TrendingTag struct {
+	Tag   string `json:"tag"`
+	Posts int64  `json:"posts"`
+}
+
+// TrendingTags returns the tags used by the most public posts created since
+// the given time, the most used first.
+func (s *PostStore) TrendingTags(ctx context.Context, since time.Time, limit int) ([]TrendingTag, error) {
+	query := `
+SELECT t.tag, COUNT(*) AS posts
+FROM posts p
+JOIN users u ON u.id = p.user_id
+CROSS JOIN LATERAL unnest(p.tags) AS t(tag)
+WHERE p.created_at >= $1
+  AND ` + published + `
+  AND NOT u.is_private
+  AND u.deactivated_at IS NULL
+  AND u.deleted_at IS NULL
+GROUP BY t.tag
+ORDER BY posts DESC, t.tag
+LIMIT $2
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var tag TrendingTag
+		if err := rows.Scan(&tag.Tag, &tag.Posts); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func scanFeedPosts(rows *sql.Rows) ([]UserFeed, error) {
+	feed := []UserFeed{}
 	for rows.Next() {
 		var post UserFeed
 		if err := rows.Scan(
@@ -72,70 +265,261 @@ func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQ
 			&post.Version,
 			pq.Array(&post.Tags),
 			&post.User.Username,
+			&post.Reactions,
+			&post.Status,
+			&post.PublishAt,
+			&post.ViewerReaction,
 			&post.CommentCount,
+			pq.Array(&post.MediaIDs),
 		); err != nil {
 			return nil, err
 		}
 		feed = append(feed, post)
 	}
-	return feed, nil
+	return feed, rows.Err()
+}
+
+// TimelineEntry is a post in a cached home timeline.
+type TimelineEntry struct {
+	PostID    int64
+	CreatedAt time.Time
+}
+
+// GetTimelineEntries returns the newest posts of the home timeline of the user
+// that come before the cursor, newest first. With minFollowers above 0 only the
+// posts of followed authors with more followers than that are returned, those
+// are not pushed into cached timelines.
+func (s *PostStore) GetTimelineEntries(
+	ctx context.Context,
+	userID int64,
+	before Cursor,
+	limit, minFollowers int,
+) ([]TimelineEntry, error) {
+	if before.ID == 0 {
+		before.CreatedAt = "epoch"
+	}
+	query := `
+		SELECT p.id, p.created_at
+		FROM posts p
+		WHERE
+			(
+				($4 = 0 AND p.user_id = $1)
+				OR p.user_id IN (
+					SELECT f.follower_id
+					FROM followers f
+					JOIN users a ON a.id = f.follower_id
+					WHERE f.user_id = $1 AND ($4 = 0 OR a.followers_count > $4)
+				)
+			)
+			AND NOT EXISTS (SELECT 1 FROM mutes m WHERE m.user_id = $1 AND m.muted_id = p.user_id)
+			AND ` + notBlocked + `
+			AND ` + published + `
+			AND ($2 = 0 OR (p.created_at, p.id) < ($3::timestamptz, $2))
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, before.ID, before.CreatedAt, minFollowers, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var entry TimelineEntry
+		if err := rows.Scan(&entry.PostID, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetFeedByIDs returns the posts with the given ids as they show up in the
+// feed of the user, newest first. Posts that don't exist anymore or that the
+// user can't see are left out.
+func (s *PostStore) GetFeedByIDs(ctx context.Context, userID int64, ids []int64) ([]UserFeed, error) {
+	query := `
+		SELECT ` + feedColumns + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.id = ANY($2::bigint[])
+			AND ` + published + `
+			AND u.deleted_at IS NULL
+			AND ` + visibleTo + `
+			AND ` + notBlocked + `
+		ORDER BY p.created_at DESC, p.id DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanFeedPosts(rows)
 }
 
 func (s *PostStore) Create(
 	ctx context.Context,
 	post *Post,
 ) error {
+	// posts without a status are published, published posts go out now, the
+	// others keep the time they are scheduled for, if any
 	query := `
-  INSERT INTO posts(content, title, user_id, tags)
-  VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+  INSERT INTO posts(content, title, user_id, tags, status, publish_at)
+  VALUES (
+    $1, $2, $3, $4,
+    COALESCE(NULLIF($5, ''), 'published'),
+    CASE WHEN COALESCE(NULLIF($5, ''), 'published') = 'published' THEN NOW() ELSE $6::timestamptz END
+  )
+  RETURNING id, created_at, updated_at, reaction_counts, status, publish_at
   `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreateAt,
-		&post.UpdatedAt,
-	)
-	if err != nil {
-		return err
-	}
-	return nil
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+		).Scan(
+			&post.ID,
+			&post.CreateAt,
+			&post.UpdatedAt,
+			&post.Reactions,
+			&post.Status,
+			&post.PublishAt,
+		)
+		if err != nil {
+			return err
+		}
+		return setPostMedia(ctx, tx, post.UserID, post.ID, post.MediaIDs)
+	})
 }
 
+// Update saves the post. A draft or scheduled post that becomes published
+// goes out now, it moves to the top of the feeds like a new post.
 func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	query := `
 UPDATE posts
-SET content = $1, title = $2, updated_at = NOW(), tags = $3, version=version + 1
+SET content = $1, title = $2, updated_at = NOW(), tags = $3, version=version + 1,
+  status = $6,
+  publish_at = CASE
+    WHEN $6 <> 'published' THEN $7::timestamptz
+    WHEN status <> 'published' THEN NOW()
+    ELSE publish_at
+  END,
+  created_at = CASE WHEN $6 = 'published' AND status <> 'published' THEN NOW() ELSE created_at END
 WHERE id = $4 and version=$5
-RETURNING version
+RETURNING version, created_at, publish_at
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Content,
-		post.Title,
-		pq.Array(post.Tags),
-		post.ID,
-		post.Version,
-	).Scan(&post.Version)
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Content,
+			post.Title,
+			pq.Array(post.Tags),
+			post.ID,
+			post.Version,
+			post.Status,
+			post.PublishAt,
+		).Scan(&post.Version, &post.CreateAt, &post.PublishAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		return setPostMedia(ctx, tx, post.UserID, post.ID, post.MediaIDs)
+	})
+}
+
+// GetDrafts returns a page of the drafts and scheduled posts of the user, the
+// scheduled ones first in the order they go out, then the drafts last edited
+// first.
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64, dq PaginatedDraftQuery) ([]Post, error) {
+	query := `
+SELECT id, user_id, title, content, created_at, updated_at, tags, version, reaction_counts,
+  status, publish_at,
+  ` + postMediaIDs + `
+FROM posts p
+WHERE user_id = $1 AND NOT ` + published + `
+ORDER BY status DESC, publish_at, updated_at DESC, id DESC
+LIMIT $2 OFFSET $3
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, dq.Limit, dq.Offset)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrorNotFound
-		default:
-			return err
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+// PublishDue publishes up to limit scheduled posts whose time has come and
+// returns them. Posts another replica is publishing are skipped, so the
+// scheduler can run on every replica.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+	query := `
+UPDATE posts p
+SET status = 'published', created_at = NOW(), updated_at = NOW(), version = version + 1
+WHERE id IN (
+  SELECT id FROM posts
+  WHERE status = 'scheduled' AND publish_at <= NOW()
+  ORDER BY publish_at
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+) AND status = 'scheduled'
+RETURNING id, user_id, title, content, created_at, updated_at, tags, version, reaction_counts,
+  status, publish_at,
+  ` + postMediaIDs + `
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+// scanPosts reads the columns GetPostById selects.
+func scanPosts(rows *sql.Rows) ([]Post, error) {
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.CreateAt,
+			&post.UpdatedAt,
+			pq.Array(&post.Tags),
+			&post.Version,
+			&post.Reactions,
+			&post.Status,
+			&post.PublishAt,
+			pq.Array(&post.MediaIDs),
+		); err != nil {
+			return nil, err
 		}
+		posts = append(posts, post)
 	}
-	return nil
+	return posts, rows.Err()
 }
 
 func (s *PostStore) Delete(ctx context.Context, id int64) error {
@@ -167,8 +551,10 @@ WHERE id = $1;
 
 func (s *PostStore) GetPostById(ctx context.Context, post *Post, id int64) error {
 	query := `
-  SELECT id, user_id, title, content, created_at, updated_at, tags, version
-  FROM posts
+  SELECT id, user_id, title, content, created_at, updated_at, tags, version, reaction_counts,
+    status, publish_at,
+    ` + postMediaIDs + `
+  FROM posts p
   where id = $1
   `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
@@ -186,6 +572,10 @@ func (s *PostStore) GetPostById(ctx context.Context, post *Post, id int64) error
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
 		&post.Version,
+		&post.Reactions,
+		&post.Status,
+		&post.PublishAt,
+		pq.Array(&post.MediaIDs),
 	)
 	if err != nil {
 		switch {
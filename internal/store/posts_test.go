@@ -0,0 +1,511 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func feedIDs(t *testing.T, posts *PostStore, userID int64, fq PaginatedFeedQuery) []int64 {
+	t.Helper()
+	if fq.Limit == 0 {
+		fq.Limit = 20
+	}
+	if fq.Sort == "" {
+		fq.Sort = "desc"
+	}
+	feed, err := posts.GetUserFeed(context.Background(), userID, fq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feedIDsOf(feed)
+}
+
+func feedIDsOf(feed []UserFeed) []int64 {
+	ids := make([]int64, len(feed))
+	for i, post := range feed {
+		ids[i] = post.ID
+	}
+	return ids
+}
+
+func TestGetUserFeedFilters(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+
+	viewer := insertUser(t, db, "viewer")
+	alice := insertUser(t, db, "alice")
+	follow(t, db, viewer, alice)
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	gophers := insertPost(t, db, alice, testPost{
+		title:     "Gophers everywhere",
+		content:   "a post about go",
+		tags:      []string{"go", "animals"},
+		createdAt: day,
+	})
+	rust := insertPost(t, db, alice, testPost{
+		title:     "Crabs",
+		content:   "rust has a mascot too, not a gopher",
+		tags:      []string{"rust"},
+		createdAt: day.Add(24 * time.Hour),
+	})
+	cooking := insertPost(t, db, alice, testPost{
+		title:     "Dinner",
+		content:   "pasta",
+		tags:      []string{"food"},
+		createdAt: day.Add(48 * time.Hour),
+	})
+
+	at := func(d time.Duration) *time.Time {
+		t := day.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name string
+		fq   PaginatedFeedQuery
+		want []int64
+	}{
+		{"no filters", PaginatedFeedQuery{}, []int64{cooking, rust, gophers}},
+		{"search matches title or content", PaginatedFeedQuery{Search: "GOPHER"}, []int64{rust, gophers}},
+		{"search without match", PaginatedFeedQuery{Search: "haskell"}, []int64{}},
+		{"tags overlap", PaginatedFeedQuery{Tags: []string{"rust", "food"}}, []int64{cooking, rust}},
+		{"empty tags", PaginatedFeedQuery{Tags: []string{}}, []int64{cooking, rust, gophers}},
+		{"since is inclusive", PaginatedFeedQuery{Since: at(24 * time.Hour)}, []int64{cooking, rust}},
+		{"until is exclusive", PaginatedFeedQuery{Until: at(24 * time.Hour)}, []int64{gophers}},
+		{
+			"window",
+			PaginatedFeedQuery{Since: at(time.Hour), Until: at(47 * time.Hour)},
+			[]int64{rust},
+		},
+		{
+			"combined",
+			PaginatedFeedQuery{Search: "gopher", Tags: []string{"go"}, Since: at(0)},
+			[]int64{gophers},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := feedIDs(t, posts, viewer, tt.fq)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("filters apply across cursor pages", func(t *testing.T) {
+		fq := PaginatedFeedQuery{Limit: 1, Sort: "desc", Search: "gopher"}
+		first, err := posts.GetUserFeed(context.Background(), viewer, fq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fq.Cursor = Cursor{CreatedAt: first[0].CreateAt, ID: first[0].ID}.Encode()
+		got := feedIDs(t, posts, viewer, fq)
+		if !slices.Equal(got, []int64{gophers}) {
+			t.Errorf("got %v, wanted [%d]", got, gophers)
+		}
+	})
+}
+
+func TestGetUserFeedTimeline(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+
+	viewer := insertUser(t, db, "viewer")
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	carol := insertUser(t, db, "carol")
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	own := insertPost(t, db, viewer, testPost{createdAt: start})
+	alicePost := insertPost(t, db, alice, testPost{createdAt: start.Add(time.Minute)})
+	bobPost := insertPost(t, db, bob, testPost{createdAt: start.Add(2 * time.Minute)})
+	carolPost := insertPost(t, db, carol, testPost{createdAt: start.Add(3 * time.Minute)})
+
+	t.Run("should show own posts when following nobody", func(t *testing.T) {
+		got := feedIDs(t, posts, viewer, PaginatedFeedQuery{})
+		if !slices.Equal(got, []int64{own}) {
+			t.Errorf("got %v, wanted [%d]", got, own)
+		}
+	})
+
+	follow(t, db, viewer, alice)
+	follow(t, db, viewer, bob)
+	// carol following the viewer must not put her posts in the viewer's feed
+	follow(t, db, carol, viewer)
+
+	t.Run("should show followed and own posts once", func(t *testing.T) {
+		got := feedIDs(t, posts, viewer, PaginatedFeedQuery{})
+		want := []int64{bobPost, alicePost, own}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+
+	t.Run("should not multiply comment counts", func(t *testing.T) {
+		insertComment(t, db, own, alice)
+		insertComment(t, db, own, bob)
+		insertComment(t, db, alicePost, viewer)
+		deleted := insertComment(t, db, bobPost, viewer)
+		if err := (&CommentStore{db}).Delete(context.Background(), deleted); err != nil {
+			t.Fatal(err)
+		}
+		feed, err := posts.GetUserFeed(context.Background(), viewer, PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[int64]int{own: 2, alicePost: 1, bobPost: 0}
+		for _, post := range feed {
+			if post.CommentCount != want[post.ID] {
+				t.Errorf("post %d: got %d comments, wanted %d", post.ID, post.CommentCount, want[post.ID])
+			}
+		}
+	})
+
+	t.Run("should page through posts created at the same time", func(t *testing.T) {
+		same := start.Add(time.Hour)
+		var want []int64
+		for range 3 {
+			want = append(want, insertPost(t, db, alice, testPost{createdAt: same}))
+		}
+		slices.Reverse(want)
+		want = append(want, bobPost, alicePost, own)
+
+		var got []int64
+		fq := PaginatedFeedQuery{Limit: 2, Sort: "desc"}
+		for {
+			feed, err := posts.GetUserFeed(context.Background(), viewer, fq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, post := range feed {
+				got = append(got, post.ID)
+			}
+			if len(feed) < fq.Limit {
+				break
+			}
+			last := feed[len(feed)-1]
+			fq.Cursor = Cursor{CreatedAt: last.CreateAt, ID: last.ID}.Encode()
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+
+	t.Run("should drop posts of unfollowed users", func(t *testing.T) {
+		if _, err := db.Exec(`DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`, viewer, alice); err != nil {
+			t.Fatal(err)
+		}
+		got := feedIDs(t, posts, viewer, PaginatedFeedQuery{})
+		if slices.Contains(got, alicePost) || slices.Contains(got, carolPost) {
+			t.Errorf("got %v, wanted no posts of alice or carol", got)
+		}
+	})
+}
+
+func TestGetTimelineEntries(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	users := &UserStore{db}
+	ctx := context.Background()
+
+	viewer := insertUser(t, db, "viewer")
+	alice := insertUser(t, db, "alice")
+	star := insertUser(t, db, "star")
+	fans := []int64{viewer, alice, insertUser(t, db, "fan")}
+	for _, fan := range fans {
+		if err := users.AddFollower(ctx, fan, star); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := users.AddFollower(ctx, viewer, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	own := insertPost(t, db, viewer, testPost{createdAt: start})
+	alicePost := insertPost(t, db, alice, testPost{createdAt: start.Add(time.Minute)})
+	starPost := insertPost(t, db, star, testPost{createdAt: start.Add(2 * time.Minute)})
+
+	ids := func(entries []TimelineEntry) []int64 {
+		ids := []int64{}
+		for _, entry := range entries {
+			ids = append(ids, entry.PostID)
+		}
+		return ids
+	}
+	t.Run("should return the whole timeline", func(t *testing.T) {
+		entries, err := posts.GetTimelineEntries(ctx, viewer, Cursor{}, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(entries), []int64{starPost, alicePost, own}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+		if !entries[0].CreatedAt.Equal(start.Add(2 * time.Minute)) {
+			t.Errorf("got created at %v", entries[0].CreatedAt)
+		}
+	})
+	t.Run("should only pull authors with many followers", func(t *testing.T) {
+		entries, err := posts.GetTimelineEntries(ctx, viewer, Cursor{}, 10, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(entries), []int64{starPost}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+	t.Run("should start after the cursor", func(t *testing.T) {
+		before := Cursor{CreatedAt: start.Add(time.Minute).Format(time.RFC3339), ID: alicePost}
+		entries, err := posts.GetTimelineEntries(ctx, viewer, before, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(entries), []int64{own}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+	t.Run("should keep follower counts", func(t *testing.T) {
+		if _, err := users.GetFollowerIDs(ctx, star, 2); !errors.Is(err, ErrTooManyFollowers) {
+			t.Errorf("got %v, wanted ErrTooManyFollowers", err)
+		}
+		if err := users.DeleteFollower(ctx, alice, star); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Delete(ctx, viewer); err != nil {
+			t.Fatal(err)
+		}
+		got, err := users.GetFollowerIDs(ctx, star, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []int64{fans[2]}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+	t.Run("should hydrate posts in timeline order", func(t *testing.T) {
+		feed, err := posts.GetFeedByIDs(ctx, alice, []int64{alicePost, starPost, own})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the post of the viewer went with their account
+		if got, want := feedIDsOf(feed), []int64{starPost, alicePost}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db}
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	viewer := insertUser(t, db, "viewer")
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	for _, follow := range [][2]int64{{viewer, alice}, {bob, alice}, {alice, bob}} {
+		if err := users.AddFollower(ctx, follow[0], follow[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alicePost := insertPost(t, db, alice, testPost{})
+	insertPost(t, db, bob, testPost{})
+
+	t.Run("should count follows and posts", func(t *testing.T) {
+		p, err := users.GetProfile(ctx, alice, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.FollowersCount != 2 || p.FollowingCount != 1 || p.PostsCount != 1 || !p.ViewerFollows {
+			t.Errorf("got %+v", p)
+		}
+		p, err = users.GetProfile(ctx, viewer, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.FollowersCount != 0 || p.FollowingCount != 1 || p.ViewerFollows {
+			t.Errorf("got %+v", p)
+		}
+	})
+	t.Run("should page through followers", func(t *testing.T) {
+		first, err := users.ListFollowers(ctx, alice, PaginatedFollowQuery{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor := Cursor{CreatedAt: first[0].FollowedAt, ID: first[0].ID}.Encode()
+		second, err := users.ListFollowers(ctx, alice, PaginatedFollowQuery{Limit: 1, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int64{first[0].ID, second[0].ID}
+		slices.Sort(got)
+		if want := []int64{viewer, bob}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+	t.Run("should list following", func(t *testing.T) {
+		following, err := users.ListFollowing(ctx, alice, PaginatedFollowQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(following) != 1 || following[0].ID != bob {
+			t.Errorf("got %+v, wanted bob", following)
+		}
+	})
+	t.Run("should list the posts of a user", func(t *testing.T) {
+		feed, err := posts.GetUserPosts(ctx, viewer, alice, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := feedIDsOf(feed), []int64{alicePost}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+	})
+}
+
+func TestTags(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	hidden := insertUser(t, db, "hidden")
+	if _, err := db.Exec(`UPDATE users SET is_private = TRUE WHERE id = $1`, hidden); err != nil {
+		t.Fatal(err)
+	}
+	old := insertPost(t, db, alice, testPost{tags: []string{"go", "old"}, createdAt: time.Now().Add(-time.Hour * 48)})
+	golang := insertPost(t, db, alice, testPost{tags: []string{"go", "rust"}})
+	insertPost(t, db, bob, testPost{tags: []string{"go"}})
+	insertPost(t, db, hidden, testPost{tags: []string{"rust", "secret"}})
+	insertPost(t, db, hidden, testPost{tags: []string{"secret"}})
+
+	t.Run("should list the posts with a tag", func(t *testing.T) {
+		feed, err := posts.GetTagPosts(ctx, bob, "old", PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := feedIDsOf(feed), []int64{old}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted %v", got, want)
+		}
+		feed, err = posts.GetTagPosts(ctx, bob, "rust", PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := feedIDsOf(feed), []int64{golang}; !slices.Equal(got, want) {
+			t.Errorf("got %v, wanted the posts bob can see %v", got, want)
+		}
+	})
+	t.Run("should count trending tags in the window", func(t *testing.T) {
+		tags, err := posts.TrendingTags(ctx, time.Now().Add(-time.Hour*24), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []TrendingTag{{"go", 2}, {"rust", 1}}
+		if !slices.Equal(tags, want) {
+			t.Errorf("got %v, wanted %v", tags, want)
+		}
+	})
+}
+
+func TestPostStatus(t *testing.T) {
+	db := newTestDB(t)
+	posts := &PostStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	bob := insertUser(t, db, "bob")
+	follow(t, db, bob, alice)
+
+	create := func(t *testing.T, status string, publishAt *string) *Post {
+		t.Helper()
+		post := &Post{UserID: alice, Title: "t", Content: "c", Tags: []string{}, MediaIDs: []int64{}, Status: status, PublishAt: publishAt}
+		if err := posts.Create(ctx, post); err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+	soon := time.Now().Add(time.Hour).Format(time.RFC3339)
+	draft := create(t, PostDraft, nil)
+	scheduled := create(t, PostScheduled, &soon)
+	published := create(t, PostPublished, nil)
+	if published.PublishAt == nil {
+		t.Error("got no publish_at for a published post")
+	}
+
+	t.Run("should leave unpublished posts out of feeds", func(t *testing.T) {
+		if got := feedIDs(t, posts, bob, PaginatedFeedQuery{}); !slices.Equal(got, []int64{published.ID}) {
+			t.Errorf("got feed %v", got)
+		}
+		if got := feedIDs(t, posts, alice, PaginatedFeedQuery{}); !slices.Equal(got, []int64{published.ID}) {
+			t.Errorf("got own feed %v", got)
+		}
+		feed, err := posts.GetFeedByIDs(ctx, bob, []int64{draft.ID, scheduled.ID, published.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := feedIDsOf(feed); !slices.Equal(got, []int64{published.ID}) {
+			t.Errorf("got %v by ids", got)
+		}
+	})
+	t.Run("should list drafts and scheduled posts", func(t *testing.T) {
+		drafts, err := posts.GetDrafts(ctx, alice, PaginatedDraftQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, post := range drafts {
+			ids = append(ids, post.ID)
+		}
+		if !slices.Equal(ids, []int64{scheduled.ID, draft.ID}) {
+			t.Errorf("got drafts %v", ids)
+		}
+	})
+	t.Run("should publish due posts once", func(t *testing.T) {
+		if _, err := db.Exec(`UPDATE posts SET publish_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, scheduled.ID); err != nil {
+			t.Fatal(err)
+		}
+		// replicas race for the same posts
+		results := make(chan []Post, 2)
+		for range 2 {
+			go func() {
+				due, err := posts.PublishDue(ctx, 10)
+				if err != nil {
+					t.Error(err)
+				}
+				results <- due
+			}()
+		}
+		var ids []int64
+		for range 2 {
+			for _, post := range <-results {
+				ids = append(ids, post.ID)
+			}
+		}
+		if !slices.Equal(ids, []int64{scheduled.ID}) {
+			t.Errorf("got published %v, wanted the scheduled post once", ids)
+		}
+		if got := feedIDs(t, posts, bob, PaginatedFeedQuery{}); !slices.Equal(got, []int64{scheduled.ID, published.ID}) {
+			t.Errorf("got feed %v, wanted the scheduled post on top", got)
+		}
+	})
+	t.Run("should publish a draft on update", func(t *testing.T) {
+		got := &Post{}
+		if err := posts.GetPostById(ctx, got, draft.ID); err != nil {
+			t.Fatal(err)
+		}
+		got.Status = PostPublished
+		if err := posts.Update(ctx, got); err != nil {
+			t.Fatal(err)
+		}
+		if got.PublishAt == nil {
+			t.Error("got no publish_at")
+		}
+		if feed := feedIDs(t, posts, bob, PaginatedFeedQuery{}); feed[0] != draft.ID {
+			t.Errorf("got feed %v, wanted the draft on top", feed)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ReactionKinds are the reactions users can leave on a post.
+var ReactionKinds = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// ReactionCounts holds the number of reactions per kind, kinds nobody used are
+// left out.
+type ReactionCounts map[string]int
+
+func (rc *ReactionCounts) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*rc = ReactionCounts{}
+		return nil
+	default:
+		return fmt.Errorf("can't scan %T into ReactionCounts", src)
+	}
+	counts := ReactionCounts{}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	for kind, n := range counts {
+		if n <= 0 {
+			delete(counts, kind)
+		}
+	}
+	*rc = counts
+	return nil
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// adjustReactionCount changes the denormalized count of a kind on a post.
+const adjustReactionCount = `
+UPDATE posts
+SET reaction_counts = reaction_counts || jsonb_build_object(
+  $2::text, COALESCE((reaction_counts->>$2)::int, 0) + $3
+)
+WHERE id = $1
+RETURNING reaction_counts
+`
+
+// Set leaves the reaction of the user on a post, replacing an earlier one,
+// and returns the new counts of the post. It also returns whether the user had
+// no reaction on the post before, changing the kind is not a new reaction.
+func (s *ReactionStore) Set(ctx context.Context, postID, userID int64, kind string) (ReactionCounts, bool, error) {
+	counts := ReactionCounts{}
+	var previous string
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// the post row lock serializes reactions, so the counts stay exact
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT reaction_counts FROM posts WHERE id = $1 FOR UPDATE`,
+			postID,
+		).Scan(&counts)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		err = tx.QueryRowContext(
+			ctx,
+			`SELECT kind FROM post_reactions WHERE post_id = $1 AND user_id = $2`,
+			postID,
+			userID,
+		).Scan(&previous)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if previous == kind {
+			return nil
+		}
+		query := `
+INSERT INTO post_reactions(post_id, user_id, kind) VALUES ($1, $2, $3)
+ON CONFLICT (post_id, user_id) DO UPDATE SET kind = EXCLUDED.kind, created_at = NOW()
+`
+		if _, err := tx.ExecContext(ctx, query, postID, userID, kind); err != nil {
+			return err
+		}
+		if previous != "" {
+			if _, err := tx.ExecContext(ctx, adjustReactionCount, postID, previous, -1); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRowContext(ctx, adjustReactionCount, postID, kind, 1).Scan(&counts)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return counts, previous == "", nil
+}
+
+// Delete takes back the reaction of the user and returns the new counts.
+func (s *ReactionStore) Delete(ctx context.Context, postID, userID int64) (ReactionCounts, error) {
+	counts := ReactionCounts{}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `SELECT 1 FROM posts WHERE id = $1 FOR UPDATE`, postID)
+		if err != nil {
+			return err
+		}
+		var kind string
+		err = tx.QueryRowContext(
+			ctx,
+			`DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 RETURNING kind`,
+			postID,
+			userID,
+		).Scan(&kind)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		return tx.QueryRowContext(ctx, adjustReactionCount, postID, kind, -1).Scan(&counts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Get returns the kind of the reaction the user left on a post.
+func (s *ReactionStore) Get(ctx context.Context, postID, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	var kind string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT kind FROM post_reactions WHERE post_id = $1 AND user_id = $2`,
+		postID,
+		userID,
+	).Scan(&kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrorNotFound
+		default:
+			return "", err
+		}
+	}
+	return kind, nil
+}
@@ -0,0 +1,20 @@
+package store
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestReactionCountsScan(t *testing.T) {
+	var counts ReactionCounts
+	if err := counts.Scan([]byte(`{"like": 3, "sad": 0, "wow": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := ReactionCounts{"like": 3, "wow": 1}
+	if !maps.Equal(counts, want) {
+		t.Errorf("got %v, wanted %v", counts, want)
+	}
+	if err := counts.Scan(nil); err != nil || len(counts) != 0 {
+		t.Errorf("got %v, %v, wanted empty counts", counts, err)
+	}
+}
@@ -3,11 +3,23 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
 )
 
 type Role struct {
-	RoleName string
-	RoleID   int64
+	RoleName    string   `json:"name"`
+	RoleID      int64    `json:"id"`
+	Level       int      `json:"level"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type Permission struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 type RoleStore struct {
@@ -25,3 +37,190 @@ func (r *RoleStore) GetIDByName(ctx context.Context, role_string string) (*Role,
 	}
 	return role, nil
 }
+
+// List returns every role with the names of its permissions, by level.
+func (r *RoleStore) List(ctx context.Context) ([]Role, error) {
+	query := `
+SELECT r.id, r.name, r.level, r.description,
+  COALESCE(ARRAY_AGG(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+FROM roles r
+LEFT JOIN role_permissions rp ON rp.role_id = r.id
+LEFT JOIN permissions p ON p.id = rp.permission_id
+GROUP BY r.id
+ORDER BY r.level, r.id
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(
+			&role.RoleID,
+			&role.RoleName,
+			&role.Level,
+			&role.Description,
+			pq.Array(&role.Permissions),
+		); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *RoleStore) ListPermissions(ctx context.Context) ([]Permission, error) {
+	query := `SELECT id, name, description FROM permissions ORDER BY name`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	permissions := []Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// Create inserts the role together with its permissions.
+func (r *RoleStore) Create(ctx context.Context, role *Role) error {
+	query := `
+INSERT INTO roles(name, level, description) VALUES ($1, $2, $3) RETURNING id
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			role.RoleName,
+			role.Level,
+			role.Description,
+		).Scan(&role.RoleID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrDuplicateRole
+			}
+			return err
+		}
+		return setRolePermissions(ctx, tx, role.RoleID, role.Permissions)
+	})
+}
+
+func (r *RoleStore) Update(ctx context.Context, role *Role) error {
+	query := `
+UPDATE roles SET level = $2, description = $3 WHERE id = $1 RETURNING name
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		role.RoleID,
+		role.Level,
+		role.Description,
+	).Scan(&role.RoleName)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPermissions replaces the permissions of a role.
+func (r *RoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT id FROM roles WHERE id = $1 FOR UPDATE`,
+			roleID,
+		).Scan(&roleID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID)
+		if err != nil {
+			return err
+		}
+		return setRolePermissions(ctx, tx, roleID, permissions)
+	})
+}
+
+// Delete removes a role no user holds anymore.
+func (r *RoleStore) Delete(ctx context.Context, roleID int64) error {
+	query := `DELETE FROM roles WHERE id = $1`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, query, roleID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrRoleInUse
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+func setRolePermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	query := `
+INSERT INTO role_permissions(role_id, permission_id)
+SELECT $1, id FROM permissions WHERE name = ANY($2)
+ON CONFLICT DO NOTHING
+`
+	res, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != int64(len(uniqueStrings(permissions))) {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session groups every refresh token issued from a single login. Rotating a
+// refresh token keeps the session, revoking the session kills the whole family.
+type Session struct {
+	ID        string     `json:"id"`
+	UserID    int64      `json:"user_id"`
+	CreatedAt string     `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func (s *SessionStore) Create(
+	ctx context.Context,
+	userID int64,
+	refreshToken string,
+	exp time.Duration,
+) (*Session, error) {
+	session := &Session{
+		ID:     uuid.New().String(),
+		UserID: userID,
+	}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+INSERT INTO sessions(id, user_id) VALUES($1, $2) RETURNING created_at
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		err := tx.QueryRowContext(ctx, query, session.ID, userID).Scan(&session.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return s.createRefreshToken(ctx, tx, session.ID, refreshToken, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *SessionStore) createRefreshToken(
+	ctx context.Context,
+	tx *sql.Tx,
+	sessionID string,
+	token string,
+	exp time.Duration,
+) error {
+	query := `
+INSERT INTO refresh_tokens(token, session_id, expiry) VALUES($1, $2, $3);
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, hashToken(token), sessionID, time.Now().Add(exp))
+	return err
+}
+
+// Rotate exchanges a refresh token for a new one in the same session. Presenting
+// a token that was already rotated means it leaked, so the session is revoked
+// and ErrTokenReused is returned.
+func (s *SessionStore) Rotate(
+	ctx context.Context,
+	refreshToken string,
+	newRefreshToken string,
+	exp time.Duration,
+) (*Session, error) {
+	session := &Session{}
+	reused := false
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+SELECT s.id, s.user_id, s.created_at, s.revoked_at, rt.expiry, rt.used_at IS NOT NULL
+FROM refresh_tokens rt
+JOIN sessions s ON s.id = rt.session_id
+WHERE rt.token = $1
+FOR UPDATE OF rt
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		var expiry time.Time
+		var used bool
+		err := tx.QueryRowContext(ctx, query, hashToken(refreshToken)).Scan(
+			&session.ID,
+			&session.UserID,
+			&session.CreatedAt,
+			&session.RevokedAt,
+			&expiry,
+			&used,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrInvalidToken
+			default:
+				return err
+			}
+		}
+		if session.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+		if used {
+			// the revocation has to be committed, so the error is returned
+			// once the transaction is done
+			reused = true
+			return s.revoke(ctx, tx, session.ID)
+		}
+		if time.Now().After(expiry) {
+			return ErrTokenExpired
+		}
+		query = `
+UPDATE refresh_tokens SET used_at = NOW() WHERE token = $1;
+`
+		_, err = tx.ExecContext(ctx, query, hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		return s.createRefreshToken(ctx, tx, session.ID, newRefreshToken, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrTokenReused
+	}
+	return session, nil
+}
+
+func (s *SessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	query := `
+SELECT id, user_id, created_at, revoked_at FROM sessions WHERE id = $1;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	session := &Session{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.CreatedAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, id string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return s.revoke(ctx, tx, id)
+	})
+}
+
+func (s *SessionStore) revoke(ctx context.Context, tx *sql.Tx, id string) error {
+	query := `
+UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// RevokeAllForUser logs the user out everywhere.
+func (s *SessionStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return revokeUserSessions(ctx, tx, userID)
+	})
+}
+
+func revokeUserSessions(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
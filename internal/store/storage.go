@@ -2,20 +2,40 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 )
 
 var (
-	ErrorNotFound         = errors.New("record not found")
-	QueryTimeOut          = time.Second * 5
-	ErrUserAlreadyFollows = errors.New("user already follows")
-	ErrDuplicateEmail     = errors.New("duplicate email")
-	ErrDuplicateUsername  = errors.New("duplicate username")
-	ErrInvitationExpired  = errors.New("invitation expired")
-	ErrInvalidToken       = errors.New("invalid token")
-	ErrEmailNotConfirmed  = errors.New("email not confirmed")
+	ErrorNotFound              = errors.New("record not found")
+	QueryTimeOut               = time.Second * 5
+	ErrUserAlreadyFollows      = errors.New("user already follows")
+	ErrDuplicateEmail          = errors.New("duplicate email")
+	ErrDuplicateUsername       = errors.New("duplicate username")
+	ErrInvitationExpired       = errors.New("invitation expired")
+	ErrInvalidToken            = errors.New("invalid token")
+	ErrEmailNotConfirmed       = errors.New("email not confirmed")
+	ErrTokenExpired            = errors.New("token expired")
+	ErrTokenReused             = errors.New("refresh token reused")
+	ErrSessionRevoked          = errors.New("session revoked")
+	ErrInvitationTooSoon       = errors.New("invitation was sent recently")
+	ErrMFAAlreadyEnabled       = errors.New("two-factor authentication already enabled")
+	ErrDuplicateRole           = errors.New("duplicate role")
+	ErrRoleInUse               = errors.New("role is assigned to users")
+	ErrUnknownPermission       = errors.New("unknown permission")
+	ErrUnknownRole             = errors.New("unknown role")
+	ErrInvalidCursor           = errors.New("invalid cursor")
+	ErrMediaNotFound           = errors.New("media not found or attached to another post")
+	ErrParentNotFound          = errors.New("parent comment not found")
+	ErrMaxDepth                = errors.New("replies are nested too deep")
+	ErrInvalidTimeWindow       = errors.New("since must be before until")
+	ErrTooManyFollowers        = errors.New("user has too many followers")
+	ErrBlocked                 = errors.New("user is blocked")
+	ErrUnknownNotificationType = errors.New("unknown notification type")
 )
 
 type Storage struct {
@@ -24,6 +44,13 @@ type Storage struct {
 		GetPostById(context.Context, *Post, int64) error
 		Update(ctx context.Context, post *Post) error
 		GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]UserFeed, error)
+		GetTimelineEntries(ctx context.Context, userID int64, before Cursor, limit, minFollowers int) ([]TimelineEntry, error)
+		GetFeedByIDs(ctx context.Context, userID int64, ids []int64) ([]UserFeed, error)
+		GetUserPosts(ctx context.Context, viewerID, authorID int64, fq PaginatedFeedQuery) ([]UserFeed, error)
+		GetTagPosts(ctx context.Context, viewerID int64, tag string, fq PaginatedFeedQuery) ([]UserFeed, error)
+		TrendingTags(ctx context.Context, since time.Time, limit int) ([]TrendingTag, error)
+		GetDrafts(ctx context.Context, userID int64, dq PaginatedDraftQuery) ([]Post, error)
+		PublishDue(ctx context.Context, limit int) ([]Post, error)
 		Delete(ctx context.Context, id int64) error
 	}
 	Users interface {
@@ -31,6 +58,22 @@ type Storage struct {
 		GetUser(context.Context, *User, int64) error
 		AddFollower(ctx context.Context, userID, followerID int64) error
 		DeleteFollower(ctx context.Context, userID, followerID int64) error
+		GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error)
+		GetProfile(ctx context.Context, userID, viewerID int64) (*Profile, error)
+		ListFollowers(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]FollowUser, error)
+		ListFollowing(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]FollowUser, error)
+		IsFollowing(ctx context.Context, userID, targetID int64) (bool, error)
+		CreateFollowRequest(ctx context.Context, userID, targetID int64) error
+		ListFollowRequests(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error)
+		ApproveFollowRequest(ctx context.Context, userID, requesterID int64) error
+		RejectFollowRequest(ctx context.Context, userID, requesterID int64) error
+		UpdateProfile(ctx context.Context, user *User) error
+		ChangePassword(ctx context.Context, user *User, keepSessionID string) error
+		CreateEmailChange(ctx context.Context, userID int64, email, token string, exp time.Duration) error
+		ConfirmEmailChange(ctx context.Context, token string) (int64, error)
+		SoftDelete(ctx context.Context, userID int64) error
+		Restore(ctx context.Context, userID int64) error
+		PurgeDeleted(ctx context.Context, grace time.Duration) (int64, error)
 		CreateAndInvite(
 			ctx context.Context,
 			user *User,
@@ -40,22 +83,102 @@ type Storage struct {
 		Activate(ctx context.Context, token string) error
 		GetUserByEmail(ctx context.Context, email string) (*User, error)
 		Delete(ctx context.Context, userID int64) error
+		CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error
+		ResetPassword(ctx context.Context, token string, user *User) error
+		ReplaceInvitation(ctx context.Context, email, token string, exp, cooldown time.Duration) (*User, error)
+		DeleteExpiredInvitations(ctx context.Context) (int64, error)
+		DeleteUnactivated(ctx context.Context, age time.Duration) (int64, error)
+		List(ctx context.Context, q PaginatedUserQuery) ([]User, error)
+		SetRole(ctx context.Context, userID, roleID int64) error
+		Deactivate(ctx context.Context, userID int64) error
+		Reactivate(ctx context.Context, userID int64) error
+		ForcePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) (*User, error)
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(ctx context.Context, postID int64) ([]Comment, error)
+		GetByPostID(ctx context.Context, postID, viewerID int64, cq PaginatedCommentQuery) ([]Comment, error)
+		GetThread(ctx context.Context, root *Comment, viewerID int64, cq PaginatedCommentQuery) ([]Comment, error)
+		GetByID(ctx context.Context, id int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(ctx context.Context, id int64) error
 	}
 	Roles interface {
 		GetIDByName(context.Context, string) (*Role, error)
+		List(context.Context) ([]Role, error)
+		ListPermissions(context.Context) ([]Permission, error)
+		Create(context.Context, *Role) error
+		Update(context.Context, *Role) error
+		SetPermissions(ctx context.Context, roleID int64, permissions []string) error
+		Delete(ctx context.Context, roleID int64) error
+	}
+	Reactions interface {
+		Set(ctx context.Context, postID, userID int64, kind string) (ReactionCounts, bool, error)
+		Delete(ctx context.Context, postID, userID int64) (ReactionCounts, error)
+		Get(ctx context.Context, postID, userID int64) (string, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, userID, blockedID int64) error
+		Unblock(ctx context.Context, userID, blockedID int64) error
+		Mute(ctx context.Context, userID, mutedID int64) error
+		Unmute(ctx context.Context, userID, mutedID int64) error
+		IsBlocked(ctx context.Context, userID, otherID int64) (bool, error)
+		ListBlocked(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error)
+		ListMuted(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]ListedUser, error)
+	}
+	Notifications interface {
+		Create(ctx context.Context, n *Notification) (bool, error)
+		List(ctx context.Context, userID int64, q PaginatedNotificationQuery) ([]Notification, error)
+		MarkRead(ctx context.Context, userID, id int64) error
+		MarkAllRead(ctx context.Context, userID int64) (int64, error)
+		UnreadCount(ctx context.Context, userID int64) (int64, error)
+		GetPreferences(ctx context.Context, userID int64) (NotificationPreferences, error)
+		SetPreferences(ctx context.Context, userID int64, prefs NotificationPreferences) error
+	}
+	Media interface {
+		Create(ctx context.Context, m *Media) error
+		GetByID(ctx context.Context, id int64) (*Media, error)
+		DeleteUnattached(ctx context.Context, age time.Duration, limit int) ([]Media, error)
+	}
+	Mentions interface {
+		SetPostMentions(ctx context.Context, postID int64, usernames []string) ([]int64, error)
+		SetCommentMentions(ctx context.Context, commentID int64, usernames []string) ([]int64, error)
+	}
+	Sessions interface {
+		Create(ctx context.Context, userID int64, refreshToken string, exp time.Duration) (*Session, error)
+		Rotate(ctx context.Context, refreshToken, newRefreshToken string, exp time.Duration) (*Session, error)
+		Get(ctx context.Context, id string) (*Session, error)
+		Revoke(ctx context.Context, id string) error
+		RevokeAllForUser(ctx context.Context, userID int64) error
+	}
+	MFA interface {
+		CreateTOTP(ctx context.Context, userID int64, secret string) error
+		GetTOTP(ctx context.Context, userID int64) (*TOTP, error)
+		ConfirmTOTP(ctx context.Context, userID int64, step int64, recoveryCodes []string) error
+		UseTOTPStep(ctx context.Context, userID int64, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+		DeleteTOTP(ctx context.Context, userID int64) error
+	}
+	Lockouts interface {
+		Create(context.Context, *Lockout) error
+		ListActive(context.Context) ([]Lockout, error)
+		Unlock(ctx context.Context, id int64, adminID int64) (*Lockout, error)
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:    &PostStore{db},
-		Users:    &UserStore{db},
-		Comments: &CommentStore{db},
-		Roles:    &RoleStore{db},
+		Posts:         &PostStore{db},
+		Users:         &UserStore{db},
+		Comments:      &CommentStore{db},
+		Roles:         &RoleStore{db},
+		Reactions:     &ReactionStore{db},
+		Blocks:        &BlockStore{db},
+		Notifications: &NotificationStore{db},
+		Mentions:      &MentionStore{db},
+		Media:         &MediaStore{db},
+		Sessions:      &SessionStore{db},
+		MFA:           &MFAStore{db},
+		Lockouts:      &LockoutStore{db},
 	}
 }
 
@@ -70,3 +193,18 @@ func withTx(ctx context.Context, db *sql.DB, f func(*sql.Tx) error) error {
 	}
 	return tx.Commit()
 }
+
+// hashToken returns the form a plain token is persisted in, so a leaked table
+// can't be replayed against the API.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes a search string match itself in a LIKE pattern, % and _
+// would match anything otherwise. The backslash is the default escape of LIKE.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,20 @@
+package store
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"gopher", "gopher"},
+		{"100%", `100\%`},
+		{"snake_case", `snake\_case`},
+		{`C:\go`, `C:\\go`},
+		{`\%_`, `\\\%\_`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, wanted %q", tt.in, got, tt.want)
+		}
+	}
+}
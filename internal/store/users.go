@@ -2,9 +2,7 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"time"
 
@@ -14,12 +12,49 @@ import (
 )
 
 type User struct {
-	Username  string   `json:"username"`
-	Email     string   `json:"email"`
-	CreatedAt string   `json:"created_at"`
-	Password  password `json:"-"`
-	ID        int64    `json:"id"`
-	RoleID    int64    `json:"role_id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	CreatedAt     string     `json:"created_at"`
+	Password      password   `json:"-"`
+	ID            int64      `json:"id"`
+	RoleID        int64      `json:"role_id"`
+	IsActive      bool       `json:"is_active"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	Bio           string     `json:"bio"`
+	AvatarURL     string     `json:"avatar_url"`
+	DisplayName   string     `json:"display_name"`
+	IsPrivate     bool       `json:"is_private"`
+	// set while the account waits to be purged after the user deleted it
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Profile is a user as other users see them. Email is only filled in for the
+// user themselves.
+type Profile struct {
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	DisplayName    string `json:"display_name"`
+	Email          string `json:"email,omitempty"`
+	Bio            string `json:"bio"`
+	AvatarURL      string `json:"avatar_url"`
+	CreatedAt      string `json:"created_at"`
+	IsPrivate      bool   `json:"is_private"`
+	FollowersCount int64  `json:"followers_count"`
+	FollowingCount int64  `json:"following_count"`
+	PostsCount     int64  `json:"posts_count"`
+	// whether the user looking at the profile follows this user
+	ViewerFollows bool `json:"viewer_follows"`
+	// whether the user looking at the profile asked to follow this user
+	ViewerRequested bool `json:"viewer_requested"`
+}
+
+// FollowUser is a user in a followers or following list.
+type FollowUser struct {
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	Bio        string `json:"bio"`
+	AvatarURL  string `json:"avatar_url"`
+	FollowedAt string `json:"followed_at"`
 }
 
 type password struct {
@@ -64,27 +99,48 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		&user.CreatedAt,
 	)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
-			return ErrDuplicateUsername
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
-		default:
-			return err
-		}
+		return userConstraintError(err)
 	}
 	return nil
 }
 
+// userConstraintError maps violations of the unique username and email
+// constraints to their errors.
+func userConstraintError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+		return ErrDuplicateUsername
+	case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		return ErrDuplicateEmail
+	default:
+		return err
+	}
+}
+
 func (s *UserStore) GetUser(ctx context.Context, user *User, id int64) error {
 	query := `
-		SELECT id, username, email, created_at, role_id FROM users WHERE id = $1;
+		SELECT id, username, email, created_at, role_id, is_active, deactivated_at, bio, avatar_url,
+		  display_name, deleted_at, is_private
+		FROM users WHERE id = $1;
 		`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
 	err := s.db.QueryRowContext(
 		ctx, query, id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.RoleID)
+	).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.RoleID,
+		&user.IsActive,
+		&user.DeactivatedAt,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.DisplayName,
+		&user.DeletedAt,
+		&user.IsPrivate,
+	)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -96,31 +152,210 @@ func (s *UserStore) GetUser(ctx context.Context, user *User, id int64) error {
 	return nil
 }
 
-func (s *UserStore) AddFollower(ctx context.Context, userID, followerID int64) error {
+// GetProfile returns the profile of an active user as viewerID sees it.
+func (s *UserStore) GetProfile(ctx context.Context, userID, viewerID int64) (*Profile, error) {
 	query := `
-INSERT INTO followers(user_id, follower_id) VALUES($1, $2)
+SELECT
+  u.id, u.username, u.display_name, u.email, u.bio, u.avatar_url, u.created_at, u.is_private,
+  u.followers_count,
+  (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id),
+  (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id AND p.status = 'published'),
+  EXISTS(SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = u.id),
+  EXISTS(SELECT 1 FROM follow_requests r WHERE r.user_id = $2 AND r.target_id = u.id)
+FROM users u
+WHERE u.id = $1 AND u.is_active AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
+	p := &Profile{}
+	err := s.db.QueryRowContext(ctx, query, userID, viewerID).Scan(
+		&p.ID,
+		&p.Username,
+		&p.DisplayName,
+		&p.Email,
+		&p.Bio,
+		&p.AvatarURL,
+		&p.CreatedAt,
+		&p.IsPrivate,
+		&p.FollowersCount,
+		&p.FollowingCount,
+		&p.PostsCount,
+		&p.ViewerFollows,
+		&p.ViewerRequested,
+	)
 	if err != nil {
-		if prErr, ok := err.(*pq.Error); ok && prErr.Code == "23505" {
-			return ErrUserAlreadyFollows
-		} else {
-			return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
 		}
 	}
-	return nil
+	return p, nil
 }
 
-func (s *UserStore) DeleteFollower(ctx context.Context, userID, followerID int64) error {
+// ListFollowers returns a page of the users following the user, the newest
+// follow first.
+func (s *UserStore) ListFollowers(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]FollowUser, error) {
+	return s.listFollows(ctx, "f.user_id", "f.follower_id", userID, q)
+}
+
+// ListFollowing returns a page of the users the user follows, the newest
+// follow first.
+func (s *UserStore) ListFollowing(ctx context.Context, userID int64, q PaginatedFollowQuery) ([]FollowUser, error) {
+	return s.listFollows(ctx, "f.follower_id", "f.user_id", userID, q)
+}
+
+// listFollows lists the users in column listed of the follows of the user in
+// column of.
+func (s *UserStore) listFollows(
+	ctx context.Context,
+	listed, of string,
+	userID int64,
+	q PaginatedFollowQuery,
+) ([]FollowUser, error) {
+	after := Cursor{CreatedAt: "epoch"}
+	if q.Cursor != "" {
+		var err error
+		if after, err = DecodeCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
 	query := `
+SELECT u.id, u.username, u.bio, u.avatar_url, f.created_at
+FROM followers f
+JOIN users u ON u.id = ` + listed + `
+WHERE ` + of + ` = $1
+  AND u.deactivated_at IS NULL
+  AND u.deleted_at IS NULL
+  AND ($2 = 0 OR (f.created_at, u.id) < ($3::timestamptz, $2))
+ORDER BY f.created_at DESC, u.id DESC
+LIMIT $4
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, after.ID, after.CreatedAt, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []FollowUser{}
+	for rows.Next() {
+		var u FollowUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.Bio, &u.AvatarURL, &u.FollowedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *UserStore) AddFollower(ctx context.Context, userID, followerID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+SELECT EXISTS(
+  SELECT 1 FROM blocks
+  WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+)
+`
+		var blocked bool
+		if err := tx.QueryRowContext(ctx, query, userID, followerID).Scan(&blocked); err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+		query = `
+INSERT INTO followers(user_id, follower_id) VALUES($1, $2)
+`
+		_, err := tx.ExecContext(ctx, query, userID, followerID)
+		if err != nil {
+			if prErr, ok := err.(*pq.Error); ok && prErr.Code == "23505" {
+				return ErrUserAlreadyFollows
+			} else {
+				return err
+			}
+		}
+		query = `UPDATE users SET followers_count = followers_count + 1 WHERE id = $1`
+		_, err = tx.ExecContext(ctx, query, followerID)
+		return err
+	})
+}
+
+func (s *UserStore) DeleteFollower(ctx context.Context, userID, followerID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// unfollowing a private account also withdraws a pending request
+		query := `
+DELETE FROM follow_requests WHERE user_id = $1 AND target_id = $2;
+`
+		if _, err := tx.ExecContext(ctx, query, userID, followerID); err != nil {
+			return err
+		}
+		query = `
 DELETE FROM followers WHERE user_id = $1 AND follower_id = $2;
 `
+		result, err := tx.ExecContext(ctx, query, userID, followerID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return err
+		}
+		query = `UPDATE users SET followers_count = followers_count - 1 WHERE id = $1`
+		_, err = tx.ExecContext(ctx, query, followerID)
+		return err
+	})
+}
+
+// GetFollowerIDs returns the ids of the users following the user, leaving out
+// the ones who muted them. Users with more than limit followers get
+// ErrTooManyFollowers instead.
+func (s *UserStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
-	return err
+	var count int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT followers_count FROM users WHERE id = $1`,
+		userID,
+	).Scan(&count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	if count > int64(limit) {
+		return nil, ErrTooManyFollowers
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`
+SELECT f.user_id FROM followers f
+WHERE f.follower_id = $1
+  AND NOT EXISTS (SELECT 1 FROM mutes m WHERE m.user_id = f.user_id AND m.muted_id = $1)
+`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
 func (s *UserStore) CreateAndInvite(
@@ -155,7 +390,7 @@ insert into user_invitations(token, user_id, expiry) values($1, $2, $3);
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	_, err := tx.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
 	if err != nil {
 		return err
 	}
@@ -163,15 +398,107 @@ insert into user_invitations(token, user_id, expiry) values($1, $2, $3);
 	return nil
 }
 
+// ReplaceInvitation issues a new invitation token for an account that was never
+// activated and drops the previous ones. A new token is only handed out once the
+// last one is older than cooldown.
+func (s *UserStore) ReplaceInvitation(
+	ctx context.Context,
+	email string,
+	token string,
+	exp time.Duration,
+	cooldown time.Duration,
+) (*User, error) {
+	user := &User{}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+select id, username, email from users where email = $1 and is_active = false for update;
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		err := tx.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		query = `
+select exists(select 1 from user_invitations where user_id = $1 and created_at > $2);
+`
+		var tooSoon bool
+		err = tx.QueryRowContext(ctx, query, user.ID, time.Now().Add(-cooldown)).Scan(&tooSoon)
+		if err != nil {
+			return err
+		}
+		if tooSoon {
+			return ErrInvitationTooSoon
+		}
+		query = `
+delete from user_invitations where user_id = $1;
+`
+		if _, err := tx.ExecContext(ctx, query, user.ID); err != nil {
+			return err
+		}
+		return s.createUserInvite(ctx, tx, user.ID, token, exp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `
+delete from user_invitations where expiry < NOW();
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteUnactivated removes accounts that were never activated within age, which
+// frees their email and username again.
+func (s *UserStore) DeleteUnactivated(ctx context.Context, age time.Duration) (int64, error) {
+	var count int64
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		before := time.Now().Add(-age)
+		query := `
+delete from user_invitations where user_id in (
+  select id from users where is_active = false and created_at < $1
+);
+`
+		if _, err := tx.ExecContext(ctx, query, before); err != nil {
+			return err
+		}
+		query = `
+delete from users where is_active = false and created_at < $1;
+`
+		result, err := tx.ExecContext(ctx, query, before)
+		if err != nil {
+			return err
+		}
+		count, err = result.RowsAffected()
+		return err
+	})
+	return count, err
+}
+
 func (s *UserStore) Activate(ctx context.Context, token string) error {
-	hash := sha256.Sum256([]byte(token))
-	hashToken := hex.EncodeToString(hash[:])
+	hashedToken := hashToken(token)
 	query := `
 SELECT user_id, expiry from user_invitations where token = $1;
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, query, hashToken)
+	row := s.db.QueryRowContext(ctx, query, hashedToken)
 	var userID int64
 	var expiryString string
 	err := row.Scan(&userID, &expiryString)
@@ -207,60 +534,651 @@ update users set is_active=true where id = $1;
 	query = `
 delete from user_invitations where token = $1;
 `
-	s.db.ExecContext(ctx, query, hashToken)
+	s.db.ExecContext(ctx, query, hashedToken)
 	return nil
 }
 
+// Delete removes the user with everything they wrote. Their comments that have
+// replies of others are kept as tombstones.
 func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		// the posts the user commented on, their threads are tidied up after
+		var commented pq.Int64Array
+		err := tx.QueryRowContext(
+			ctx,
+			`select coalesce(array_agg(distinct post_id), '{}') from comments where user_id = $1;`,
+			userID,
+		).Scan(&commented)
+		if err != nil {
+			return err
+		}
+		queries := []string{
+			`delete from user_invitations where user_id = $1;`,
+			// the follows cascade with the user, the counts of the followed don't
+			`update users set followers_count = followers_count - 1
+			where id in (select follower_id from followers where user_id = $1);`,
+			// the reactions go with the user, their counts have to follow
+			`update posts p set reaction_counts = p.reaction_counts || jsonb_build_object(
+				r.kind, coalesce((p.reaction_counts->>r.kind)::int, 0) - 1
+			) from post_reactions r where r.post_id = p.id and r.user_id = $1;`,
+			`delete from comments where post_id in (select id from posts where user_id = $1);`,
+			// replies of others under the comments of the user stay reachable
+			`update comments set content = '', deleted_at = coalesce(deleted_at, NOW())
+			where user_id = $1 and exists(select 1 from comments r where r.parent_id = comments.id);`,
+			`delete from comments where user_id = $1 and deleted_at is null;`,
+			`delete from posts where user_id = $1;`,
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return err
+			}
+		}
+		if err := deleteEmptyTombstones(ctx, tx, commented); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `delete from users where id = $1;`, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return ErrorNotFound
+		}
+		return nil
+	})
+}
+
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-delete from users where id = $1;
+SELECT id, username, email, password, is_active, role_id, deactivated_at, deleted_at from users where email = $1;
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	result, err := s.db.ExecContext(ctx, query, userID)
+	user := &User{}
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.Hash,
+		&user.IsActive,
+		&user.RoleID,
+		&user.DeactivatedAt,
+		&user.DeletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	if !user.IsActive {
+		return nil, ErrEmailNotConfirmed
+	}
+	return user, nil
+}
+
+func (s *UserStore) CreatePasswordReset(
+	ctx context.Context,
+	userID int64,
+	token string,
+	exp time.Duration,
+) error {
+	query := `
+insert into password_resets(token, user_id, expiry) values($1, $2, $3);
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
+	return err
+}
+
+// ResetPassword sets the password of the user the reset token was issued to.
+// Every reset token of the user is spent and all sessions are revoked.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, user *User) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+select user_id, expiry from password_resets where token = $1 for update;
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		var expiry time.Time
+		err := tx.QueryRowContext(ctx, query, hashToken(token)).Scan(&user.ID, &expiry)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrInvalidToken
+			default:
+				return err
+			}
+		}
+		if time.Now().After(expiry) {
+			return ErrTokenExpired
+		}
+		query = `
+update users set password = $1 where id = $2;
+`
+		_, err = tx.ExecContext(ctx, query, user.Password.Hash, user.ID)
+		if err != nil {
+			return err
+		}
+		query = `
+delete from password_resets where user_id = $1;
+`
+		_, err = tx.ExecContext(ctx, query, user.ID)
+		if err != nil {
+			return err
+		}
+		return revokeUserSessions(ctx, tx, user.ID)
+	})
+}
+
+// List returns the users matching the query, oldest first.
+func (s *UserStore) List(ctx context.Context, q PaginatedUserQuery) ([]User, error) {
+	query := `
+SELECT id, username, email, created_at, role_id, is_active, deactivated_at
+FROM users
+WHERE ($1 = '' OR username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+  AND ($2 = 0 OR role_id = $2)
+  AND (
+    $3 = ''
+    OR ($3 = 'active' AND is_active AND deactivated_at IS NULL)
+    OR ($3 = 'pending' AND NOT is_active)
+    OR ($3 = 'deactivated' AND deactivated_at IS NOT NULL)
+  )
+ORDER BY id
+LIMIT $4 OFFSET $5
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		escapeLike(q.Search),
+		q.RoleID,
+		q.Status,
+		q.Limit,
+		q.Offset,
+	)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(
+			&u.ID,
+			&u.Username,
+			&u.Email,
+			&u.CreatedAt,
+			&u.RoleID,
+			&u.IsActive,
+			&u.DeactivatedAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *UserStore) SetRole(ctx context.Context, userID, roleID int64) error {
+	query := `
+update users set role_id = $2 where id = $1;
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID, roleID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrUnknownRole
+		}
 		return err
 	}
 	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows != 1 {
+	if rows == 0 {
 		return ErrorNotFound
 	}
-	query = `
-delete from user_invitations where user_id = $1;
+	return nil
+}
+
+// Deactivate blocks the user from signing in and revokes all their sessions.
+func (s *UserStore) Deactivate(ctx context.Context, userID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+update users set deactivated_at = coalesce(deactivated_at, NOW()) where id = $1;
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		result, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrorNotFound
+		}
+		return revokeUserSessions(ctx, tx, userID)
+	})
+}
+
+func (s *UserStore) Reactivate(ctx context.Context, userID int64) error {
+	query := `
+update users set deactivated_at = NULL where id = $1;
 `
-	result, err = s.db.ExecContext(ctx, query, userID)
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	result, err := s.db.ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
-	rows, err = result.RowsAffected()
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rows != 1 {
+	if rows == 0 {
 		return ErrorNotFound
 	}
 	return nil
 }
 
-func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+// ForcePasswordReset makes the current password unusable, revokes all sessions
+// and issues a reset token, so the user has to choose a new password.
+func (s *UserStore) ForcePasswordReset(
+	ctx context.Context,
+	userID int64,
+	token string,
+	exp time.Duration,
+) (*User, error) {
+	user := &User{}
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// an empty hash never matches a password
+		query := `
+update users set password = '' where id = $1 returning id, username, email;
+`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		err := tx.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+		query = `
+insert into password_resets(token, user_id, expiry) values($1, $2, $3);
+`
+		_, err = tx.ExecContext(ctx, query, hashToken(token), userID, time.Now().Add(exp))
+		if err != nil {
+			return err
+		}
+		return revokeUserSessions(ctx, tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateProfile saves the username, display name, bio and privacy of the
+// user. Making the account public approves the pending follow requests.
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+update users set username = $1, display_name = $2, bio = $3, is_private = $4 where id = $5;
+`
+		result, err := tx.ExecContext(
+			ctx,
+			query,
+			user.Username,
+			user.DisplayName,
+			user.Bio,
+			user.IsPrivate,
+			user.ID,
+		)
+		if err != nil {
+			return userConstraintError(err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return ErrorNotFound
+		}
+		if user.IsPrivate {
+			return nil
+		}
+		query = `
+WITH approved AS (
+  DELETE FROM follow_requests WHERE target_id = $1 RETURNING user_id, target_id
+), followed AS (
+  INSERT INTO followers(user_id, follower_id)
+  SELECT user_id, target_id FROM approved
+  ON CONFLICT DO NOTHING
+  RETURNING user_id
+)
+UPDATE users SET followers_count = followers_count + (SELECT COUNT(*) FROM followed)
+WHERE id = $1
+`
+		_, err = tx.ExecContext(ctx, query, user.ID)
+		return err
+	})
+}
+
+// ChangePassword sets a new password and revokes every session of the user
+// but the one in keepSessionID.
+func (s *UserStore) ChangePassword(ctx context.Context, user *User, keepSessionID string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		query := `
+update users set password = $1 where id = $2;
+`
+		if _, err := tx.ExecContext(ctx, query, user.Password.Hash, user.ID); err != nil {
+			return err
+		}
+		query = `
+UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+`
+		_, err := tx.ExecContext(ctx, query, user.ID, keepSessionID)
+		return err
+	})
+}
+
+// CreateEmailChange stores a request to move the user to a new email, it is
+// carried out by ConfirmEmailChange with the token.
+func (s *UserStore) CreateEmailChange(
+	ctx context.Context,
+	userID int64,
+	email, token string,
+	exp time.Duration,
+) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		var taken bool
+		err := tx.QueryRowContext(
+			ctx,
+			`select exists(select 1 from users where email = $1)`,
+			email,
+		).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateEmail
+		}
+		// only the newest request counts
+		if _, err := tx.ExecContext(ctx, `delete from email_changes where user_id = $1`, userID); err != nil {
+			return err
+		}
+		query := `
+insert into email_changes(token, user_id, email, expiry) values($1, $2, $3, $4);
+`
+		_, err = tx.ExecContext(ctx, query, hashToken(token), userID, email, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ConfirmEmailChange moves the user the token was issued to to their new
+// email and returns the user id.
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (int64, error) {
+	var userID int64
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		query := `
+delete from email_changes where token = $1 returning user_id, email, expiry;
+`
+		var (
+			email  string
+			expiry time.Time
+		)
+		err := tx.QueryRowContext(ctx, query, hashToken(token)).Scan(&userID, &email, &expiry)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrInvalidToken
+			default:
+				return err
+			}
+		}
+		if time.Now().After(expiry) {
+			return ErrTokenExpired
+		}
+		if _, err := tx.ExecContext(ctx, `update users set email = $1 where id = $2`, email, userID); err != nil {
+			return userConstraintError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// SoftDelete marks the account of the user as deleted and signs them out
+// everywhere. The account is purged by PurgeDeleted after the grace period.
+func (s *UserStore) SoftDelete(ctx context.Context, userID int64) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		query := `
+update users set deleted_at = NOW() where id = $1 and deleted_at is null;
+`
+		result, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return ErrorNotFound
+		}
+		return revokeUserSessions(ctx, tx, userID)
+	})
+}
+
+// Restore takes back the deletion of an account that was not purged yet.
+func (s *UserStore) Restore(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `update users set deleted_at = null where id = $1`, userID)
+	return err
+}
+
+// PurgeDeleted deletes the accounts that were deleted longer than grace ago
+// and returns how many went.
+func (s *UserStore) PurgeDeleted(ctx context.Context, grace time.Duration) (int64, error) {
+	ids, err := func() ([]int64, error) {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+		defer cancel()
+		rows, err := s.db.QueryContext(
+			ctx,
+			`select id from users where deleted_at < $1`,
+			time.Now().Add(-grace),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, rows.Err()
+	}()
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, id := range ids {
+		if err := s.Delete(ctx, id); err != nil && !errors.Is(err, ErrorNotFound) {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// IsFollowing tells if the user follows targetID.
+func (s *UserStore) IsFollowing(ctx context.Context, userID, targetID int64) (bool, error) {
 	query := `
-SELECT id, username, email, password,is_active, role_id from users where email = $1;
+SELECT EXISTS(SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
 `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
 	defer cancel()
-	user := &User{}
-	var confirm bool
-	err := s.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password.Hash, &confirm, &user.RoleID,
-	)
+	var following bool
+	err := s.db.QueryRowContext(ctx, query, userID, targetID).Scan(&following)
+	return following, err
+}
+
+// CreateFollowRequest asks to follow the private account targetID. Asking
+// twice is not an error.
+func (s *UserStore) CreateFollowRequest(ctx context.Context, userID, targetID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		query := `
+SELECT
+  EXISTS(
+    SELECT 1 FROM blocks
+    WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1)
+  ),
+  EXISTS(SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+`
+		var blocked, following bool
+		if err := tx.QueryRowContext(ctx, query, userID, targetID).Scan(&blocked, &following); err != nil {
+			return err
+		}
+		switch {
+		case blocked:
+			return ErrBlocked
+		case following:
+			return ErrUserAlreadyFollows
+		}
+		query = `
+INSERT INTO follow_requests(user_id, target_id) VALUES($1, $2) ON CONFLICT DO NOTHING
+`
+		_, err := tx.ExecContext(ctx, query, userID, targetID)
+		return listConstraintError(err)
+	})
+}
+
+// ListFollowRequests returns a page of the pending requests to follow the
+// user, the newest first.
+func (s *UserStore) ListFollowRequests(
+	ctx context.Context,
+	userID int64,
+	q PaginatedFollowQuery,
+) ([]ListedUser, error) {
+	after := Cursor{CreatedAt: "epoch"}
+	if q.Cursor != "" {
+		var err error
+		if after, err = DecodeCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	query := `
+SELECT u.id, u.username, u.avatar_url, r.created_at
+FROM follow_requests r
+JOIN users u ON u.id = r.user_id
+WHERE r.target_id = $1
+  AND u.deactivated_at IS NULL
+  AND u.deleted_at IS NULL
+  AND ($2 = 0 OR (r.created_at, u.id) < ($3::timestamptz, $2))
+ORDER BY r.created_at DESC, u.id DESC
+LIMIT $4
+`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, userID, after.ID, after.CreatedAt, q.Limit)
 	if err != nil {
 		return nil, err
 	}
-	if !confirm {
-		return nil, ErrEmailNotConfirmed
+	defer rows.Close()
+	users := []ListedUser{}
+	for rows.Next() {
+		var u ListedUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.AvatarURL, &u.ListedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
 	}
-	return user, nil
+	return users, rows.Err()
+}
+
+// ApproveFollowRequest makes requesterID a follower of the user.
+func (s *UserStore) ApproveFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := deleteFollowRequest(ctx, tx, userID, requesterID); err != nil {
+			return err
+		}
+		query := `
+INSERT INTO followers(user_id, follower_id) VALUES($1, $2) ON CONFLICT DO NOTHING
+`
+		result, err := tx.ExecContext(ctx, query, requesterID, userID)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+			return err
+		}
+		query = `UPDATE users SET followers_count = followers_count + 1 WHERE id = $1`
+		_, err = tx.ExecContext(ctx, query, userID)
+		return err
+	})
+}
+
+// RejectFollowRequest drops the request of requesterID to follow the user.
+func (s *UserStore) RejectFollowRequest(ctx context.Context, userID, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeOut)
+	defer cancel()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteFollowRequest(ctx, tx, userID, requesterID)
+	})
+}
+
+func deleteFollowRequest(ctx context.Context, tx *sql.Tx, userID, requesterID int64) error {
+	query := `
+DELETE FROM follow_requests WHERE user_id = $1 AND target_id = $2;
+`
+	result, err := tx.ExecContext(ctx, query, requesterID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
 }
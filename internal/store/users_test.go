@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccountManagement(t *testing.T) {
+	db := newTestDB(t)
+	users := &UserStore{db}
+	ctx := context.Background()
+
+	alice := insertUser(t, db, "alice")
+	insertUser(t, db, "bob")
+
+	t.Run("should map a taken username", func(t *testing.T) {
+		err := users.UpdateProfile(ctx, &User{ID: alice, Username: "bob"})
+		if !errors.Is(err, ErrDuplicateUsername) {
+			t.Errorf("got %v, wanted %v", err, ErrDuplicateUsername)
+		}
+	})
+	t.Run("should update the profile", func(t *testing.T) {
+		err := users.UpdateProfile(ctx, &User{ID: alice, Username: "alice2", DisplayName: "Alice", Bio: "hi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := &User{}
+		if err := users.GetUser(ctx, user, alice); err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != "alice2" || user.DisplayName != "Alice" || user.Bio != "hi" {
+			t.Errorf("got %+v", user)
+		}
+	})
+	t.Run("should refuse a taken email", func(t *testing.T) {
+		err := users.CreateEmailChange(ctx, alice, "bob@example.com", "taken", time.Hour)
+		if !errors.Is(err, ErrDuplicateEmail) {
+			t.Errorf("got %v, wanted %v", err, ErrDuplicateEmail)
+		}
+	})
+	t.Run("should change the email once", func(t *testing.T) {
+		if err := users.CreateEmailChange(ctx, alice, "new@example.com", "token", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		userID, err := users.ConfirmEmailChange(ctx, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userID != alice {
+			t.Errorf("got user %d, wanted %d", userID, alice)
+		}
+		user := &User{}
+		if err := users.GetUser(ctx, user, alice); err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "new@example.com" {
+			t.Errorf("got email %q", user.Email)
+		}
+		if _, err := users.ConfirmEmailChange(ctx, "token"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("got %v, wanted %v", err, ErrInvalidToken)
+		}
+	})
+	t.Run("should reject an expired email change", func(t *testing.T) {
+		if err := users.CreateEmailChange(ctx, alice, "late@example.com", "late", -time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.ConfirmEmailChange(ctx, "late"); !errors.Is(err, ErrTokenExpired) {
+			t.Errorf("got %v, wanted %v", err, ErrTokenExpired)
+		}
+	})
+	t.Run("should hide, restore and purge deleted accounts", func(t *testing.T) {
+		if err := users.SoftDelete(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.GetProfile(ctx, alice, 0); !errors.Is(err, ErrorNotFound) {
+			t.Errorf("got %v, wanted %v", err, ErrorNotFound)
+		}
+		if err := users.Restore(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.GetProfile(ctx, alice, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.SoftDelete(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+		count, err := users.PurgeDeleted(ctx, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("purged %d accounts in the grace period", count)
+		}
+		if count, err = users.PurgeDeleted(ctx, -time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("purged %d accounts, wanted 1", count)
+		}
+	})
+}